@@ -0,0 +1,204 @@
+package mycache
+
+import(
+	"bytes"
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/merkle"
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/sirupsen/logrus"
+)
+
+//反熵（anti-entropy）
+//开启多副本后，同一个key会存放在多个节点上，Set通过syncToPeers异步同步到其他副本，
+//一旦某次同步失败，副本之间的数据就会一直不一致，直到过期为止。
+//后台协程定期与每个节点比较双方共享键区间（双方同为副本的key）的默克尔树，
+//根哈希一致则跳过，否则只拉取不一致的叶子桶中的数据进行修复：
+//	1.双方都持有但值不同的缓存项，以主节点（副本列表中的第一个）的值为准
+//	2.只有一方持有的缓存项不做复制：缓存没有墓碑，无法区分"对端丢失了写入"和
+//	  "对端已删除/淘汰"，复制过去会让已删除的key复活；缺失的key在下次读取时会重新加载
+
+//antiEntropyTimeout 与单个节点进行一轮反熵的超时时间
+const antiEntropyTimeout = 10*time.Second
+
+//syncPeer 支持反熵同步的peer（Client实现了该接口）
+type syncPeer interface{
+	Digest(ctx context.Context,group,peer string,leaves int) ([][]byte,error)
+	Sync(ctx context.Context,group,peer string,leaves int,buckets []int) ([]*pb.Entry,error)
+}
+
+//1.antiEntropyLoop 后台反熵协程，组关闭时退出
+func (g *Group) antiEntropyLoop(){
+	ticker := time.NewTicker(g.antiEntropyInterval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-g.stopCh:
+			return
+		case <-ticker.C:
+			g.runAntiEntropy()
+		}
+	}
+}
+
+//2.runAntiEntropy 与所有已知节点各进行一轮反熵
+func (g *Group) runAntiEntropy(){
+	rp,ok := g.peers.(ReplicaPicker)
+	if !ok{
+		return//未开启分布式模式或peer选择器不支持多副本
+	}
+
+	for _,addr := range rp.Peers(){
+		if err := g.antiEntropyWith(rp,addr); err != nil{
+			atomic.AddInt64(&g.stats.aeErrors,1)
+			logrus.Warnf("[mycache] anti-entropy with %s failed for group [%s]: %v",addr,g.name,err)
+		}
+	}
+	atomic.AddInt64(&g.stats.aeRounds,1)
+}
+
+//3.antiEntropyWith 与指定节点进行一轮反熵
+func (g *Group) antiEntropyWith(rp ReplicaPicker,addr string) error{
+	peer,ok := rp.GetPeer(addr)
+	if !ok{
+		return fmt.Errorf("peer %s not found",addr)
+	}
+	sp,ok := peer.(syncPeer)
+	if !ok{
+		return fmt.Errorf("peer %s does not support anti-entropy",addr)
+	}
+
+	ctx,cancel := context.WithTimeout(context.Background(),antiEntropyTimeout)
+	defer cancel()
+
+	//比较双方的默克尔树
+	local := g.sharedTree(rp,addr,merkle.DefaultLeaves)
+	remoteLeaves,err := sp.Digest(ctx,g.name,rp.Self(),local.LeafCount())
+	if err != nil{
+		return err
+	}
+	remote,err := merkle.FromLeaves(remoteLeaves)
+	if err != nil{
+		return err
+	}
+	if bytes.Equal(local.Root(),remote.Root()){
+		return nil//数据一致
+	}
+
+	//只同步不一致的叶子桶
+	buckets := merkle.Diff(local,remote)
+	remoteEntries,err := sp.Sync(ctx,g.name,rp.Self(),local.LeafCount(),buckets)
+	if err != nil{
+		return err
+	}
+
+	localEntries := make(map[string]*pb.Entry)
+	for _,e := range g.collectShared(rp,addr,local.LeafCount(),buckets){
+		localEntries[e.Key] = e
+	}
+
+	g.repair(ctx,rp,peer,addr,localEntries,remoteEntries)
+	return nil
+}
+
+//4.repair 根据双方的缓存项修复不一致的数据
+func (g *Group) repair(ctx context.Context,rp ReplicaPicker,peer Peer,addr string,local map[string]*pb.Entry,remote []*pb.Entry){
+	push := func(e *pb.Entry){
+		if err := peer.Set(ctx,g.name,e.Key,e.Value); err != nil{
+			logrus.Warnf("[mycache] anti-entropy failed to push key %s to %s: %v",e.Key,addr,err)
+			return
+		}
+		atomic.AddInt64(&g.stats.aeRepaired,1)
+	}
+
+	for _,re := range remote{
+		le,ok := local[re.Key]
+		if !ok || bytes.Equal(le.Value,re.Value){
+			continue//只有对端持有（可能已在本地删除）或值一致
+		}
+		atomic.AddInt64(&g.stats.aeDivergent,1)
+
+		//双方的值不同，以主节点的值为准
+		replicas := rp.Replicas(re.Key)
+		if len(replicas) == 0{
+			continue
+		}
+		switch replicas[0]{
+		case rp.Self():
+			push(le)
+		case addr:
+			g.storeEntry(re)
+			atomic.AddInt64(&g.stats.aeRepaired,1)
+		}//主节点是第三方时，由主节点与双方各自的反熵来修复
+	}
+}
+
+//5.storeEntry 将其他节点的缓存项写入本地缓存
+func (g *Group) storeEntry(e *pb.Entry){
+	view := ByteView{b: cloneBytes(e.Value)}
+	if e.TtlMs > 0{
+		g.mainCache.AddWithExpiration(e.Key,view,time.Now().Add(time.Duration(e.TtlMs)*time.Millisecond))
+	}else{
+		g.mainCache.Add(e.Key,view)
+	}
+}
+
+//6.digest 计算本节点与peer共享的键区间的默克尔树（供Server.Digest调用）
+func (g *Group) digest(peer string,leaves int) (*merkle.Tree,error){
+	rp,ok := g.peers.(ReplicaPicker)
+	if !ok{
+		return nil,fmt.Errorf("group %s does not support anti-entropy",g.name)
+	}
+	return g.sharedTree(rp,peer,leaves),nil
+}
+
+//7.sharedEntries 返回本节点与peer共享的键区间中指定叶子桶内的缓存项（供Server.Sync调用）
+func (g *Group) sharedEntries(peer string,leaves int,buckets []int) ([]*pb.Entry,error){
+	rp,ok := g.peers.(ReplicaPicker)
+	if !ok{
+		return nil,fmt.Errorf("group %s does not support anti-entropy",g.name)
+	}
+	return g.collectShared(rp,peer,leaves,buckets),nil
+}
+
+//sharedTree 对本节点与addr同为副本的缓存项构建默克尔树
+func (g *Group) sharedTree(rp ReplicaPicker,addr string,leaves int) *merkle.Tree{
+	builder := merkle.NewBuilder(leaves)
+	g.rangeShared(rp,addr,func(key string,value ByteView,ttl time.Duration){
+		builder.Add(key,value.b)
+	})
+	return builder.Build()
+}
+
+//collectShared 收集本节点与addr同为副本、且位于指定叶子桶内的缓存项
+func (g *Group) collectShared(rp ReplicaPicker,addr string,leaves int,buckets []int) []*pb.Entry{
+	wanted := make(map[int]struct{},len(buckets))
+	for _,b := range buckets{
+		wanted[b] = struct{}{}
+	}
+
+	var entries []*pb.Entry
+	g.rangeShared(rp,addr,func(key string,value ByteView,ttl time.Duration){
+		if _,ok := wanted[merkle.BucketOf(key,leaves)]; !ok{
+			return
+		}
+		entries = append(entries,newEntry(key,value,ttl))
+	})
+	return entries
+}
+
+//rangeShared 遍历本地缓存中本节点与addr同为副本的缓存项
+func (g *Group) rangeShared(rp ReplicaPicker,addr string,fn func(key string,value ByteView,ttl time.Duration)){
+	self := rp.Self()
+	g.mainCache.Range(func(key string,value ByteView,ttl time.Duration) bool{
+		replicas := rp.Replicas(key)
+		if containsAddr(replicas,self) && containsAddr(replicas,addr){
+			fn(key,value,ttl)
+		}
+		return true
+	})
+}
@@ -0,0 +1,154 @@
+package mycache
+
+import(
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Rampage-cd/DistributedCache/merkle"
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//aePicker 节点a和b组成的ReplicaPicker，所有key的副本都是[a,b]，a为主节点
+type aePicker struct{
+	self string
+	nodes map[string]*aeNode
+}
+
+func (p *aePicker) PickPeer(ctx context.Context,key string) (Peer,bool,bool){ return nil,false,false }
+func (p *aePicker) Close() error{ return nil }
+func (p *aePicker) Replicas(key string) []string{ return []string{"a","b"} }
+func (p *aePicker) Self() string{ return p.self }
+
+func (p *aePicker) GetPeer(addr string) (Peer,bool){
+	n,ok := p.nodes[addr]
+	return n,ok
+}
+
+func (p *aePicker) Peers() []string{
+	if p.self == "a"{
+		return []string{"b"}
+	}
+	return []string{"a"}
+}
+
+//aeNode 直接调用对方Group的peer，实现Peer和syncPeer
+type aeNode struct{
+	g *Group
+}
+
+func (n *aeNode) Get(ctx context.Context,group,key string) ([]byte,error){ return nil,nil }
+func (n *aeNode) Delete(ctx context.Context,group,key string) (bool,error){ return false,nil }
+func (n *aeNode) Close() error{ return nil }
+
+func (n *aeNode) Set(ctx context.Context,group,key string,value []byte) error{
+	n.g.mainCache.Add(key,ByteView{b: cloneBytes(value)})
+	return nil
+}
+
+func (n *aeNode) Digest(ctx context.Context,group,peer string,leaves int) ([][]byte,error){
+	tree,err := n.g.digest(peer,leaves)
+	if err != nil{
+		return nil,err
+	}
+	return tree.Leaves(),nil
+}
+
+func (n *aeNode) Sync(ctx context.Context,group,peer string,leaves int,buckets []int) ([]*pb.Entry,error){
+	return n.g.sharedEntries(peer,leaves,buckets)
+}
+
+//newAEPair 创建互为副本的两个缓存组a和b
+func newAEPair(t *testing.T) (*Group,*Group){
+	nodes := map[string]*aeNode{"a": {},"b": {}}
+	getter := GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return nil,nil
+	})
+	for _,addr := range []string{"a","b"}{
+		g := NewGroup("antientropy-"+t.Name()+"-"+addr,1<<20,getter,WithPeers(&aePicker{self: addr,nodes: nodes}))
+		nodes[addr].g = g
+		t.Cleanup(func(){ g.Close() })
+	}
+	return nodes["a"].g,nodes["b"].g
+}
+
+func TestAntiEntropyRepair(t *testing.T){
+	a,b := newAEPair(t)
+	a.mainCache.Add("y",ByteView{b: []byte("2")})//双方的值不同，以主节点a为准
+	b.mainCache.Add("y",ByteView{b: []byte("stale")})
+	a.mainCache.Add("w",ByteView{b: []byte("1")})
+	b.mainCache.Add("w",ByteView{b: []byte("1")})
+
+	digests := func() (*merkle.Tree,*merkle.Tree){
+		da,_ := a.digest("b",merkle.DefaultLeaves)
+		db,_ := b.digest("a",merkle.DefaultLeaves)
+		return da,db
+	}
+	if da,db := digests(); bytes.Equal(da.Root(),db.Root()){
+		t.Fatal("caches should diverge before the sync round")
+	}
+
+	if err := a.antiEntropyWith(a.peers.(ReplicaPicker),"b"); err != nil{
+		t.Fatal(err)
+	}
+
+	if da,db := digests(); !bytes.Equal(da.Root(),db.Root()){
+		t.Fatal("digests should match after one sync round")
+	}
+	for key,want := range map[string]string{"w": "1","y": "2"}{
+		view,ok := b.mainCache.Get(context.Background(),key)
+		if !ok || view.String() != want{
+			t.Fatalf("b: %s = %q, want %q",key,view.String(),want)
+		}
+	}
+	if n := atomic.LoadInt64(&a.stats.aeDivergent); n != 1{
+		t.Fatalf("expected 1 divergent key, got %d",n)
+	}
+}
+
+//删除只落在一方时，反熵不能把另一方的旧值复制回来
+func TestAntiEntropyDoesNotResurrectDeletes(t *testing.T){
+	a,b := newAEPair(t)
+	for _,g := range []*Group{a,b}{
+		g.mainCache.Add("x",ByteView{b: []byte("1")})
+		g.mainCache.Add("z",ByteView{b: []byte("3")})
+	}
+	a.mainCache.Delete("x")//a删除了x，同步到b之前失败
+	b.mainCache.Delete("z")//b淘汰了z
+
+	for _,round := range []struct{ g *Group; peer string }{{a,"b"},{b,"a"}}{
+		if err := round.g.antiEntropyWith(round.g.peers.(ReplicaPicker),round.peer); err != nil{
+			t.Fatal(err)
+		}
+	}
+
+	if _,ok := a.mainCache.Get(context.Background(),"x"); ok{
+		t.Fatal("deleted key x was resurrected on a")
+	}
+	if _,ok := b.mainCache.Get(context.Background(),"z"); ok{
+		t.Fatal("evicted key z was resurrected on b")
+	}
+	if n := atomic.LoadInt64(&a.stats.aeRepaired)+atomic.LoadInt64(&b.stats.aeRepaired); n != 0{
+		t.Fatalf("expected no repairs for one-sided keys, got %d",n)
+	}
+}
+
+func TestDigestLeavesBound(t *testing.T){
+	srv := &Server{}
+	for _,leaves := range []int32{0,-1,merkle.MaxLeaves+1,1<<30}{
+		_,err := srv.Digest(context.Background(),&pb.DigestRequest{Group: "any",Leaves: leaves})
+		if status.Code(err) != codes.InvalidArgument{
+			t.Fatalf("Digest with %d leaves: expected InvalidArgument, got %v",leaves,err)
+		}
+		_,err = srv.Sync(context.Background(),&pb.SyncRequest{Group: "any",Leaves: leaves})
+		if status.Code(err) != codes.InvalidArgument{
+			t.Fatalf("Sync with %d leaves: expected InvalidArgument, got %v",leaves,err)
+		}
+	}
+	if _,err := merkle.FromLeaves(make([][]byte,2*merkle.MaxLeaves)); err == nil{
+		t.Fatal("FromLeaves should reject more than MaxLeaves leaves")
+	}
+}
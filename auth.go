@@ -0,0 +1,319 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//认证和按缓存组授权
+//开启后每个请求先由Authenticator识别调用方（bearer token或mTLS证书），再按ACL检查调用方对缓存组的权限：
+//	1.Get需要读权限，Set/Delete需要写权限，CacheAdmin服务需要管理权限（HotKeys针对请求的缓存组，其他针对"*"），管理权限包含读写权限
+//	2.节点之间的请求（Peek、Digest、Sync、Transfer、Handoff、Invalidate、Replicate，以及带from-peer或纪元元数据的Get/Set/Delete）
+//	  只允许内部角色（Principal.Peer）调用，内部角色不受ACL限制
+//	3.没有凭证或凭证无效返回Unauthenticated，没有权限返回PermissionDenied；健康检查不需要认证
+//节点访问其他节点时需要出示内部角色的凭证：ClientPicker的WithPeerToken，或者证书名称在CertAuthenticator的节点列表中
+
+//authorizationKey 携带bearer token的gRPC元数据键
+const authorizationKey = "authorization"
+
+//ErrTokenWithoutTLS 配置了bearer token但连接没有使用TLS（token不能明文发送）
+var ErrTokenWithoutTLS = errors.New("mycache: bearer token requires TLS")
+
+//Permission 对缓存组的权限
+type Permission uint8
+
+const(
+	PermRead Permission = 1 << iota	//读
+	PermWrite						//写、删除
+	PermAdmin						//管理（包含读写）
+)
+
+//Principal 认证后的调用方
+type Principal struct{
+	Name string
+	Peer bool//是否为集群内的缓存节点（内部角色）
+}
+
+//principalKey 调用方在ctx中的键
+type principalKey struct{}
+
+//PrincipalFromContext 返回请求的调用方，没有开启认证时返回false
+func PrincipalFromContext(ctx context.Context) (*Principal,bool){
+	p,ok := ctx.Value(principalKey{}).(*Principal)
+	return p,ok
+}
+
+//Authenticator 识别调用方，请求中没有该类凭证时返回nil,nil，凭证无效时返回错误
+type Authenticator interface{
+	Authenticate(ctx context.Context) (*Principal,error)
+}
+
+//ChainAuthenticators 依次尝试多个Authenticator，返回第一个识别出的调用方
+func ChainAuthenticators(authenticators ...Authenticator) Authenticator{
+	return authChain(authenticators)
+}
+
+type authChain []Authenticator
+
+func (c authChain) Authenticate(ctx context.Context) (*Principal,error){
+	for _,a := range c{
+		p,err := a.Authenticate(ctx)
+		if err != nil || p != nil{
+			return p,err
+		}
+	}
+	return nil,nil
+}
+
+//TokenAuthenticator 通过authorization元数据中的bearer token认证
+type TokenAuthenticator struct{
+	mu sync.RWMutex
+	tokens map[string]Principal
+}
+
+//NewTokenAuthenticator 创建TokenAuthenticator
+func NewTokenAuthenticator() *TokenAuthenticator{
+	return &TokenAuthenticator{tokens: make(map[string]Principal)}
+}
+
+//1.AddToken 添加调用方name的token
+func (a *TokenAuthenticator) AddToken(token,name string){
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[token] = Principal{Name: name}
+}
+
+//2.AddPeerToken 添加缓存节点之间使用的token（内部角色）
+func (a *TokenAuthenticator) AddPeerToken(token string){
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokens[token] = Principal{Name: "peer",Peer: true}
+}
+
+//3.RemoveToken 删除token（如轮换后废弃旧token）
+func (a *TokenAuthenticator) RemoveToken(token string){
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.tokens,token)
+}
+
+//4.Authenticate 实现Authenticator接口
+func (a *TokenAuthenticator) Authenticate(ctx context.Context) (*Principal,error){
+	md,ok := metadata.FromIncomingContext(ctx)
+	if !ok{
+		return nil,nil
+	}
+	values := md.Get(authorizationKey)
+	if len(values) == 0{
+		return nil,nil
+	}
+	token,ok := strings.CutPrefix(values[0],"Bearer ")
+	if !ok{
+		return nil,errors.New("authorization is not a bearer token")
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	p,ok := a.tokens[token]
+	if !ok{
+		return nil,errors.New("invalid token")
+	}
+	return &p,nil
+}
+
+//CertAuthenticator 通过mTLS的客户端证书认证，证书的CommonName（没有时为第一个DNS名称）作为调用方名称
+//证书已经由PeerTLS按CA校验过，这里只识别身份
+type CertAuthenticator struct{
+	peers map[string]bool
+}
+
+//NewCertAuthenticator 创建CertAuthenticator，peerNames中的证书名称为缓存节点（内部角色）
+func NewCertAuthenticator(peerNames ...string) *CertAuthenticator{
+	a := &CertAuthenticator{peers: make(map[string]bool)}
+	for _,name := range peerNames{
+		a.peers[name] = true
+	}
+	return a
+}
+
+//Authenticate 实现Authenticator接口
+func (a *CertAuthenticator) Authenticate(ctx context.Context) (*Principal,error){
+	p,ok := peer.FromContext(ctx)
+	if !ok{
+		return nil,nil
+	}
+	info,ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0{
+		return nil,nil//没有经过校验的客户端证书
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	name := cert.Subject.CommonName
+	if name == "" && len(cert.DNSNames) > 0{
+		name = cert.DNSNames[0]
+	}
+	if name == ""{
+		return nil,errors.New("client certificate has no identity")
+	}
+	return &Principal{Name: name,Peer: a.peers[name]},nil
+}
+
+//ACL 调用方对缓存组的权限，调用方和缓存组都可以用"*"表示所有
+type ACL struct{
+	mu sync.RWMutex
+	grants map[string]map[string]Permission//调用方 -> 缓存组 -> 权限
+}
+
+//NewACL 创建空的ACL（拒绝所有非内部调用方）
+func NewACL() *ACL{
+	return &ACL{grants: make(map[string]map[string]Permission)}
+}
+
+//1.Grant 授予调用方对缓存组的权限，返回ACL以便链式调用
+func (a *ACL) Grant(principal,group string,perm Permission) *ACL{
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.grants[principal] == nil{
+		a.grants[principal] = make(map[string]Permission)
+	}
+	a.grants[principal][group] |= perm
+	return a
+}
+
+//2.Revoke 撤销调用方对缓存组的所有权限
+func (a *ACL) Revoke(principal,group string){
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.grants[principal],group)
+}
+
+//3.Allowed 判断调用方是否有缓存组的权限
+func (a *ACL) Allowed(principal,group string,perm Permission) bool{
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var granted Permission
+	for _,p := range []string{principal,"*"}{
+		groups := a.grants[p]
+		granted |= groups[group] | groups["*"]
+	}
+	return granted&PermAdmin != 0 || granted&perm == perm
+}
+
+//peerMethods 只允许缓存节点调用的方法
+var peerMethods = map[string]bool{
+	pb.MyCache_Peek_FullMethodName: true,
+	pb.MyCache_Digest_FullMethodName: true,
+	pb.MyCache_Sync_FullMethodName: true,
+	pb.MyCache_Transfer_FullMethodName: true,
+	pb.MyCache_Handoff_FullMethodName: true,
+	pb.MyCache_Invalidate_FullMethodName: true,
+	pb.MyCache_Replicate_FullMethodName: true,
+}
+
+//methodPermissions 其他方法需要的权限
+var methodPermissions = map[string]Permission{
+	pb.MyCache_Get_FullMethodName: PermRead,
+	pb.MyCache_Set_FullMethodName: PermWrite,
+	pb.MyCache_Delete_FullMethodName: PermWrite,
+	pb.CacheAdmin_Drain_FullMethodName: PermAdmin,
+	pb.CacheAdmin_HotKeys_FullMethodName: PermAdmin,
+}
+
+//1.authenticate 识别调用方并检查权限，返回带调用方的ctx
+func (s *Server) authenticate(ctx context.Context,method string,req interface{}) (context.Context,error){
+	if strings.HasPrefix(method,"/grpc.health.v1.Health/"){
+		return ctx,nil
+	}
+
+	p,err := s.opts.Authenticator.Authenticate(ctx)
+	if err != nil{
+		return nil,status.Errorf(codes.Unauthenticated,"authentication failed: %v",err)
+	}
+	if p == nil{
+		return nil,status.Error(codes.Unauthenticated,"missing credentials")
+	}
+	ctx = context.WithValue(ctx,principalKey{},p)
+	if p.Peer{
+		return ctx,nil//内部角色
+	}
+
+	if peerMethods[method] || isPeerRequest(ctx){
+		return nil,status.Errorf(codes.PermissionDenied,"%s is restricted to cache peers",method)
+	}
+	perm,ok := methodPermissions[method]
+	if !ok{
+		return nil,status.Errorf(codes.PermissionDenied,"%s is not permitted",method)
+	}
+
+	group := "*"//CacheAdmin服务不针对某个缓存组，或者针对所有缓存组
+	if r,ok := req.(interface{ GetGroup() string }); ok && r.GetGroup() != ""{
+		group = r.GetGroup()
+	}
+	if s.opts.ACL == nil || !s.opts.ACL.Allowed(p.Name,group,perm){
+		return nil,status.Errorf(codes.PermissionDenied,"%s is not allowed to access group %q",p.Name,group)
+	}
+	return ctx,nil
+}
+
+//2.authorizeUnary 认证和授权（一元RPC拦截器）
+func (s *Server) authorizeUnary(ctx context.Context,req interface{},info *grpc.UnaryServerInfo,handler grpc.UnaryHandler) (interface{},error){
+	if s.opts.Authenticator == nil{
+		return handler(ctx,req)
+	}
+	ctx,err := s.authenticate(ctx,info.FullMethod,req)
+	if err != nil{
+		return nil,err
+	}
+	return handler(ctx,req)
+}
+
+//3.authorizeStream 认证和授权（流式RPC拦截器，流式方法都只允许缓存节点调用）
+func (s *Server) authorizeStream(srv interface{},ss grpc.ServerStream,info *grpc.StreamServerInfo,handler grpc.StreamHandler) error{
+	if s.opts.Authenticator == nil{
+		return handler(srv,ss)
+	}
+	ctx,err := s.authenticate(ss.Context(),info.FullMethod,nil)
+	if err != nil{
+		return err
+	}
+	return handler(srv,&principalStream{ServerStream: ss,ctx: ctx})
+}
+
+//principalStream 携带调用方的ServerStream
+type principalStream struct{
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *principalStream) Context() context.Context{
+	return s.ctx
+}
+
+//isPeerRequest 判断请求是否带有节点之间的元数据（from-peer或哈希环纪元）
+func isPeerRequest(ctx context.Context) bool{
+	md,ok := metadata.FromIncomingContext(ctx)
+	return ok && (len(md.Get(fromPeerKey)) > 0 || len(md.Get(epochKey)) > 0)
+}
+
+//tokenCredentials 在每个请求的元数据中携带bearer token
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context,uri ...string) (map[string]string,error){
+	return map[string]string{authorizationKey: "Bearer "+string(t)},nil
+}
+
+//RequireTransportSecurity token只在TLS连接上发送，避免被窃听后冒用
+func (t tokenCredentials) RequireTransportSecurity() bool{
+	return true
+}
@@ -0,0 +1,161 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T){
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	//token只能在TLS连接上发送：服务端出示证书，客户端用CA校验
+	dir := t.TempDir()
+	newTestCA(t,dir).issue(t,dir,"node",2,net.ParseIP("127.0.0.1"))
+	serverTLS,err := NewPeerTLS(filepath.Join(dir,"node.pem"),filepath.Join(dir,"node-key.pem"),"")
+	if err != nil{
+		t.Fatal(err)
+	}
+	clientTLS,err := NewPeerTLS("","",filepath.Join(dir,"ca.pem"))
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	tokens := NewTokenAuthenticator()
+	tokens.AddToken("reader-token","reader")
+	tokens.AddToken("writer-token","writer")
+	tokens.AddPeerToken("peer-token")
+	acl := NewACL().
+		Grant("reader","auth-test",PermRead).
+		Grant("writer","auth-test",PermRead|PermWrite)
+
+	discovery := registry.NewStaticDiscovery(addr)
+	srv,err := NewServer(addr,"auth-test",WithRegistry(discovery),WithHandoffTimeout(0),WithAuth(tokens,acl),WithMutualTLS(serverTLS))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+	waitListening(t,addr)
+
+	NewGroup("auth-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("source:"+key),nil
+	}))
+	defer DestroyGroup("auth-test")
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+
+	newClient := func(token string) *CacheClient{
+		client,err := NewCacheClient("auth-test",discovery,WithAuthToken(token),WithClientTLS(clientTLS))
+		if err != nil{
+			t.Fatal(err)
+		}
+		return client
+	}
+	expect := func(err error,code codes.Code,what string){
+		t.Helper()
+		if status.Code(err) != code{
+			t.Fatalf("%s: expected %v, got %v",what,code,err)
+		}
+	}
+
+	anonymous := newClient("")
+	defer anonymous.Close()
+	_,err = anonymous.Get(ctx,"auth-test","k")
+	expect(err,codes.Unauthenticated,"anonymous get")
+
+	invalid := newClient("wrong-token")
+	defer invalid.Close()
+	_,err = invalid.Get(ctx,"auth-test","k")
+	expect(err,codes.Unauthenticated,"invalid token")
+
+	reader := newClient("reader-token")
+	defer reader.Close()
+	_,err = reader.Get(ctx,"auth-test","k")
+	expect(err,codes.OK,"reader get")
+	expect(reader.Set(ctx,"auth-test","k",[]byte("v")),codes.PermissionDenied,"reader set")
+	_,err = reader.Get(ctx,"other","k")
+	expect(err,codes.PermissionDenied,"reader get on another group")
+
+	writer := newClient("writer-token")
+	defer writer.Close()
+	expect(writer.Set(ctx,"auth-test","k",[]byte("v")),codes.OK,"writer set")
+	expect(writer.Delete(ctx,"auth-test","k"),codes.OK,"writer delete")
+
+	//不使用TLS时拒绝携带token
+	if _,err := NewCacheClient("auth-test",discovery,WithAuthToken("reader-token")); !errors.Is(err,ErrTokenWithoutTLS){
+		t.Fatalf("a token without TLS should be rejected, got %v",err)
+	}
+	if _,err := NewClient(addr,"auth-test",nil,WithBearerToken("peer-token")); !errors.Is(err,ErrTokenWithoutTLS){
+		t.Fatalf("a peer token without TLS should be rejected, got %v",err)
+	}
+
+	//节点之间的方法只允许内部角色
+	creds := WithTransportCredentials(clientTLS.ClientCredentials(registry.Node{Addr: addr}))
+	app,err := NewClient(addr,"auth-test",nil,WithBearerToken("writer-token"),creds)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer app.Close()
+	_,err = app.Peek(ctx,"auth-test","k")
+	expect(err,codes.PermissionDenied,"peek with an application token")
+	_,err = app.Get(ctx,"auth-test","k")
+	expect(err,codes.PermissionDenied,"peer-marked get with an application token")
+
+	peer,err := NewClient(addr,"auth-test",nil,WithBearerToken("peer-token"),creds)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer peer.Close()
+	_,err = peer.Get(ctx,"auth-test","k")
+	expect(err,codes.OK,"peer get")
+
+	//同步的写入走Replicate，也只允许内部角色
+	synced := context.WithValue(ctx,"from_peer",true)
+	expect(app.Set(synced,"auth-test","r",[]byte("v")),codes.PermissionDenied,"replicate with an application token")
+	expect(peer.Set(synced,"auth-test","r",[]byte("v")),codes.OK,"peer replicate")
+	if view,err := GetGroup("auth-test").Get(ctx,"r"); err != nil || view.String() != "v"{
+		t.Fatalf("the replicated write should be stored, got %q, %v",view.String(),err)
+	}
+}
+
+func TestACL(t *testing.T){
+	acl := NewACL().
+		Grant("ops","*",PermAdmin).
+		Grant("*","public",PermRead)
+
+	cases := []struct{
+		principal,group string
+		perm Permission
+		allowed bool
+	}{
+		{"ops","orders",PermWrite,true},
+		{"ops","*",PermAdmin,true},
+		{"alice","public",PermRead,true},
+		{"alice","public",PermWrite,false},
+		{"alice","orders",PermRead,false},
+	}
+	for _,c := range cases{
+		if got := acl.Allowed(c.principal,c.group,c.perm); got != c.allowed{
+			t.Errorf("Allowed(%s,%s,%d) = %v, want %v",c.principal,c.group,c.perm,got,c.allowed)
+		}
+	}
+
+	acl.Revoke("ops","*")
+	if acl.Allowed("ops","orders",PermRead){
+		t.Error("revoked grant should no longer apply")
+	}
+}
@@ -0,0 +1,283 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//节点的断路器、重试和异常节点摘除
+//一个节点宕机或者变慢时，不能让每个请求都等到超时：
+//	1.断路器：连续失败FailureThreshold次后打开，打开期间的请求直接失败；到期后进入半开状态，只放行一个探测请求，成功则关闭，失败则重新打开
+//	2.重试：节点不可用（Unavailable）时按带随机抖动的指数退避重试，重试次数受预算限制（约为请求数的RetryRatio），避免故障时重试放大流量
+//	3.异常节点摘除：断路器打开的节点暂时从PickPeer中摘除，请求落到哈希环上的下一个节点；
+//	  连续被摘除时摘除时间按次数增长（不超过MaxEjectionTime），同时被摘除的节点不超过MaxEjectionPercent
+//只有节点故障（Unavailable、Internal、DataLoss）和节点自身导致的超时计为失败；
+//调用方的context已经超时或取消时的DeadlineExceeded是调用方预算不足，对端返回的业务错误（如数据源加载失败）也不影响断路器
+
+//ErrCircuitOpen 节点的断路器处于打开状态
+var ErrCircuitOpen = errors.New("mycache: circuit breaker is open")
+
+//BreakerOptions 断路器、重试和摘除的配置
+type BreakerOptions struct{
+	FailureThreshold int			//连续失败多少次后打开断路器
+	EjectionTime time.Duration		//断路器第一次打开（摘除）的时间
+	MaxEjectionTime time.Duration	//连续摘除时的最长摘除时间，0表示使用默认值
+	MaxEjectionPercent int			//最多同时摘除的节点比例（百分比）
+	MaxRetries int					//单个请求的最大重试次数
+	RetryBackoff time.Duration		//第一次重试前的等待时间
+	RetryRatio float64				//重试预算：每个请求增加的重试次数
+	MinRetryTokens float64			//重试预算的初始值和最小上限，保证低流量时也能重试
+}
+
+//DefaultBreakerOptions 默认配置
+var DefaultBreakerOptions = BreakerOptions{
+	FailureThreshold: 5,
+	EjectionTime: 10*time.Second,
+	MaxEjectionTime: 5*time.Minute,
+	MaxEjectionPercent: 50,
+	MaxRetries: 2,
+	RetryBackoff: 20*time.Millisecond,
+	RetryRatio: 0.1,
+	MinRetryTokens: 10,
+}
+
+//breakerState 断路器状态
+type breakerState int
+
+const(
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string{
+	switch s{
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	default:
+		return "half_open"
+	}
+}
+
+//circuitBreaker 单个节点的断路器
+type circuitBreaker struct{
+	mu sync.Mutex
+	opts *BreakerOptions
+	state breakerState
+	failures int			//连续失败次数
+	openedAt time.Time
+	openFor time.Duration	//本次打开的时长
+	ejections int			//连续打开的次数，关闭后清零
+	probing bool			//半开状态下是否已经放行了探测请求
+	requests int64
+	errors int64
+	rejected int64
+}
+
+func newCircuitBreaker(opts *BreakerOptions) *circuitBreaker{
+	return &circuitBreaker{opts: opts}
+}
+
+//1.allow 判断是否可以发送请求，打开到期后放行一个探测请求
+func (b *circuitBreaker) allow() bool{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state{
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openFor{
+			b.rejected++
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+	case breakerHalfOpen:
+		if b.probing{
+			b.rejected++
+			return false
+		}
+		b.probing = true
+	}
+	b.requests++
+	return true
+}
+
+//2.record 记录请求结果，ctx为调用方的context
+func (b *circuitBreaker) record(ctx context.Context,err error){
+	failed := isTransportError(ctx,err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failed{
+		b.errors++
+	}
+	switch b.state{
+	case breakerClosed:
+		if !failed{
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold{
+			b.trip()
+		}
+	case breakerHalfOpen:
+		b.probing = false
+		if failed{
+			b.trip()
+			return
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		b.ejections = 0
+	}
+}
+
+//trip 打开断路器（调用方需持有锁），连续打开时打开时间按次数增长
+func (b *circuitBreaker) trip(){
+	maxEjection := b.opts.MaxEjectionTime
+	if maxEjection <= 0{
+		maxEjection = DefaultBreakerOptions.MaxEjectionTime
+	}
+	b.ejections++
+	b.openFor = min(b.opts.EjectionTime*time.Duration(b.ejections),maxEjection)
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+	b.failures = 0
+}
+
+//3.ejected 断路器打开且未到期时节点被摘除
+func (b *circuitBreaker) ejected() bool{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.openFor
+}
+
+//4.stats 返回断路器的统计信息
+func (b *circuitBreaker) stats() map[string]interface{}{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := map[string]interface{}{
+		"state": b.state.String(),
+		"consecutive_failures": b.failures,
+		"ejections": b.ejections,
+		"requests": b.requests,
+		"errors": b.errors,
+		"rejected": b.rejected,
+	}
+	if b.state == breakerOpen{
+		stats["ejected_for_ms"] = float64(max(b.openFor-time.Since(b.openedAt),0))/float64(time.Millisecond)
+	}
+	return stats
+}
+
+//retryBudget 重试预算（所有节点共用），每个请求增加RetryRatio，每次重试消耗1
+type retryBudget struct{
+	mu sync.Mutex
+	ratio float64
+	max float64
+	tokens float64
+	retries int64
+	exhausted int64
+}
+
+func newRetryBudget(opts *BreakerOptions) *retryBudget{
+	return &retryBudget{ratio: opts.RetryRatio,max: opts.MinRetryTokens,tokens: opts.MinRetryTokens}
+}
+
+//deposit 每个请求增加预算
+func (r *retryBudget) deposit(){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens = min(r.tokens+r.ratio,r.max)
+}
+
+//withdraw 消耗一次重试，预算不足时返回false
+func (r *retryBudget) withdraw() bool{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tokens < 1{
+		r.exhausted++
+		return false
+	}
+	r.tokens--
+	r.retries++
+	return true
+}
+
+//stats 返回重试预算的统计信息
+func (r *retryBudget) stats() map[string]interface{}{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]interface{}{
+		"tokens": r.tokens,
+		"retries": r.retries,
+		"exhausted": r.exhausted,
+	}
+}
+
+//peerHealth 节点的断路器和共用的重试预算
+type peerHealth struct{
+	opts *BreakerOptions
+	breaker *circuitBreaker
+	budget *retryBudget
+}
+
+//invoke 通过断路器执行请求，节点不可用时按预算重试
+func (h *peerHealth) invoke(ctx context.Context,addr string,fn func() error) error{
+	h.budget.deposit()
+
+	backoff := h.opts.RetryBackoff
+	for attempt := 0; ; attempt++{
+		if err := ctx.Err(); err != nil{
+			return status.FromContextError(err).Err()//调用方的超时预算已经用完，不再发送请求
+		}
+		if !h.breaker.allow(){
+			return fmt.Errorf("%w for %s",ErrCircuitOpen,addr)
+		}
+		err := fn()
+		h.breaker.record(ctx,err)
+		if err == nil || !isRetryable(err) || attempt >= h.opts.MaxRetries || !h.budget.withdraw(){
+			return err
+		}
+
+		//带随机抖动的指数退避
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff)+1))
+		select{
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+//isTransportError 判断是否为节点故障导致的错误
+func isTransportError(ctx context.Context,err error) bool{
+	if err == nil{
+		return false
+	}
+	switch status.Code(err){
+	case codes.Unavailable,codes.Internal,codes.DataLoss:
+		return true
+	case codes.DeadlineExceeded:
+		return ctx.Err() == nil//调用方的context已经到期时，超时不能算在节点头上
+	}
+	return false
+}
+
+//isRetryable 判断请求是否可以重试（节点不可用，请求没有被处理）
+func isRetryable(err error) bool{
+	return status.Code(err) == codes.Unavailable
+}
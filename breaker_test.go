@@ -0,0 +1,131 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCircuitBreaker(t *testing.T){
+	opts := DefaultBreakerOptions
+	opts.FailureThreshold = 3
+	opts.EjectionTime = 50*time.Millisecond
+	b := newCircuitBreaker(&opts)
+	ctx := context.Background()
+	unavailable := status.Error(codes.Unavailable,"down")
+
+	//业务错误不计为失败
+	for i := 0; i < 5; i++{
+		b.allow()
+		b.record(ctx,errors.New("loader failed"))
+	}
+	if b.state != breakerClosed{
+		t.Fatalf("application errors should not open the breaker, state=%s",b.state)
+	}
+
+	for i := 0; i < 3; i++{
+		if !b.allow(){
+			t.Fatalf("request %d rejected while closed",i)
+		}
+		b.record(ctx,unavailable)
+	}
+	if !b.ejected() || b.allow(){
+		t.Fatal("breaker should be open after consecutive failures")
+	}
+
+	//到期后只放行一个探测请求，探测失败时打开时间加倍
+	time.Sleep(60*time.Millisecond)
+	if !b.allow(){
+		t.Fatal("probe should be allowed after ejection time")
+	}
+	if b.allow(){
+		t.Fatal("only one probe should be allowed while half open")
+	}
+	b.record(ctx,unavailable)
+	if b.state != breakerOpen || b.openFor != 2*opts.EjectionTime{
+		t.Fatalf("failed probe should reopen with longer ejection, state=%s openFor=%v",b.state,b.openFor)
+	}
+
+	//探测成功后关闭
+	time.Sleep(110*time.Millisecond)
+	if !b.allow(){
+		t.Fatal("probe should be allowed after ejection time")
+	}
+	b.record(ctx,nil)
+	if b.state != breakerClosed || b.ejections != 0{
+		t.Fatalf("successful probe should close the breaker, state=%s",b.state)
+	}
+}
+
+func TestBreakerErrorClassification(t *testing.T){
+	opts := DefaultBreakerOptions
+	opts.FailureThreshold = 1
+	opts.MaxEjectionTime = 0
+	expired,cancel := context.WithCancel(context.Background())
+	cancel()
+
+	cases := []struct{
+		ctx context.Context
+		err error
+		failed bool
+	}{
+		{context.Background(),status.Error(codes.Unavailable,"down"),true},
+		{context.Background(),status.Error(codes.Internal,"panic"),true},
+		{context.Background(),status.Error(codes.DeadlineExceeded,"slow peer"),true},
+		{expired,status.Error(codes.DeadlineExceeded,"caller gave up"),false},
+		{context.Background(),status.Error(codes.Unknown,"loader failed"),false},
+		{context.Background(),status.Error(codes.ResourceExhausted,"quota"),false},
+		{context.Background(),status.Error(codes.PermissionDenied,"denied"),false},
+	}
+	for _,c := range cases{
+		b := newCircuitBreaker(&opts)
+		b.allow()
+		b.record(c.ctx,c.err)
+		if b.ejected() != c.failed{
+			t.Fatalf("%v (caller ctx err %v): ejected=%v, want %v",c.err,c.ctx.Err(),b.ejected(),c.failed)
+		}
+		if c.failed && b.openFor != opts.EjectionTime{
+			t.Fatalf("zero MaxEjectionTime should fall back to the default, openFor=%v",b.openFor)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T){
+	opts := DefaultBreakerOptions
+	opts.MinRetryTokens = 2
+	opts.RetryBackoff = time.Millisecond
+	h := &peerHealth{opts: &opts,breaker: newCircuitBreaker(&opts),budget: newRetryBudget(&opts)}
+
+	calls := 0
+	err := h.invoke(context.Background(),"peer",func() error{
+		calls++
+		return status.Error(codes.Unavailable,"down")
+	})
+	if status.Code(err) != codes.Unavailable || calls != opts.MaxRetries+1{
+		t.Fatalf("expected %d attempts, got %d (%v)",opts.MaxRetries+1,calls,err)
+	}
+
+	//预算用完后不再重试
+	calls = 0
+	h.invoke(context.Background(),"peer",func() error{
+		calls++
+		return status.Error(codes.Unavailable,"down")
+	})
+	if calls != 1{
+		t.Fatalf("expected no retries after budget is exhausted, got %d attempts",calls)
+	}
+
+	//不可重试的错误只执行一次
+	calls = 0
+	h.invoke(context.Background(),"peer",func() error{
+		calls++
+		return status.Error(codes.NotFound,"missing")
+	})
+	if calls != 1{
+		t.Fatalf("non-retryable error should not be retried, got %d attempts",calls)
+	}
+}
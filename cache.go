@@ -222,7 +222,25 @@ func (c *Cache) Close() {
 	logrus.Debugf("Cache closed, hits: %d, misses: %d", atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses))
 }
 
-//9.返回缓存统计信息
+//9.遍历缓存中所有未过期的项（ttl为0表示永不过期），fn返回false时停止遍历
+func (c *Cache) Range(fn func(key string,value ByteView,ttl time.Duration) bool){
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.store.Range(func(key string,val store.Value,ttl time.Duration) bool{
+		bv,ok := val.(ByteView)
+		if !ok{
+			return true
+		}
+		return fn(key,bv,ttl)
+	})
+}
+
+//10.返回缓存统计信息
 func (c *Cache) Stats() map[string]interface{} {//值的类型为interface，意味着值可以是任何类型
 	stats := map[string]interface{}{
 		"initialized": atomic.LoadInt32(&c.initialized) == 1,
@@ -250,3 +268,31 @@ func (c *Cache) Stats() map[string]interface{} {//值的类型为interface，意
 
 
 
+
+//11.Contains 判断key是否仍在缓存中（不计入命中统计）
+func (c *Cache) Contains(key string) bool{
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_,found := c.store.Get(key)
+	return found
+}
+
+//12.storeMetrics 返回底层存储的淘汰和过期统计（存储不支持时返回false）
+func (c *Cache) storeMetrics() (store.Metrics,bool){
+	if atomic.LoadInt32(&c.closed) == 1 || atomic.LoadInt32(&c.initialized) == 0 {
+		return store.Metrics{},false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if r,ok := c.store.(store.MetricsReporter); ok{
+		return r.Metrics(),true
+	}
+	return store.Metrics{},false
+}
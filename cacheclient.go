@@ -0,0 +1,537 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/consistenthash"
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+//独立的客户端SDK
+//不是缓存节点的应用不需要运行Server或创建本地Group，CacheClient通过与缓存节点相同的服务发现获取节点列表，
+//维护自己的哈希环和连接池，把请求直接发送给key的主节点：
+//	1.服务发现支持拓扑存储（etcd）时，哈希环与缓存节点一样由集群拓扑决定，否则由发现的节点列表构建
+//	2.每个节点维护PoolSize个gRPC连接，请求轮流使用
+//	3.所有操作都接受ctx，截止时间和取消随gRPC传递给节点；ctx没有截止时间时使用CallTimeout
+//	4.批量操作按主节点分组后并发发送
+//哈希环的分区器需要与缓存节点相同（WithClientPartitioner）
+
+//ErrNoNodes 没有可用的缓存节点
+var ErrNoNodes = errors.New("mycache: no cache nodes available")
+
+//CacheClientOptions CacheClient配置选项
+type CacheClientOptions struct{
+	PoolSize int						//每个节点的gRPC连接数
+	CallTimeout time.Duration			//ctx没有截止时间时单次调用的超时时间
+	Concurrency int						//批量操作的最大并发数
+	Partitioner consistenthash.Partitioner	//分区器，默认为带虚拟节点的一致性哈希
+	TLS *PeerTLS						//访问缓存节点使用的mTLS，为nil时不使用TLS
+	Token string						//缓存节点开启认证时携带的bearer token
+	Etcd *registry.Config				//没有指定服务发现时创建etcd服务发现的配置，也用于服务发现请求的超时，为nil时使用默认配置
+}
+
+//DefaultCacheClientOptions CacheClient默认配置
+var DefaultCacheClientOptions = &CacheClientOptions{
+	PoolSize: 2,
+	CallTimeout: 3*time.Second,
+	Concurrency: 16,
+}
+
+//CacheClientOption 定义CacheClient的选项函数
+type CacheClientOption func(*CacheClientOptions)
+
+//WithPoolSize 设置每个节点的gRPC连接数
+func WithPoolSize(n int) CacheClientOption{
+	return func(o *CacheClientOptions){
+		if n > 0{
+			o.PoolSize = n
+		}
+	}
+}
+
+//WithCallTimeout 设置ctx没有截止时间时单次调用的超时时间
+func WithCallTimeout(d time.Duration) CacheClientOption{
+	return func(o *CacheClientOptions){
+		o.CallTimeout = d
+	}
+}
+
+//WithBatchConcurrency 设置批量操作的最大并发数
+func WithBatchConcurrency(n int) CacheClientOption{
+	return func(o *CacheClientOptions){
+		if n > 0{
+			o.Concurrency = n
+		}
+	}
+}
+
+//WithClientPartitioner 设置分区器，需要与缓存节点使用的分区器相同
+func WithClientPartitioner(partitioner consistenthash.Partitioner) CacheClientOption{
+	return func(o *CacheClientOptions){
+		o.Partitioner = partitioner
+	}
+}
+
+//WithClientTLS 访问缓存节点时使用mTLS（校验节点证书与注册的节点身份一致）
+func WithClientTLS(t *PeerTLS) CacheClientOption{
+	return func(o *CacheClientOptions){
+		o.TLS = t
+	}
+}
+
+//WithAuthToken 每个请求携带bearer token（缓存节点开启认证时使用），需要同时设置WithClientTLS
+func WithAuthToken(token string) CacheClientOption{
+	return func(o *CacheClientOptions){
+		o.Token = token
+	}
+}
+
+//WithClientDiscoveryConfig 设置etcd配置（端点、TLS、认证、key前缀、超时），应与缓存节点使用相同的配置
+func WithClientDiscoveryConfig(config *registry.Config) CacheClientOption{
+	return func(o *CacheClientOptions){
+		o.Etcd = config
+	}
+}
+
+//connPool 一个节点的gRPC连接池
+type connPool struct{
+	conns []*grpc.ClientConn
+	clients []pb.MyCacheClient
+	next uint32
+}
+
+//dialPool 建立size个连接（不阻塞，连接在第一次调用时建立）
+func dialPool(addr string,size int,opts ...grpc.DialOption) (*connPool,error){
+	pool := &connPool{}
+	for i := 0; i < size; i++{
+		conn,err := grpc.Dial(addr,opts...)
+		if err != nil{
+			pool.close()
+			return nil,fmt.Errorf("failed to dial %s: %v",addr,err)
+		}
+		pool.conns = append(pool.conns,conn)
+		pool.clients = append(pool.clients,pb.NewMyCacheClient(conn))
+	}
+	return pool,nil
+}
+
+//get 轮流返回连接池中的客户端
+func (p *connPool) get() pb.MyCacheClient{
+	i := atomic.AddUint32(&p.next,1)
+	return p.clients[int(i)%len(p.clients)]
+}
+
+//close 关闭所有连接
+func (p *connPool) close() error{
+	var errs []error
+	for _,conn := range p.conns{
+		if err := conn.Close(); err != nil{
+			errs = append(errs,err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//CacheClient 直接访问缓存集群的客户端
+type CacheClient struct{
+	svcName string
+	opts *CacheClientOptions
+	discovery registry.Discovery
+	topology registry.TopologyStore	//服务发现不支持拓扑存储时为nil
+	ownsDiscovery bool
+	mu sync.RWMutex
+	partitioner consistenthash.Partitioner
+	ring map[string]registry.Member	//哈希环上的节点
+	nodes map[string]registry.Node	//已发现的节点
+	pools map[string]*connPool
+	epoch uint64					//哈希环的纪元，0表示由发现的节点列表构建
+	ctx context.Context
+	cancel context.CancelFunc
+}
+
+//NewCacheClient 创建CacheClient，discovery为nil时按WithClientDiscoveryConfig的配置（默认为registry.DefaultConfig）连接etcd
+func NewCacheClient(svcName string,discovery registry.Discovery,opts ...CacheClientOption) (*CacheClient,error){
+	defaults := *DefaultCacheClientOptions
+	options := &defaults
+	for _,opt := range opts{
+		opt(options)
+	}
+	if options.Partitioner == nil{
+		options.Partitioner = consistenthash.New()
+	}
+	if options.Token != "" && options.TLS == nil{
+		return nil,ErrTokenWithoutTLS
+	}
+
+	ownsDiscovery := false
+	if discovery == nil{
+		d,err := registry.DialEtcdDiscovery(options.Etcd)
+		if err != nil{
+			return nil,err
+		}
+		discovery,ownsDiscovery = d,true
+	}
+
+	ctx,cancel := context.WithCancel(context.Background())
+	c := &CacheClient{
+		svcName: svcName,
+		opts: options,
+		discovery: discovery,
+		ownsDiscovery: ownsDiscovery,
+		partitioner: options.Partitioner,
+		ring: make(map[string]registry.Member),
+		nodes: make(map[string]registry.Node),
+		pools: make(map[string]*connPool),
+		ctx: ctx,
+		cancel: cancel,
+	}
+	c.topology,_ = discovery.(registry.TopologyStore)
+
+	if err := c.start(); err != nil{
+		c.Close()
+		return nil,err
+	}
+	return c,nil
+}
+
+//1.Get 从key的主节点获取缓存值（未命中时由主节点加载）
+func (c *CacheClient) Get(ctx context.Context,group,key string) ([]byte,error){
+	cli,err := c.route(key)
+	if err != nil{
+		return nil,err
+	}
+	ctx,cancel := c.callContext(ctx)
+	defer cancel()
+
+	resp,err := cli.Get(ctx,&pb.Request{Group: group,Key: key})
+	if err != nil{
+		return nil,fmt.Errorf("failed to get %s: %w",key,err)
+	}
+	return resp.GetValue(),nil
+}
+
+//2.Set 写入key的主节点（由主节点写数据源并同步副本）
+func (c *CacheClient) Set(ctx context.Context,group,key string,value []byte) error{
+	cli,err := c.route(key)
+	if err != nil{
+		return err
+	}
+	ctx,cancel := c.callContext(ctx)
+	defer cancel()
+
+	if _,err := cli.Set(ctx,&pb.Request{Group: group,Key: key,Value: value}); err != nil{
+		return fmt.Errorf("failed to set %s: %w",key,err)
+	}
+	return nil
+}
+
+//3.Delete 从key的主节点删除（由主节点删除数据源并同步副本）
+func (c *CacheClient) Delete(ctx context.Context,group,key string) error{
+	cli,err := c.route(key)
+	if err != nil{
+		return err
+	}
+	ctx,cancel := c.callContext(ctx)
+	defer cancel()
+
+	if _,err := cli.Delete(ctx,&pb.Request{Group: group,Key: key}); err != nil{
+		return fmt.Errorf("failed to delete %s: %w",key,err)
+	}
+	return nil
+}
+
+//4.GetMulti 批量获取，返回成功获取的值和所有失败的错误
+func (c *CacheClient) GetMulti(ctx context.Context,group string,keys []string) (map[string][]byte,error){
+	var mu sync.Mutex
+	values := make(map[string][]byte,len(keys))
+	err := c.batch(ctx,keys,func(ctx context.Context,key string) error{
+		value,err := c.Get(ctx,group,key)
+		if err != nil{
+			return err
+		}
+		mu.Lock()
+		values[key] = value
+		mu.Unlock()
+		return nil
+	})
+	return values,err
+}
+
+//5.SetMulti 批量写入
+func (c *CacheClient) SetMulti(ctx context.Context,group string,items map[string][]byte) error{
+	keys := make([]string,0,len(items))
+	for key := range items{
+		keys = append(keys,key)
+	}
+	return c.batch(ctx,keys,func(ctx context.Context,key string) error{
+		return c.Set(ctx,group,key,items[key])
+	})
+}
+
+//6.DeleteMulti 批量删除
+func (c *CacheClient) DeleteMulti(ctx context.Context,group string,keys []string) error{
+	return c.batch(ctx,keys,func(ctx context.Context,key string) error{
+		return c.Delete(ctx,group,key)
+	})
+}
+
+//7.Owner 返回key的主节点地址
+func (c *CacheClient) Owner(key string) string{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.partitioner.Get(key)
+}
+
+//8.Nodes 返回哈希环上的节点地址
+func (c *CacheClient) Nodes() []string{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	addrs := make([]string,0,len(c.ring))
+	for addr := range c.ring{
+		addrs = append(addrs,addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+//9.Close 关闭所有连接和服务发现
+func (c *CacheClient) Close() error{
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for addr,pool := range c.pools{
+		if err := pool.close(); err != nil{
+			errs = append(errs,fmt.Errorf("failed to close connections to %s: %v",addr,err))
+		}
+		delete(c.pools,addr)
+	}
+	if c.ownsDiscovery{
+		if err := c.discovery.Close(); err != nil{
+			errs = append(errs,fmt.Errorf("failed to close discovery: %v",err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+//batch 按主节点分组，每组内顺序执行，组之间并发执行（最多Concurrency个）
+func (c *CacheClient) batch(ctx context.Context,keys []string,fn func(ctx context.Context,key string) error) error{
+	byOwner := make(map[string][]string)
+	c.mu.RLock()
+	for _,key := range keys{
+		owner := c.partitioner.Get(key)
+		byOwner[owner] = append(byOwner[owner],key)
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	sem := make(chan struct{},c.opts.Concurrency)
+	for _,ownerKeys := range byOwner{
+		wg.Add(1)
+		go func(keys []string){
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func(){ <-sem }()
+
+			for _,key := range keys{
+				if err := ctx.Err(); err != nil{
+					mu.Lock()
+					errs = append(errs,err)
+					mu.Unlock()
+					return
+				}
+				if err := fn(ctx,key); err != nil{
+					mu.Lock()
+					errs = append(errs,err)
+					mu.Unlock()
+				}
+			}
+		}(ownerKeys)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+//route 返回key的主节点的客户端，第一次访问节点时建立连接池
+func (c *CacheClient) route(key string) (pb.MyCacheClient,error){
+	c.mu.RLock()
+	addr := c.partitioner.Get(key)
+	pool,ok := c.pools[addr]
+	c.mu.RUnlock()
+	if addr == ""{
+		return nil,ErrNoNodes
+	}
+	if ok{
+		return pool.get(),nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pool,ok := c.pools[addr]; ok{
+		return pool.get(),nil
+	}
+	if c.ctx.Err() != nil{
+		return nil,fmt.Errorf("mycache: client closed")
+	}
+	creds := insecure.NewCredentials()
+	if c.opts.TLS != nil{
+		node,ok := c.nodes[addr]
+		if !ok{
+			node = registry.Node{ID: addr,Addr: addr}
+		}
+		creds = c.opts.TLS.ClientCredentials(node)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds),grpc.WithUnaryInterceptor(traceClientUnary)}
+	if c.opts.Token != ""{
+		opts = append(opts,grpc.WithPerRPCCredentials(tokenCredentials(c.opts.Token)))
+	}
+	pool,err := dialPool(addr,c.opts.PoolSize,opts...)
+	if err != nil{
+		return nil,err
+	}
+	c.pools[addr] = pool
+	return pool.get(),nil
+}
+
+//callContext ctx没有截止时间时加上默认超时
+func (c *CacheClient) callContext(ctx context.Context) (context.Context,context.CancelFunc){
+	if _,ok := ctx.Deadline(); ok || c.opts.CallTimeout <= 0{
+		return ctx,func(){}
+	}
+	return context.WithTimeout(ctx,c.opts.CallTimeout)
+}
+
+//start 获取节点列表和拓扑，并开始监听变化
+func (c *CacheClient) start() error{
+	ctx,cancel := context.WithTimeout(c.ctx,c.opts.Etcd.Timeout())
+	defer cancel()
+
+	nodes,err := c.discovery.List(ctx,c.svcName)
+	if err != nil{
+		return err
+	}
+	c.mu.Lock()
+	for _,node := range nodes{
+		c.addNode(node)
+	}
+	c.mu.Unlock()
+
+	if c.topology != nil{
+		updates := c.topology.WatchTopology(c.ctx,c.svcName)//先监听，避免错过读取期间的更新
+		if t,err := c.topology.GetTopology(ctx,c.svcName); err != nil{
+			logrus.Warnf("Failed to read topology, using discovered nodes: %v",err)
+		}else if t != nil{
+			c.adoptTopology(t)
+		}
+		go func(){
+			for t := range updates{
+				c.adoptTopology(t)
+			}
+		}()
+	}
+
+	go c.watchNodes()
+	return nil
+}
+
+//watchNodes 监听节点变化
+func (c *CacheClient) watchNodes(){
+	for events := range c.discovery.Watch(c.ctx,c.svcName){
+		c.mu.Lock()
+		for _,event := range events{
+			switch event.Type{
+			case registry.EventPut:
+				c.addNode(event.Node)
+			case registry.EventDelete:
+				c.removeNode(event.Node.Addr)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+//addNode 添加节点，还没有集群拓扑时加入哈希环（调用方需持有写锁）
+func (c *CacheClient) addNode(node registry.Node){
+	_,exists := c.nodes[node.Addr]
+	c.nodes[node.Addr] = node
+	if !exists && c.epoch == 0{
+		c.addToRing(node.Member())
+	}
+}
+
+//removeNode 移除节点并关闭连接池（调用方需持有写锁）
+func (c *CacheClient) removeNode(addr string){
+	delete(c.nodes,addr)
+	if c.epoch == 0{
+		c.partitioner.Remove(addr)
+		delete(c.ring,addr)
+	}
+	if _,onRing := c.ring[addr]; !onRing{
+		c.closePool(addr)
+	}
+}
+
+//addToRing 按权重加入哈希环（调用方需持有写锁）
+func (c *CacheClient) addToRing(m registry.Member){
+	if wp,ok := c.partitioner.(consistenthash.WeightedPartitioner); ok{
+		wp.AddWithWeight(m.Addr,max(m.Weight,1))
+	}else{
+		c.partitioner.Add(m.Addr)
+	}
+	c.ring[m.Addr] = m
+}
+
+//closePool 关闭节点的连接池（调用方需持有写锁）
+func (c *CacheClient) closePool(addr string){
+	if pool,ok := c.pools[addr]; ok{
+		pool.close()
+		delete(c.pools,addr)
+	}
+}
+
+//adoptTopology 采用纪元更大的拓扑
+func (c *CacheClient) adoptTopology(t *registry.Topology){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t.Epoch <= c.epoch{
+		return
+	}
+
+	want := make(map[string]registry.Member,len(t.Members))
+	for _,m := range t.Members{
+		want[m.Addr] = m
+	}
+	for addr := range c.ring{
+		if _,ok := want[addr]; !ok{
+			c.partitioner.Remove(addr)
+			delete(c.ring,addr)
+			if _,known := c.nodes[addr]; !known{
+				c.closePool(addr)
+			}
+		}
+	}
+	_,weighted := c.partitioner.(consistenthash.WeightedPartitioner)
+	for addr,member := range want{
+		current,ok := c.ring[addr]
+		if !ok || (weighted && current.Weight != member.Weight){
+			c.addToRing(member)
+		}
+	}
+	c.epoch = t.Epoch
+	logrus.Debugf("[mycache] cache client adopted ring epoch %d with %d members",t.Epoch,len(t.Members))
+}
@@ -0,0 +1,88 @@
+package mycache
+
+import(
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+func TestCacheClient(t *testing.T){
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	discovery := registry.NewStaticDiscovery(addr)
+	srv,err := NewServer(addr,"sdk-test",WithRegistry(discovery),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	NewGroup("sdk-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("source:"+key),nil
+	}))
+	defer DestroyGroup("sdk-test")
+
+	client,err := NewCacheClient("sdk-test",discovery)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	if owner := client.Owner("k"); owner != addr{
+		t.Fatalf("expected owner %s, got %s",addr,owner)
+	}
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+
+	if err := client.Set(ctx,"sdk-test","k",[]byte("v")); err != nil{
+		t.Fatal(err)
+	}
+	if value,err := client.Get(ctx,"sdk-test","k"); err != nil || string(value) != "v"{
+		t.Fatalf("expected v, got %q (%v)",value,err)
+	}
+
+	keys := make([]string,0,10)
+	for i := 0; i < 10; i++{
+		keys = append(keys,fmt.Sprintf("key%d",i))
+	}
+	values,err := client.GetMulti(ctx,"sdk-test",keys)
+	if err != nil || len(values) != len(keys){
+		t.Fatalf("expected %d values, got %d (%v)",len(keys),len(values),err)
+	}
+	if string(values["key3"]) != "source:key3"{
+		t.Errorf("unexpected value for key3: %q",values["key3"])
+	}
+
+	if err := client.Delete(ctx,"sdk-test","k"); err != nil{
+		t.Fatal(err)
+	}
+	if value,_ := client.Get(ctx,"sdk-test","k"); string(value) != "source:k"{
+		t.Errorf("expected value to be reloaded after delete, got %q",value)
+	}
+}
+
+//没有指定服务发现时按配置连接etcd，服务发现请求使用配置的超时
+func TestCacheClientDiscoveryConfig(t *testing.T){
+	config := &registry.Config{
+		Endpoints: []string{"127.0.0.1:1"},//没有etcd监听
+		DialTimeout: 100*time.Millisecond,
+		RequestTimeout: 200*time.Millisecond,
+	}
+	start := time.Now()
+	if _,err := NewCacheClient("sdk-config-test",nil,WithClientDiscoveryConfig(config)); err == nil{
+		t.Fatal("listing nodes from an unreachable etcd should fail")
+	}
+	if elapsed := time.Since(start); elapsed >= registry.DefaultConfig.Timeout(){
+		t.Fatalf("the configured request timeout was not used, took %v",elapsed)
+	}
+}
@@ -3,15 +3,25 @@ package mycache
 import (
 	"context"
 	"fmt"
+	"io"
+	"strconv"
 	"time"
 
 	pb "github.com/Rampage-cd/DistributedCache/pb"
 	"github.com/sirupsen/logrus"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
+//fromPeerKey 标记请求来自其他缓存节点的gRPC元数据键
+const fromPeerKey = "x-mycache-from-peer"
+
+//DefaultPeerTimeout 调用方的ctx没有截止时间时，节点间请求的默认超时时间
+const DefaultPeerTimeout = 3*time.Second
+
 //客户端的实现
 //通过gRPC与远端缓存节点通信，并可复用etcd客户端进行服务发现
 
@@ -22,65 +32,144 @@ type Client struct{
 	etcdCli *clientv3.Client
 	conn *grpc.ClientConn
 	grpcCli pb.MyCacheClient
+	epoch func() uint64//返回本节点哈希环的纪元，随请求发送给对端
+	health *peerHealth//断路器和重试预算，为nil时不做保护
 }//实现了Peer接口
 
 //编译期接口断言（确保*Client实现了Peer接口）
 var _ Peer = (*Client)(nil)
 
-func NewClient(addr string,svcName string,etcdCli *clientv3.Client) (*Client,error){
-	var err error
+//ClientOption 定义Client的选项函数
+type ClientOption func(*clientOptions)
 
-	//如果外部没有传入etcd客户端，则创建一个默认的
-	if etcdCli == nil{
-		etcdCli,err = clientv3.New(clientv3.Config{
-			Endpoints: []string{"localhost:2379"},//etcd集群地址
-			DialTimeout: 5*time.Second,//建立连接的超时时间
-		})
-		if err != nil{
-			return nil,fmt.Errorf("failed to create etcd client: %v",err)
-		}
+//clientOptions Client的配置
+type clientOptions struct{
+	creds credentials.TransportCredentials
+	token string
+}
+
+//WithTransportCredentials 设置连接使用的传输凭证（如PeerTLS.ClientCredentials），默认不使用TLS
+func WithTransportCredentials(creds credentials.TransportCredentials) ClientOption{
+	return func(o *clientOptions){
+		o.creds = creds
+	}
+}
+
+//WithBearerToken 每个请求携带bearer token（对端开启认证时使用），需要同时使用TLS
+func WithBearerToken(token string) ClientOption{
+	return func(o *clientOptions){
+		o.token = token
+	}
+}
+
+func NewClient(addr string,svcName string,etcdCli *clientv3.Client,opts ...ClientOption) (*Client,error){
+	options := &clientOptions{creds: insecure.NewCredentials()}
+	for _,opt := range opts{
+		opt(options)
+	}
+	if options.token != "" && options.creds.Info().SecurityProtocol == "insecure"{
+		return nil,ErrTokenWithoutTLS
+	}
+
+	//etcdCli可以为nil（使用非etcd的服务发现时）
+	client := &Client{
+		addr: addr,
+		svcName: svcName,
+		etcdCli: etcdCli,
+	}
+
+	dialOpts := []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(traceClientUnary,client.attachEpoch,client.observe),//请求携带trace context和本节点的哈希环纪元，记录请求结果和延迟
+		grpc.WithChainStreamInterceptor(client.attachEpochStream),
+		grpc.WithTransportCredentials(options.creds),//默认为不安全的传输（无TLS）
+		grpc.WithBlock(),//Dial调用会阻塞，直到连接建立成功或失败
+		grpc.WithTimeout(10*time.Second),//连接超时时间
+	}
+	if options.token != ""{
+		dialOpts = append(dialOpts,grpc.WithPerRPCCredentials(tokenCredentials(options.token)))
 	}
 
 	//建立grpc连接
 	conn, err := grpc.Dial(
 		addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),//不安全的传输（无TLS）
-		grpc.WithBlock(),//Dial调用会阻塞，直到连接建立成功或失败
-		grpc.WithTimeout(10*time.Second),//连接超时时间
-		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)),//RPC调用时，如果连接尚未就绪，会等待而不是立刻失败
+		dialOpts...,
 	)
 	if err != nil{
 		return nil,fmt.Errorf("failed to dial server: %v",err)
 	}
 
 	//基于gRPC连接创建业务客户端
-	grpcClient := pb.NewMyCacheClient(conn)
+	client.conn = conn
+	client.grpcCli = pb.NewMyCacheClient(conn)
 
-	//构造Client实例
-	client := &Client{
-		addr: addr,
-		svcName: svcName,
-		etcdCli: etcdCli,
-		conn: conn,
-		grpcCli: grpcClient,
+	return client,nil
+}
+
+//Addr 返回对端地址
+func (c *Client) Addr() string{
+	return c.addr
+}
+
+//withEpoch 在请求的元数据中加入本节点哈希环的纪元
+func (c *Client) withEpoch(ctx context.Context) context.Context{
+	if c.epoch == nil{
+		return ctx
 	}
+	return metadata.AppendToOutgoingContext(ctx,epochKey,strconv.FormatUint(c.epoch(),10))
+}
 
-	return client,nil
+//attachEpoch 一元RPC拦截器
+func (c *Client) attachEpoch(ctx context.Context,method string,req,reply interface{},cc *grpc.ClientConn,invoker grpc.UnaryInvoker,opts ...grpc.CallOption) error{
+	return invoker(c.withEpoch(ctx),method,req,reply,cc,opts...)
+}
+
+//observe 记录对端每个请求（包括重试）的结果和延迟（一元RPC拦截器）
+func (c *Client) observe(ctx context.Context,method string,req,reply interface{},cc *grpc.ClientConn,invoker grpc.UnaryInvoker,opts ...grpc.CallOption) error{
+	start := time.Now()
+	err := invoker(ctx,method,req,reply,cc,opts...)
+	observePeerCall(c.addr,method,start,err)
+	return err
+}
+
+//attachEpochStream 流式RPC拦截器
+func (c *Client) attachEpochStream(ctx context.Context,desc *grpc.StreamDesc,cc *grpc.ClientConn,method string,streamer grpc.Streamer,opts ...grpc.CallOption) (grpc.ClientStream,error){
+	return streamer(c.withEpoch(ctx),desc,cc,method,opts...)
+}
+
+//withDeadline 调用方的ctx没有截止时间时加上默认超时
+//有截止时间时直接使用，gRPC会把剩余的超时预算（grpc-timeout）传给对端，对端的加载和转发共用同一个截止时间
+func withDeadline(ctx context.Context) (context.Context,context.CancelFunc){
+	if _,ok := ctx.Deadline(); ok{
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx,DefaultPeerTimeout)
+}
+
+//call 通过断路器执行RPC，节点不可用时按预算重试
+func (c *Client) call(ctx context.Context,fn func() error) error{
+	if c.health == nil{
+		return fn()
+	}
+	return c.health.invoke(ctx,c.addr,fn)
 }
 
 //1.Get 从远端MyCache获取缓存数据
-func (c *Client) Get(group,key string) ([]byte,error){
-	//为本次gRPC调用创建一个带超时的context
-	ctx,cancel := context.WithTimeout(context.Background(),3*time.Second)
+func (c *Client) Get(ctx context.Context,group,key string) ([]byte,error){
+	ctx,cancel := withDeadline(ctx)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx,fromPeerKey,"true")//对端不会再转发这个请求
 
 	//发起gRPC请求
-	resp,err := c.grpcCli.Get(ctx,&pb.Request{
-		Group: group,
-		Key: key,
+	var resp *pb.ResponseForGet
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Get(ctx,&pb.Request{
+			Group: group,
+			Key: key,
+		})
+		return err
 	})
 	if err != nil{
-		return nil,fmt.Errorf("failed to get value from mycache: %v",err)
+		return nil,fmt.Errorf("failed to get value from mycache: %w",err)
 	}
 
 	//返回响应中的value字段
@@ -88,16 +177,23 @@ func (c *Client) Get(group,key string) ([]byte,error){
 }
 
 //2.Delete从远端MyCache删除缓存数据
-func (c *Client) Delete(group,key string) (bool,error){
-	ctx,cancel := context.WithTimeout(context.Background(),3*time.Second)
+func (c *Client) Delete(ctx context.Context,group,key string) (bool,error){
+	if ctx.Value("from_peer") != nil{//同步的删除，对端不会再同步给其他节点
+		return true,c.replicate(ctx,&pb.ReplicateRequest{Group: group,Key: key,Delete: true})
+	}
+	ctx,cancel := withDeadline(ctx)
 	defer cancel()
 
-	resp,err := c.grpcCli.Delete(ctx,&pb.Request{
-		Group: group,
-		Key:	key,
+	var resp *pb.ResponseForDelete
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Delete(ctx,&pb.Request{
+			Group: group,
+			Key:	key,
+		})
+		return err
 	})
 	if err != nil{
-		return false,fmt.Errorf("failed to delete value from mycache: %v",err)
+		return false,fmt.Errorf("failed to delete value from mycache: %w",err)
 	}
 
 	return resp.GetValue(),nil
@@ -105,13 +201,23 @@ func (c *Client) Delete(group,key string) (bool,error){
 
 //3.Set向远端MyCache写入缓存数据
 func (c *Client) Set(ctx context.Context,group,key string,value []byte) error{
-	resp,err := c.grpcCli.Set(ctx,&pb.Request{
-		Group: group,
-		Key: key,
-		Value:value,
+	if ctx.Value("from_peer") != nil{//同步的写入，对端不会再写数据源和同步
+		return c.replicate(ctx,&pb.ReplicateRequest{Group: group,Key: key,Value: value})
+	}
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+
+	var resp *pb.ResponseForGet
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Set(ctx,&pb.Request{
+			Group: group,
+			Key: key,
+			Value:value,
+		})
+		return err
 	})
 	if err != nil{
-		return fmt.Errorf("failed to set value to mycache: %v",err)
+		return fmt.Errorf("failed to set value to mycache: %w",err)
 	}
 
 	//打印服务端返回结果(便于调试)
@@ -120,7 +226,159 @@ func (c *Client) Set(ctx context.Context,group,key string,value []byte) error{
 	return nil
 }
 
-//4.关闭客户端资源(只负责关闭gRPC连接，etcd客户端是否关闭，通常由创建方决定)
+//4.Digest 获取远端与peer共享的键区间的默克尔树叶子哈希
+func (c *Client) Digest(ctx context.Context,group,peer string,leaves int) ([][]byte,error){
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+	var resp *pb.DigestResponse
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Digest(ctx,&pb.DigestRequest{
+			Group: group,
+			Peer: peer,
+			Leaves: int32(leaves),
+		})
+		return err
+	})
+	if err != nil{
+		return nil,fmt.Errorf("failed to get digest from mycache: %w",err)
+	}
+
+	return resp.GetLeaves(),nil
+}
+
+//5.Sync 拉取远端与peer共享的键区间中指定叶子桶内的缓存项
+func (c *Client) Sync(ctx context.Context,group,peer string,leaves int,buckets []int) ([]*pb.Entry,error){
+	req := &pb.SyncRequest{
+		Group: group,
+		Peer: peer,
+		Leaves: int32(leaves),
+		Buckets: make([]int32,0,len(buckets)),
+	}
+	for _,b := range buckets{
+		req.Buckets = append(req.Buckets,int32(b))
+	}
+
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+	var resp *pb.SyncResponse
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Sync(ctx,req)
+		return err
+	})
+	if err != nil{
+		return nil,fmt.Errorf("failed to sync entries from mycache: %w",err)
+	}
+
+	return resp.GetEntries(),nil
+}
+
+//6.Peek 只查询远端的本地缓存，未命中时不会触发加载
+func (c *Client) Peek(ctx context.Context,group,key string) ([]byte,error){
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+	var resp *pb.ResponseForGet
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Peek(ctx,&pb.Request{
+			Group: group,
+			Key: key,
+		})
+		return err
+	})
+	if err != nil{
+		return nil,fmt.Errorf("failed to peek value from mycache: %w",err)
+	}
+
+	return resp.GetValue(),nil
+}
+
+//7.Transfer 拉取远端缓存中由peer负责的缓存项
+//流式拉取是只读的，中途失败重试时从头重新拉取
+func (c *Client) Transfer(ctx context.Context,group,peer string) ([]*pb.Entry,error){
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+
+	var entries []*pb.Entry
+	err := c.call(ctx,func() error{
+		entries = nil
+		stream,err := c.grpcCli.Transfer(ctx,&pb.TransferRequest{
+			Group: group,
+			Peer: peer,
+		})
+		if err != nil{
+			return err
+		}
+		for{
+			entry,err := stream.Recv()
+			if err == io.EOF{
+				return nil
+			}
+			if err != nil{
+				return err
+			}
+			entries = append(entries,entry)
+		}
+	})
+	if err != nil{
+		return entries,fmt.Errorf("failed to transfer entries from mycache: %w",err)
+	}
+	return entries,nil
+}
+
+//8.Handoff 将缓存项推送给远端
+func (c *Client) Handoff(ctx context.Context,group string,entries []*pb.Entry) (int,error){
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+	var resp *pb.HandoffResponse
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Handoff(ctx,&pb.HandoffRequest{
+			Group: group,
+			Entries: entries,
+		})
+		return err
+	})
+	if err != nil{
+		return 0,fmt.Errorf("failed to handoff entries to mycache: %w",err)
+	}
+
+	return int(resp.GetAccepted()),nil
+}
+
+//9.Invalidate 通知远端删除本地缓存的副本
+func (c *Client) Invalidate(ctx context.Context,group string,keys []string) (int,error){
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+	var resp *pb.InvalidateResponse
+	err := c.call(ctx,func() (err error){
+		resp,err = c.grpcCli.Invalidate(ctx,&pb.InvalidateRequest{
+			Group: group,
+			Keys: keys,
+		})
+		return err
+	})
+	if err != nil{
+		return 0,fmt.Errorf("failed to invalidate keys on mycache: %w",err)
+	}
+
+	return int(resp.GetPurged()),nil
+}
+
+//replicate 将同步的写入/删除发给副本节点
+//Set/Delete的from-peer元数据只有认证过的节点才会被对端采纳，因此节点之间的同步使用单独的Replicate方法
+func (c *Client) replicate(ctx context.Context,req *pb.ReplicateRequest) error{
+	ctx,cancel := withDeadline(ctx)
+	defer cancel()
+
+	err := c.call(ctx,func() error{
+		_,err := c.grpcCli.Replicate(ctx,req)
+		return err
+	})
+	if err != nil{
+		return fmt.Errorf("failed to replicate to mycache: %w",err)
+	}
+	return nil
+}
+
+//10.关闭客户端资源(只负责关闭gRPC连接，etcd客户端是否关闭，通常由创建方决定)
 func (c *Client) Close() error{
 	if c.conn != nil{
 		return c.conn.Close()
@@ -0,0 +1,133 @@
+package mycache
+
+import(
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestPeerDeadlinePropagation(t *testing.T){
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"deadline-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	//记录对端加载数据时剩余的超时预算
+	budgets := make(chan time.Duration,1)
+	NewGroup("deadline-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		deadline,ok := ctx.Deadline()
+		if !ok{
+			budgets <- 0
+		}else{
+			budgets <- time.Until(deadline)
+		}
+		return []byte("source:"+key),nil
+	}))
+	defer DestroyGroup("deadline-test")
+
+	client,err := NewClient(addr,"deadline-test",nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	//调用方的截止时间传给对端，不会被默认超时放大
+	ctx,cancel := context.WithTimeout(context.Background(),time.Second)
+	defer cancel()
+	if _,err := client.Get(ctx,"deadline-test","a"); err != nil{
+		t.Fatal(err)
+	}
+	if budget := <-budgets; budget <= 0 || budget > time.Second{
+		t.Fatalf("the peer should see the caller's remaining budget, got %v",budget)
+	}
+
+	//没有截止时间时使用默认超时
+	if _,err := client.Get(context.Background(),"deadline-test","b"); err != nil{
+		t.Fatal(err)
+	}
+	if budget := <-budgets; budget <= time.Second || budget > DefaultPeerTimeout{
+		t.Fatalf("the peer should see the default timeout, got %v",budget)
+	}
+
+	//截止时间比默认超时长时也以调用方为准
+	ctx,cancel = context.WithTimeout(context.Background(),10*time.Second)
+	defer cancel()
+	if _,err := client.Get(ctx,"deadline-test","c"); err != nil{
+		t.Fatal(err)
+	}
+	if budget := <-budgets; budget <= DefaultPeerTimeout{
+		t.Fatalf("a longer caller deadline should not be cut to the default, got %v",budget)
+	}
+}
+
+//节点间的所有RPC都带截止时间，并经过断路器和重试
+func TestPeerRPCsUseDeadlineAndBreaker(t *testing.T){
+	var attempts,withDeadline int
+	record := func(ctx context.Context){
+		attempts++
+		if _,ok := ctx.Deadline(); ok{
+			withDeadline++
+		}
+	}
+	conn,err := grpc.NewClient("127.0.0.1:1",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(func(ctx context.Context,method string,req,reply interface{},cc *grpc.ClientConn,invoker grpc.UnaryInvoker,opts ...grpc.CallOption) error{
+			record(ctx)
+			return status.Error(codes.Unavailable,"down")
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context,desc *grpc.StreamDesc,cc *grpc.ClientConn,method string,streamer grpc.Streamer,opts ...grpc.CallOption) (grpc.ClientStream,error){
+			record(ctx)
+			return nil,status.Error(codes.Unavailable,"down")
+		}),
+	)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	opts := DefaultBreakerOptions
+	opts.FailureThreshold = 1000
+	opts.MaxRetries = 1
+	opts.RetryBackoff = time.Millisecond
+	opts.MinRetryTokens = 100
+	client := &Client{addr: "peer",conn: conn,grpcCli: pb.NewMyCacheClient(conn),
+		health: &peerHealth{opts: &opts,breaker: newCircuitBreaker(&opts),budget: newRetryBudget(&opts)}}
+
+	ctx := context.Background()
+	rpcs := map[string]func() error{
+		"Digest": func() error{ _,err := client.Digest(ctx,"g","self",8); return err },
+		"Sync": func() error{ _,err := client.Sync(ctx,"g","self",8,[]int{1}); return err },
+		"Transfer": func() error{ _,err := client.Transfer(ctx,"g","self"); return err },
+		"Handoff": func() error{ _,err := client.Handoff(ctx,"g",nil); return err },
+		"Invalidate": func() error{ _,err := client.Invalidate(ctx,"g",[]string{"k"}); return err },
+	}
+	for name,rpc := range rpcs{
+		attempts,withDeadline = 0,0
+		if err := rpc(); status.Code(err) != codes.Unavailable{
+			t.Fatalf("%s: expected Unavailable, got %v",name,err)
+		}
+		if attempts != opts.MaxRetries+1{
+			t.Fatalf("%s: expected %d attempts through the breaker, got %d",name,opts.MaxRetries+1,attempts)
+		}
+		if withDeadline != attempts{
+			t.Fatalf("%s: %d of %d attempts had no deadline",name,attempts-withDeadline,attempts)
+		}
+	}
+}
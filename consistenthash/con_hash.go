@@ -3,13 +3,19 @@ package consistenthash
 import(
 	"errors"
 	"sync"
-	"sync/atomic"
 	"fmt"
-	"time"
 	"sort"
 	"math"
 )
 
+//有界负载的一致性哈希（Consistent Hashing with Bounded Loads）
+//哈希环本身是静态的，key的归属只取决于节点列表，各个节点计算出的结果一致。
+//负载按节点地址记录：节点被移除时正在处理的请求仍记在该地址上，之后的Done释放的总是这些请求，
+//节点重新加入时它们一并计入，不会抵消重新加入后新请求的负载。
+//选择节点时记录每个节点正在处理的请求数（in-flight），当主节点的负载超过平均值的(1+ε)倍时，
+//沿哈希环顺时针找到第一个未超载的节点。请求结束后必须调用Done释放负载，
+//这样过载的节点只会把多出来的请求分给后面的节点，而不会改变key在整个集群中的归属。
+
 //Map 一致性哈希实现
 type Map struct{
 	mu sync.RWMutex
@@ -19,8 +25,8 @@ type Map struct{
 	keys []int     //哈希环(存放哈希环上所有虚拟节点的哈希值)
 	hashMap map[int]string//哈希环到节点的映射（记录虚拟节点属于哪个真实节点）
 	nodeReplicas map[string]int//节点到虚拟节点数量的映射（记录真实节点有多少个虚拟节点）
-	nodeCounts map[string]int64 //节点负载统计
-	totalRequests int64			//总请求数
+	loads map[string]int64		//节点正在处理的请求数（按地址记录，节点移除后仍保留到请求结束）
+	totalLoad int64				//哈希环上所有节点正在处理的请求总数
 }
 
 //New 创建一个Map实例
@@ -29,14 +35,13 @@ func New(opts ...Option) *Map{
 		config:				DefaultConfig,//调用同一个包下，config.go中对Config的默认配置
 		hashMap:			make(map[int]string),
 		nodeReplicas:		make(map[string]int),
-		nodeCounts:			make(map[string]int64),
+		loads:				make(map[string]int64),
 	}
 
 	for _,opt := range opts{
 		opt(m)
 	}
 
-	m.startBalancer() //启动负载均衡器
 	return m
 }
 
@@ -73,8 +78,29 @@ func (m *Map) Add(nodes ...string) error{
 	return nil
 }
 
+//AddWithWeight 按权重添加节点，虚拟节点数为DefaultReplicas*weight，节点已存在时按新权重重新添加
+func (m *Map) AddWithWeight(node string,weight int) error{
+	if node == "" || weight <= 0{
+		return fmt.Errorf("invalid node %q with weight %d",node,weight)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _,ok := m.nodeReplicas[node]; ok{
+		m.removeNode(node)//正在处理的请求数会保留，重新添加后仍然有效
+	}
+	m.addNode(node,m.config.DefaultReplicas*weight)
+
+	sort.Ints(m.keys)
+	return nil
+}
+
 //2.添加节点的虚拟节点
 func (m *Map) addNode(node string,replicas int){
+	if _,ok := m.nodeReplicas[node]; !ok{
+		m.totalLoad += m.loads[node]//节点移除前还没有结束的请求
+	}
 	for i:=0; i<replicas; i++{
 		hash := int(m.config.HashFunc([]byte(fmt.Sprintf("%s-%d",node,i))))//计算虚拟节点对应的哈希值
 		m.keys = append(m.keys,hash)
@@ -93,30 +119,42 @@ func (m *Map) Remove(node string) error{
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	//获取该节点有多少个虚拟节点
-	replicas := m.nodeReplicas[node]
-	if replicas == 0{
+	if _,ok := m.nodeReplicas[node]; !ok{
 		return fmt.Errorf("node %s not found",node)
 	}
+	m.removeNode(node)
+	return nil
+}
+
+//removeNode 移除节点的所有虚拟节点（调用方需持有锁）
+func (m *Map) removeNode(node string){
+	//获取该节点有多少个虚拟节点
+	replicas := m.nodeReplicas[node]
 
-	//移除节点的所有虚拟节点
+	//移除节点的所有虚拟节点（加权后单个节点的虚拟节点可能很多，一次遍历过滤哈希环）
+	removed := make(map[int]struct{},replicas)
 	for i:=0;i<replicas;i++{
 		hash := int(m.config.HashFunc([]byte(fmt.Sprintf("%s-%d",node,i))))
 		delete(m.hashMap,hash)
-		for j := 0;j<len(m.keys);j++{
-			if m.keys[j]==hash{
-				m.keys = append(m.keys[:j],m.keys[j+1:]...)
-				break
-			}
+		removed[hash] = struct{}{}
+	}
+	keys := m.keys[:0]
+	for _,hash := range m.keys{
+		if _,ok := removed[hash]; !ok{
+			keys = append(keys,hash)
 		}
 	}
+	m.keys = keys
 
 	delete(m.nodeReplicas,node)
-	delete(m.nodeCounts,node)
-	return nil
+	m.totalLoad -= m.loads[node]//正在处理的请求不再计入总负载，但仍记在该地址上，由之后的Done释放
+	if m.loads[node] == 0{
+		delete(m.loads,node)
+	}
 }
 
 //4.Get获取节点(根据key的哈希值找到对应虚拟节点的哈希值，再根据虚拟节点的哈希值找到真实节点)
+//主节点超载时返回沿哈希环找到的第一个未超载的节点，不计入负载
 func (m *Map) Get(key string) string{
 	if key == ""{
 		return ""
@@ -125,6 +163,11 @@ func (m *Map) Get(key string) string{
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.pick(key)
+}
+
+//pick 从key所在位置沿哈希环顺时针查找第一个未超载的节点（调用方需持有锁）
+func (m *Map) pick(key string) string{
 	if len(m.keys)==0{
 		return ""
 	}
@@ -140,110 +183,117 @@ func (m *Map) Get(key string) string{
 		idx = 0
 	}
 
-	node := m.hashMap[m.keys[idx]]
-	count := m.nodeCounts[node]
-	m.nodeCounts[node] = count + 1
-	atomic.AddInt64(&m.totalRequests,1)
+	owner := m.hashMap[m.keys[idx]]
+	if m.config.LoadFactor <= 0 || m.totalLoad == 0{
+		return owner
+	}
 
-	return node
+	//加上本次请求后每个节点允许的最大负载，按虚拟节点数（即权重）分配
+	limit := (1+m.config.LoadFactor) * float64(m.totalLoad+1) / float64(len(m.keys))
+	for i := 0; i<len(m.keys); i++{
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if m.loads[node] < int64(math.Ceil(limit*float64(m.nodeReplicas[node]))){
+			return node
+		}
+	}
+	return owner
 }
 
-//5.检查并重新平衡虚拟节点
-func (m *Map) checkAndRebalance(){
-	if atomic.LoadInt64(&m.totalRequests) < 1000{
-		return //样本太少，不进行调整
+//GetN 获取key对应的n个不同的真实节点（从key所在位置沿哈希环顺时针查找），第一个为主节点
+//用于副本放置，不计入负载统计
+func (m *Map) GetN(key string,n int) []string{
+	if key == "" || n <= 0{
+		return nil
 	}
 
-	//计算负载情况
-	avgLoad := float64(m.totalRequests) / float64(len(m.nodeReplicas))//平均每个节点承受的负载
-	var maxDiff float64
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-	for _,count := range m.nodeCounts{
-		diff := math.Abs(float64(count) - avgLoad)
-		if diff/avgLoad > maxDiff{
-			maxDiff = diff / avgLoad
-		}
+	if len(m.keys) == 0{
+		return nil
 	}
+	if n > len(m.nodeReplicas){
+		n = len(m.nodeReplicas)
+	}
+
+	hash := int(m.config.HashFunc([]byte(key)))
+	idx := sort.Search(len(m.keys),func(i int) bool{
+		return m.keys[i]>=hash
+	})
 
-	//如果最大的负载不均衡度超过阈值，调整虚拟节点
-	if maxDiff > m.config.LoadBalanceThreshold{
-		m.rebalanceNodes()
+	nodes := make([]string,0,n)
+	seen := make(map[string]struct{},n)
+	for i := 0; i<len(m.keys) && len(nodes)<n; i++{
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if _,ok := seen[node]; ok{
+			continue
+		}
+		seen[node] = struct{}{}
+		nodes = append(nodes,node)
 	}
+
+	return nodes
 }
 
-//6.重新平衡节点
-func (m *Map) rebalanceNodes(){
+//5.Acquire 选择处理key的节点并将其负载加一，请求结束后必须调用Done
+func (m *Map) Acquire(key string) string{
+	if key == ""{
+		return ""
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	avgLoad := float64(m.totalRequests) / float64(len(m.nodeReplicas))
+	node := m.pick(key)
+	if node != ""{
+		m.loads[node]++
+		m.totalLoad++
+	}
+	return node
+}
 
-	//调整每个节点的虚拟节点数量
-	for node,count := range m.nodeCounts{
-		currentReplicas := m.nodeReplicas[node]
-		loadRatio := float64(count) /avgLoad
+//AcquireNode 将指定节点的负载加一（调用方自己选择了节点，如同可用区的副本），请求结束后必须调用Done
+func (m *Map) AcquireNode(node string){
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		var newReplicas int
-		if loadRatio > 1{
-			//负载过高，减少虚拟节点
-			newReplicas = int(float64(currentReplicas) / loadRatio)//必须转化为int，因为虚拟节点个数必须为整数
-		}else{
-			//负载过低，增加虚拟节点
-			newReplicas = int(float64(currentReplicas) * (2 - loadRatio))
-		}
+	if _,ok := m.nodeReplicas[node]; ok{
+		m.loads[node]++
+		m.totalLoad++
+	}
+}
 
-		//确保在限制范围内
-		if newReplicas < m.config.MinReplicas {
-			newReplicas = m.config.MinReplicas
-		}
-		if newReplicas > m.config.MaxReplicas {
-			newReplicas = m.config.MaxReplicas
-		}
+//6.Done 释放Acquire时记录的负载
+func (m *Map) Done(node string){
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		//重新添加节点的虚拟节点
-		if newReplicas != currentReplicas{
-			if err := m.Remove(node); err != nil{
-				continue//移除失败，则跳过
-			}
-			m.addNode(node,newReplicas)
-		}
+	if m.loads[node] <= 0{
+		return
 	}
-
-	//重置计数器
-	for node := range m.nodeCounts{
-		m.nodeCounts[node]=0
+	m.loads[node]--
+	if _,ok := m.nodeReplicas[node]; ok{
+		m.totalLoad--
+	}else if m.loads[node] == 0{
+		delete(m.loads,node)//已经移除的节点的请求全部结束
 	}
-	atomic.StoreInt64(&m.totalRequests,0)
-
-	//重新排序
-	sort.Ints(m.keys)
 }
 
-//7. GetStats 获取负载统计信息（每个节点负载的百分比）
+//7.GetStats 获取负载统计信息（每个节点正在处理的请求数占总数的百分比）
 func (m *Map) GetStats() map[string]float64 {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	stats := make(map[string]float64)
-	total := atomic.LoadInt64(&m.totalRequests)
-	if total == 0 {
+	if m.totalLoad == 0 {
 		return stats
 	}
 
-	for node, count := range m.nodeCounts {
-		stats[node] = float64(count) / float64(total)
+	for node, load := range m.loads {
+		if _, ok := m.nodeReplicas[node]; !ok {
+			continue
+		}
+		stats[node] = float64(load) / float64(m.totalLoad)
 	}
 	return stats
 }
-
-//8.将checkAndRebalance移到单独的goroutine中
-func (m *Map) startBalancer() {
-	go func(){
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
-
-		for range ticker.C{
-			m.checkAndRebalance()
-		}//无限循环可能会导致协程无法退出
-	}()
-}
\ No newline at end of file
@@ -0,0 +1,142 @@
+package consistenthash
+
+import(
+	"fmt"
+	"hash/crc32"
+	"math"
+	"testing"
+)
+
+func newBoundedMap(loadFactor float64,nodes ...string) *Map{
+	m := New(WithConfig(&Config{
+		DefaultReplicas: 50,
+		HashFunc: crc32.ChecksumIEEE,
+		LoadFactor: loadFactor,
+	}))
+	m.Add(nodes...)
+	return m
+}
+
+//1.测试有界负载：热点key的请求不会让单个节点超过(1+ε)倍的平均负载
+func TestBoundedLoads(t *testing.T){
+	nodes := testNodes(4)
+	m := newBoundedMap(0.25,nodes...)
+	owner := m.Get("hot")
+
+	//同一个key的100个并发请求
+	acquired := make([]string,100)
+	for i := range acquired{
+		acquired[i] = m.Acquire("hot")
+	}
+
+	capacity := int64(math.Ceil(1.25*100/float64(len(nodes))))
+	for node,load := range m.loads{
+		if load > capacity{
+			t.Fatalf("节点%s的负载%d超过了上限%d",node,load,capacity)
+		}
+	}
+	if m.loads[owner] != capacity{
+		t.Fatalf("主节点%s应承担%d个请求，实际为%d",owner,capacity,m.loads[owner])
+	}
+
+	//释放负载后重新回到主节点，哈希环本身没有变化
+	for _,node := range acquired{
+		m.Done(node)
+	}
+	if m.totalLoad != 0{
+		t.Fatalf("释放后总负载应为0，实际为%d",m.totalLoad)
+	}
+	if got := m.Get("hot"); got != owner{
+		t.Fatalf("释放负载后key应回到主节点%s，实际为%s",owner,got)
+	}
+	if got := m.GetN("hot",1)[0]; got != owner{
+		t.Fatalf("GetN不应受负载影响，期望%s，实际为%s",owner,got)
+	}
+}
+
+//2.测试关闭有界负载时总是返回主节点
+func TestBoundedLoadsDisabled(t *testing.T){
+	m := newBoundedMap(0,testNodes(4)...)
+	owner := m.Get("hot")
+	for i := 0; i < 100; i++{
+		if got := m.Acquire("hot"); got != owner{
+			t.Fatalf("关闭有界负载时应总是返回主节点%s，实际为%s",owner,got)
+		}
+	}
+
+	//移除节点后它的负载不再计入总负载，之后的Done不会出错
+	m.Remove(owner)
+	m.Done(owner)
+	if m.totalLoad != 0{
+		t.Fatalf("移除节点后总负载应为0，实际为%d",m.totalLoad)
+	}
+	for i := 0; i < 10; i++{
+		if node := m.Get(fmt.Sprintf("key%d",i)); node == owner{
+			t.Fatalf("已移除的节点%s不应被选中",owner)
+		}
+	}
+}
+
+//3.测试按权重分配：key的分布与权重成正比
+func TestWeightedNodes(t *testing.T){
+	m := newBoundedMap(0)
+	nodes := testNodes(8)
+	weights := make(map[string]int)
+	for i,node := range nodes{
+		weights[node] = 1 + 3*(i%2)//一半节点权重为1，一半为4
+		m.AddWithWeight(node,weights[node])
+	}
+
+	counts := make(map[int]int)//按权重统计
+	for i := 0; i < testKeyCount; i++{
+		counts[weights[m.Get(fmt.Sprintf("user:%d",i))]]++
+	}
+	ratio := float64(counts[4])/float64(counts[1])
+	t.Logf("权重4:1的key分布比例 = %.2f",ratio)
+	if ratio < 3 || ratio > 5.5{
+		t.Fatalf("权重为4:1时key的分布比例应接近4，实际为%.2f",ratio)
+	}
+
+	//更新权重后虚拟节点数随之变化
+	m.AddWithWeight(nodes[1],1)
+	if m.nodeReplicas[nodes[1]] != m.nodeReplicas[nodes[0]]{
+		t.Fatalf("权重相同时虚拟节点数应相同，实际为%d和%d",m.nodeReplicas[nodes[1]],m.nodeReplicas[nodes[0]])
+	}
+	if len(m.keys) != 17*m.config.DefaultReplicas{
+		t.Fatalf("哈希环上应有%d个虚拟节点，实际为%d",17*m.config.DefaultReplicas,len(m.keys))
+	}
+}
+
+//4.测试节点移除后重新加入：移除前的请求结束时不会抵消重新加入后新请求的负载
+func TestBoundedLoadsRemoveAndReAdd(t *testing.T){
+	nodes := testNodes(3)
+	m := newBoundedMap(0,nodes...)
+	node := m.Acquire("key")
+
+	m.Remove(node)
+	if m.totalLoad != 0{
+		t.Fatalf("移除节点后总负载应为0，实际为%d",m.totalLoad)
+	}
+	m.Add(node)
+	if got := m.Acquire("key"); got != node{
+		t.Fatalf("重新加入后key应回到%s，实际为%s",node,got)
+	}
+
+	//移除前的请求结束，重新加入后的请求仍在处理
+	m.Done(node)
+	if m.loads[node] != 1 || m.totalLoad != 1{
+		t.Fatalf("重新加入后的请求应计为1，实际为%d（总负载%d）",m.loads[node],m.totalLoad)
+	}
+	m.Done(node)
+	if m.loads[node] != 0 || m.totalLoad != 0{
+		t.Fatalf("请求全部结束后负载应为0，实际为%d（总负载%d）",m.loads[node],m.totalLoad)
+	}
+
+	//移除后没有重新加入，请求结束时清除该地址的记录
+	node = m.Acquire("key")
+	m.Remove(node)
+	m.Done(node)
+	if _,ok := m.loads[node]; ok || m.totalLoad != 0{
+		t.Fatalf("已移除节点的请求结束后不应保留负载：%v",m.loads)
+	}
+}
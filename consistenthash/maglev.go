@@ -0,0 +1,182 @@
+package consistenthash
+
+import(
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Maglev Google Maglev负载均衡器中的一致性哈希
+//每个节点根据自己的(offset,skip)生成一个对查找表所有槽位的排列，
+//各节点轮流按自己的排列抢占查找表中的空槽位，直到填满。
+//各节点占有的槽位数最多相差1，负载几乎完全均衡，查找只需要一次取模和一次数组访问
+type Maglev struct{
+	mu sync.RWMutex
+	size uint64		//查找表大小（质数，且应远大于节点数）
+	nodes []string	//所有节点（有序）
+	table []int		//查找表，存放节点在nodes中的下标
+}
+
+//DefaultMaglevTableSize 默认的查找表大小
+const DefaultMaglevTableSize = 65537
+
+//NewMaglev 创建一个Maglev实例，tableSize会被调整为不小于它的质数，<=0时使用默认值
+func NewMaglev(tableSize int) *Maglev{
+	if tableSize <= 0{
+		tableSize = DefaultMaglevTableSize
+	}
+	return &Maglev{size: nextPrime(uint64(tableSize))}
+}
+
+//1.Add 添加节点并重建查找表
+func (m *Maglev) Add(nodes ...string) error{
+	if len(nodes) == 0{
+		return errors.New("no nodes provided")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _,node := range nodes{
+		if node == "" || m.indexOf(node) >= 0{
+			continue
+		}
+		m.nodes = append(m.nodes,node)
+	}
+	sort.Strings(m.nodes)
+
+	m.populate()
+	return nil
+}
+
+//2.Remove 移除节点并重建查找表
+func (m *Maglev) Remove(node string) error{
+	if node == ""{
+		return errors.New("invalid node")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.indexOf(node)
+	if idx < 0{
+		return fmt.Errorf("node %s not found",node)
+	}
+	m.nodes = append(m.nodes[:idx],m.nodes[idx+1:]...)
+
+	m.populate()
+	return nil
+}
+
+//3.Get 查表返回key对应的节点
+func (m *Maglev) Get(key string) string{
+	if key == ""{
+		return ""
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0{
+		return ""
+	}
+	return m.nodes[m.table[hash64(key)%m.size]]
+}
+
+//4.GetN 从key所在的槽位开始向后查找n个不同的节点
+func (m *Maglev) GetN(key string,n int) []string{
+	if key == "" || n <= 0{
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.table) == 0{
+		return nil
+	}
+	n = min(n,len(m.nodes))
+
+	nodes := make([]string,0,n)
+	seen := make(map[int]struct{},n)
+	start := hash64(key)%m.size
+	for i := uint64(0); i < m.size && len(nodes) < n; i++{
+		idx := m.table[(start+i)%m.size]
+		if _,ok := seen[idx]; ok{
+			continue
+		}
+		seen[idx] = struct{}{}
+		nodes = append(nodes,m.nodes[idx])
+	}
+	return nodes
+}
+
+//populate 按Maglev论文中的算法填充查找表（调用前已加锁）
+func (m *Maglev) populate(){
+	if len(m.nodes) == 0{
+		m.table = nil
+		return
+	}
+
+	//每个节点的排列：permutation[j] = (offset + j*skip) % size
+	offsets := make([]uint64,len(m.nodes))
+	skips := make([]uint64,len(m.nodes))
+	for i,node := range m.nodes{
+		offsets[i] = hash64(node+"#offset") % m.size
+		skips[i] = hash64(node+"#skip")%(m.size-1) + 1
+	}
+
+	table := make([]int,m.size)
+	for i := range table{
+		table[i] = -1
+	}
+	next := make([]uint64,len(m.nodes))//每个节点在自己排列中的位置
+
+	for filled := uint64(0); ;{
+		for i := range m.nodes{
+			//找到该节点排列中下一个空槽位
+			slot := (offsets[i] + next[i]*skips[i]) % m.size
+			for table[slot] >= 0{
+				next[i]++
+				slot = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			table[slot] = i
+			next[i]++
+
+			filled++
+			if filled == m.size{
+				m.table = table
+				return
+			}
+		}
+	}
+}
+
+//indexOf 返回节点在nodes中的下标，不存在时返回-1
+func (m *Maglev) indexOf(node string) int{
+	idx := sort.SearchStrings(m.nodes,node)
+	if idx < len(m.nodes) && m.nodes[idx] == node{
+		return idx
+	}
+	return -1
+}
+
+//nextPrime 返回不小于n的最小质数（查找表大小必须是质数，否则节点的排列无法覆盖所有槽位）
+func nextPrime(n uint64) uint64{
+	if n <= 2{
+		return 2
+	}
+	for ; ; n++{
+		isPrime := true
+		for d := uint64(2); d*d <= n; d++{
+			if n%d == 0{
+				isPrime = false
+				break
+			}
+		}
+		if isPrime{
+			return n
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package consistenthash
+
+import "hash/fnv"
+
+//Partitioner 分区器，负责把key映射到节点（ClientPicker通过它选择key的主节点和副本节点）
+//Map（带虚拟节点的一致性哈希）、Rendezvous（最高随机权重哈希）和Maglev都实现了该接口
+type Partitioner interface{
+	//Add 添加节点
+	Add(nodes ...string) error
+	//Remove 移除节点
+	Remove(node string) error
+	//Get 返回key对应的节点
+	Get(key string) string
+	//GetN 返回key对应的n个不同节点，第一个为主节点（不受负载影响，没有负载时与Get的结果相同）
+	GetN(key string,n int) []string
+}
+
+//BoundedPartitioner 支持有界负载的分区器（Map实现了该接口）
+type BoundedPartitioner interface{
+	Partitioner
+	//Acquire 选择处理key的节点并将其负载加一
+	Acquire(key string) string
+	//AcquireNode 将指定节点的负载加一
+	AcquireNode(node string)
+	//Done 释放Acquire时记录的负载
+	Done(node string)
+}
+
+//WeightedPartitioner 支持按权重分配节点的分区器（Map实现了该接口）
+type WeightedPartitioner interface{
+	Partitioner
+	//AddWithWeight 按权重添加节点，节点已存在时更新权重
+	AddWithWeight(node string,weight int) error
+}
+
+//编译期接口断言
+var(
+	_ Partitioner = (*Map)(nil)
+	_ Partitioner = (*Rendezvous)(nil)
+	_ Partitioner = (*Maglev)(nil)
+	_ BoundedPartitioner = (*Map)(nil)
+	_ WeightedPartitioner = (*Map)(nil)
+)
+
+//hash64 计算64位哈希值（FNV-1a后再做一次混淆，使相近的输入得到差异很大的输出）
+func hash64(data string) uint64{
+	h := fnv.New64a()
+	h.Write([]byte(data))
+	return mix64(h.Sum64())
+}
+
+//mix64 64位整数的混淆函数（MurmurHash3的fmix64）
+func mix64(x uint64) uint64{
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
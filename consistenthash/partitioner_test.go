@@ -0,0 +1,181 @@
+package consistenthash
+
+import(
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+//分区器的均衡性与key迁移量测试
+//均衡性：各节点分到的key数量的最大值与平均值之比（越接近1越均衡）
+//迁移量：添加/删除一个节点后主节点发生变化的key所占比例（理想值为1/节点数）
+
+const(
+	testNodeCount = 10
+	testKeyCount = 100000
+)
+
+//partitionerCase 待测试的分区器
+type partitionerCase struct{
+	name string
+	newFunc func() Partitioner
+	maxImbalance float64//允许的最大不均衡度（最大值/平均值）
+}
+
+func partitionerCases() []partitionerCase{
+	return []partitionerCase{
+		{
+			name: "consistenthash",
+			newFunc: func() Partitioner{
+				return New(WithConfig(&Config{
+					DefaultReplicas: 160,
+					HashFunc: crc32.ChecksumIEEE,
+				}))
+			},
+			maxImbalance: 1.35,
+		},
+		{
+			name: "rendezvous",
+			newFunc: func() Partitioner{ return NewRendezvous() },
+			maxImbalance: 1.1,
+		},
+		{
+			name: "maglev",
+			newFunc: func() Partitioner{ return NewMaglev(0) },
+			maxImbalance: 1.05,
+		},
+	}
+}
+
+func testNodes(n int) []string{
+	nodes := make([]string,n)
+	for i := range nodes{
+		nodes[i] = fmt.Sprintf("10.0.0.%d:8001",i+1)
+	}
+	return nodes
+}
+
+func testKeys() []string{
+	keys := make([]string,testKeyCount)
+	for i := range keys{
+		keys[i] = fmt.Sprintf("user:%d",i)
+	}
+	return keys
+}
+
+//assignments 返回每个key的主节点
+func assignments(p Partitioner,keys []string) []string{
+	owners := make([]string,len(keys))
+	for i,key := range keys{
+		owners[i] = p.Get(key)
+	}
+	return owners
+}
+
+//movedRatio 返回主节点发生变化的key所占比例
+func movedRatio(before,after []string) float64{
+	moved := 0
+	for i := range before{
+		if before[i] != after[i]{
+			moved++
+		}
+	}
+	return float64(moved)/float64(len(before))
+}
+
+//1.测试均衡性
+func TestPartitionerBalance(t *testing.T){
+	keys := testKeys()
+	for _,tc := range partitionerCases(){
+		t.Run(tc.name,func(t *testing.T){
+			p := tc.newFunc()
+			p.Add(testNodes(testNodeCount)...)
+
+			counts := make(map[string]int)
+			for _,owner := range assignments(p,keys){
+				counts[owner]++
+			}
+			if len(counts) != testNodeCount{
+				t.Fatalf("应有%d个节点分到key，实际为%d",testNodeCount,len(counts))
+			}
+
+			maxCount := 0
+			for _,c := range counts{
+				maxCount = max(maxCount,c)
+			}
+			imbalance := float64(maxCount)/(float64(testKeyCount)/testNodeCount)
+			t.Logf("%s: 最大负载/平均负载 = %.3f",tc.name,imbalance)
+			if imbalance > tc.maxImbalance{
+				t.Fatalf("不均衡度%.3f超过了上限%.3f",imbalance,tc.maxImbalance)
+			}
+		})
+	}
+}
+
+//2.测试添加和删除节点时的key迁移量
+func TestPartitionerMovement(t *testing.T){
+	keys := testKeys()
+	nodes := testNodes(testNodeCount+1)
+	ideal := 1.0/float64(testNodeCount+1)
+
+	for _,tc := range partitionerCases(){
+		t.Run(tc.name,func(t *testing.T){
+			p := tc.newFunc()
+			p.Add(nodes[:testNodeCount]...)
+			before := assignments(p,keys)
+
+			//添加节点：只有分给新节点的key应该移动
+			p.Add(nodes[testNodeCount])
+			afterAdd := assignments(p,keys)
+			for i := range keys{
+				if before[i] != afterAdd[i] && afterAdd[i] != nodes[testNodeCount]{
+					if tc.name != "maglev"{
+						t.Fatalf("key %s从%s移动到了%s，而不是新节点",keys[i],before[i],afterAdd[i])
+					}
+				}
+			}
+			added := movedRatio(before,afterAdd)
+
+			//删除节点：应恢复到添加之前的分配
+			p.Remove(nodes[testNodeCount])
+			afterRemove := assignments(p,keys)
+			restored := movedRatio(before,afterRemove)
+
+			t.Logf("%s: 添加节点迁移比例 = %.4f（理想值 %.4f），删除后与原分配的差异 = %.4f",tc.name,added,ideal,restored)
+			if added > ideal*1.5{
+				t.Fatalf("添加节点迁移比例%.4f过高",added)
+			}
+			if restored != 0{
+				t.Fatalf("删除节点后应恢复原来的分配，差异为%.4f",restored)
+			}
+		})
+	}
+}
+
+//3.测试GetN返回不同的节点且第一个与Get一致
+func TestPartitionerGetN(t *testing.T){
+	for _,tc := range partitionerCases(){
+		t.Run(tc.name,func(t *testing.T){
+			p := tc.newFunc()
+			p.Add(testNodes(5)...)
+
+			for i := 0; i < 1000; i++{
+				key := fmt.Sprintf("key%d",i)
+				nodes := p.GetN(key,3)
+				if len(nodes) != 3{
+					t.Fatalf("GetN应返回3个节点，实际为%v",nodes)
+				}
+				if nodes[0] != p.Get(key){
+					t.Fatalf("GetN的第一个节点%s应与Get的结果%s一致",nodes[0],p.Get(key))
+				}
+				if nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2]{
+					t.Fatalf("GetN返回了重复的节点：%v",nodes)
+				}
+			}
+
+			if nodes := p.GetN("key",10); len(nodes) != 5{
+				t.Fatalf("n大于节点数时应返回全部5个节点，实际为%v",nodes)
+			}
+		})
+	}
+}
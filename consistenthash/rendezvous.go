@@ -0,0 +1,123 @@
+package consistenthash
+
+import(
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Rendezvous 最高随机权重（HRW）哈希
+//对每个节点计算score = hash(node,key)，得分最高的节点即为key的主节点。
+//不需要虚拟节点，添加或删除一个节点时，只有原本（或将要）属于该节点的key会移动
+type Rendezvous struct{
+	mu sync.RWMutex
+	nodes []string			//所有节点（有序）
+	nodeHashes []uint64		//节点名称的哈希值，与nodes一一对应
+}
+
+//NewRendezvous 创建一个Rendezvous实例
+func NewRendezvous() *Rendezvous{
+	return &Rendezvous{}
+}
+
+//1.Add 添加节点
+func (r *Rendezvous) Add(nodes ...string) error{
+	if len(nodes) == 0{
+		return errors.New("no nodes provided")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _,node := range nodes{
+		if node == "" || r.indexOf(node) >= 0{
+			continue
+		}
+		r.nodes = append(r.nodes,node)
+	}
+	sort.Strings(r.nodes)
+
+	r.nodeHashes = make([]uint64,len(r.nodes))
+	for i,node := range r.nodes{
+		r.nodeHashes[i] = hash64(node)
+	}
+	return nil
+}
+
+//2.Remove 移除节点
+func (r *Rendezvous) Remove(node string) error{
+	if node == ""{
+		return errors.New("invalid node")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := r.indexOf(node)
+	if idx < 0{
+		return fmt.Errorf("node %s not found",node)
+	}
+	r.nodes = append(r.nodes[:idx],r.nodes[idx+1:]...)
+	r.nodeHashes = append(r.nodeHashes[:idx],r.nodeHashes[idx+1:]...)
+	return nil
+}
+
+//3.Get 返回得分最高的节点
+func (r *Rendezvous) Get(key string) string{
+	if key == ""{
+		return ""
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keyHash := hash64(key)
+	var best string
+	var bestScore uint64
+	for i,node := range r.nodes{
+		if score := mix64(r.nodeHashes[i]^keyHash); best == "" || score > bestScore{
+			best,bestScore = node,score
+		}
+	}
+	return best
+}
+
+//4.GetN 返回得分最高的n个节点
+func (r *Rendezvous) GetN(key string,n int) []string{
+	if key == "" || n <= 0{
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type scored struct{
+		node string
+		score uint64
+	}
+	keyHash := hash64(key)
+	all := make([]scored,len(r.nodes))
+	for i,node := range r.nodes{
+		all[i] = scored{node: node,score: mix64(r.nodeHashes[i]^keyHash)}
+	}
+	sort.Slice(all,func(i,j int) bool{
+		return all[i].score > all[j].score
+	})
+
+	n = min(n,len(all))
+	nodes := make([]string,n)
+	for i := 0; i < n; i++{
+		nodes[i] = all[i].node
+	}
+	return nodes
+}
+
+//indexOf 返回节点在nodes中的下标，不存在时返回-1
+func (r *Rendezvous) indexOf(node string) int{
+	idx := sort.SearchStrings(r.nodes,node)
+	if idx < len(r.nodes) && r.nodes[idx] == node{
+		return idx
+	}
+	return -1
+}
@@ -0,0 +1,147 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+//排空（drain）模式
+//滚动发布时直接Stop会让其他节点在感知到本节点下线之前继续转发请求，造成报错和大量未命中。
+//排空模式按以下顺序下线：
+//	1.健康检查状态改为NOT_SERVING，负载均衡器不再把新流量导入本节点
+//	2.从etcd注销，其他节点收到watch事件后把本节点从哈希环上移除
+//	3.继续处理正在进行的请求和其他节点转发来的请求，直到一段时间内没有新请求（说明其他节点已经更新了哈希环）
+//	4.可选：把本节点负责的缓存项推送给后继节点
+//	5.停止服务器
+
+//ErrDraining 节点已经在排空或已停止
+var ErrDraining = errors.New("server is already draining")
+
+//DrainOptions 排空选项
+type DrainOptions struct{
+	Handoff bool				//停止前是否把本节点负责的缓存项推送给后继节点
+	QuietPeriod time.Duration	//连续多长时间没有新请求时认为其他节点已经更新了哈希环
+	Timeout time.Duration		//排空的最长时间（不包括数据推送）
+}
+
+//1.Drain 让服务器进入排空模式，阻塞直到服务器停止
+func (s *Server) Drain(ctx context.Context,opts DrainOptions) error{
+	if !atomic.CompareAndSwapInt32(&s.draining,0,1){
+		return ErrDraining
+	}
+	if opts.QuietPeriod <= 0{
+		opts.QuietPeriod = s.opts.DrainQuietPeriod
+	}
+	if opts.Timeout <= 0{
+		opts.Timeout = s.opts.DrainTimeout
+	}
+	logrus.Infof("Server %s draining",s.addr)
+
+	//1.不再接收新流量
+	s.healthServer.SetServingStatus(s.svcName,healthpb.HealthCheckResponse_NOT_SERVING)
+	s.healthServer.SetServingStatus("",healthpb.HealthCheckResponse_NOT_SERVING)
+
+	//2.从etcd注销
+	s.deregister()
+
+	//3.等待其他节点更新哈希环
+	s.waitQuiet(ctx,opts.QuietPeriod,opts.Timeout)
+
+	//4.推送数据并停止
+	s.shutdown(opts.Handoff)
+	logrus.Infof("Server %s drained",s.addr)
+	return nil
+}
+
+//2.Draining 返回服务器是否处于排空模式
+func (s *Server) Draining() bool{
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+//3.waitQuiet 等待连续quiet时间内没有新请求且没有正在处理的请求，最多等待timeout
+func (s *Server) waitQuiet(ctx context.Context,quiet,timeout time.Duration){
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(quiet/4 + time.Millisecond)
+	defer ticker.Stop()
+
+	for{
+		last := time.Unix(0,atomic.LoadInt64(&s.lastRequest))
+		if atomic.LoadInt64(&s.inflight) == 0 && time.Since(last) >= quiet{
+			return
+		}
+		if time.Now().After(deadline){
+			logrus.Warnf("Server %s drain timed out with %d in-flight requests",s.addr,atomic.LoadInt64(&s.inflight))
+			return
+		}
+
+		select{
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//4.trackUnary 记录正在处理的请求数和最近一次请求的时间（一元RPC拦截器）
+func (s *Server) trackUnary(ctx context.Context,req interface{},info *grpc.UnaryServerInfo,handler grpc.UnaryHandler) (interface{},error){
+	if untracked(info.FullMethod){
+		return handler(ctx,req)
+	}
+	atomic.AddInt64(&s.inflight,1)
+	atomic.StoreInt64(&s.lastRequest,time.Now().UnixNano())
+	defer atomic.AddInt64(&s.inflight,-1)
+
+	return handler(ctx,req)
+}
+
+//5.trackStream 记录正在处理的请求数和最近一次请求的时间（流式RPC拦截器）
+func (s *Server) trackStream(srv interface{},ss grpc.ServerStream,info *grpc.StreamServerInfo,handler grpc.StreamHandler) error{
+	if untracked(info.FullMethod){
+		return handler(srv,ss)
+	}
+	atomic.AddInt64(&s.inflight,1)
+	atomic.StoreInt64(&s.lastRequest,time.Now().UnixNano())
+	defer atomic.AddInt64(&s.inflight,-1)
+
+	return handler(srv,ss)
+}
+
+//untracked 不计入排空的方法：健康检查的探测和Watch长连接、管理服务
+//它们不是缓存流量，计入后探测会不断刷新最近一次请求的时间，Watch会一直占用正在处理的请求数，排空只能等到超时
+func untracked(method string) bool{
+	return strings.HasPrefix(method,"/grpc.health.v1.Health/") || strings.HasPrefix(method,"/pb.CacheAdmin/")
+}
+
+//adminServer 实现CacheAdmin服务
+type adminServer struct{
+	pb.UnimplementedCacheAdminServer
+	srv *Server
+}
+
+//Drain 实现CacheAdmin服务的Drain方法
+//排空会等待所有请求结束，包括这次请求本身，因此在后台执行，立即返回
+func (a *adminServer) Drain(ctx context.Context,req *pb.DrainRequest) (*pb.DrainResponse,error){
+	if a.srv.Draining(){
+		return &pb.DrainResponse{Accepted: false},nil
+	}
+
+	opts := DrainOptions{
+		Handoff: req.Handoff,
+		Timeout: time.Duration(req.TimeoutMs)*time.Millisecond,
+	}
+	go func(){
+		if err := a.srv.Drain(context.Background(),opts); err != nil{
+			logrus.Warnf("Server %s drain failed: %v",a.srv.addr,err)
+		}
+	}()
+
+	return &pb.DrainResponse{Accepted: true},nil
+}
@@ -0,0 +1,65 @@
+package mycache
+
+import(
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDrainIgnoresHealthChecks(t *testing.T){
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"drain-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0),WithDrainTimeout(200*time.Millisecond,10*time.Second))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	conn,err := grpc.NewClient(addr,grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	health := healthpb.NewHealthClient(conn)
+
+	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//负载均衡器的Watch长连接
+	watch,err := health.Watch(ctx,&healthpb.HealthCheckRequest{Service: "drain-test"},grpc.WaitForReady(true))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _,err := watch.Recv(); err != nil{
+		t.Fatal(err)
+	}
+
+	//排空期间持续探测
+	go func(){
+		for ctx.Err() == nil{
+			health.Check(ctx,&healthpb.HealthCheckRequest{Service: "drain-test"})
+			time.Sleep(20*time.Millisecond)
+		}
+	}()
+	time.Sleep(100*time.Millisecond)
+
+	start := time.Now()
+	if err := srv.Drain(context.Background(),DrainOptions{}); err != nil{
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second{
+		t.Fatalf("drain should finish after the quiet period, took %v",elapsed)
+	}
+}
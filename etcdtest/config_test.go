@@ -0,0 +1,227 @@
+package etcdtest
+
+import(
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+//共享客户端与带Namespace的配置一起使用时，注册和发现都在前缀下进行
+func TestNamespaceWithSharedClient(t *testing.T){
+	cli := Start(t)
+	ctx := context.Background()
+	config := &registry.Config{Namespace: "/prod/",RequestTimeout: 3*time.Second}
+
+	d := registry.NewEtcdDiscovery(cli,config)
+	reg,err := d.Register("ns-test","127.0.0.1:9001")
+	if err != nil{
+		t.Fatal(err)
+	}
+	direct,err := registry.NewRegistration("ns-test","127.0.0.1:9002",registry.WithEtcdConfig(config),registry.WithEtcdClient(cli))
+	if err != nil{
+		t.Fatal(err)
+	}
+	stopCh := make(chan error)
+	defer func(){
+		close(stopCh)
+		<-reg.Done()
+		<-direct.Done()
+	}()
+	go reg.Run(stopCh)
+	go direct.Run(stopCh)
+
+	deadline := time.Now().Add(10*time.Second)
+	for{
+		nodes,err := d.List(ctx,"ns-test")
+		if err == nil && len(nodes) == 2{
+			break
+		}
+		if time.Now().After(deadline){
+			t.Fatalf("namespaced discovery did not list both nodes: %v, %v",nodes,err)
+		}
+		time.Sleep(10*time.Millisecond)
+	}
+
+	for _,addr := range []string{"127.0.0.1:9001","127.0.0.1:9002"}{
+		resp,err := cli.Get(ctx,"/prod/services/ns-test/"+addr)
+		if err != nil || len(resp.Kvs) != 1{
+			t.Fatalf("%s should be registered under the namespace: %v, %v",addr,resp,err)
+		}
+	}
+	if nodes,err := registry.NewEtcdDiscovery(cli,nil).List(ctx,"ns-test"); err != nil || len(nodes) != 0{
+		t.Fatalf("discovery without the namespace should not see the nodes: %v, %v",nodes,err)
+	}
+	if _,err := cli.Put(ctx,"plain","1"); err != nil{
+		t.Fatalf("the shared client must keep working without the prefix: %v",err)
+	}
+	if resp,err := cli.Get(ctx,"/prod/plain"); err != nil || len(resp.Kvs) != 0{
+		t.Fatalf("the shared client was modified in place: %v, %v",resp,err)
+	}
+}
+
+func TestConfigAuth(t *testing.T){
+	endpoint := StartServer(t,nil)
+	ctx := context.Background()
+
+	root,err := clientv3.New(clientv3.Config{Endpoints: []string{endpoint},DialTimeout: 5*time.Second})
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if _,err := root.UserAdd(ctx,"root","secret"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := root.UserGrantRole(ctx,"root","root"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := root.AuthEnable(ctx); err != nil{
+		t.Fatal(err)
+	}
+
+	cli,err := (&registry.Config{Endpoints: []string{endpoint},DialTimeout: 5*time.Second,Username: "root",Password: "secret"}).NewClient()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _,err := cli.Put(ctx,"auth","1"); err != nil{
+		t.Fatalf("authenticated put failed: %v",err)
+	}
+
+	if anon,err := (&registry.Config{Endpoints: []string{endpoint},DialTimeout: 5*time.Second}).NewClient(); err == nil{
+		defer anon.Close()
+		if _,err := anon.Put(ctx,"auth","2"); err == nil{
+			t.Fatal("put without credentials should be rejected")
+		}
+	}
+	if wrong,err := (&registry.Config{Endpoints: []string{endpoint},DialTimeout: 5*time.Second,Username: "root",Password: "wrong"}).NewClient(); err == nil{
+		defer wrong.Close()
+		if _,err := wrong.Put(ctx,"auth","3"); err == nil{
+			t.Fatal("put with a wrong password should be rejected")
+		}
+	}
+}
+
+func TestConfigTLS(t *testing.T){
+	dir := t.TempDir()
+	ca := newCA(t,dir)
+	ca.issue(t,dir,"server",2,net.ParseIP("127.0.0.1"))
+	ca.issue(t,dir,"client",3)
+
+	endpoint := StartServer(t,func(cfg *embed.Config){
+		for _,urls := range [][]url.URL{cfg.ListenClientUrls,cfg.AdvertiseClientUrls}{
+			urls[0].Scheme = "https"
+		}
+		cfg.ClientTLSInfo = transport.TLSInfo{
+			CertFile: filepath.Join(dir,"server.pem"),
+			KeyFile: filepath.Join(dir,"server-key.pem"),
+			TrustedCAFile: filepath.Join(dir,"ca.pem"),
+			ClientCertAuth: true,
+		}
+	})
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+
+	config := &registry.Config{
+		Endpoints: []string{endpoint},
+		DialTimeout: 5*time.Second,
+		CertFile: filepath.Join(dir,"client.pem"),
+		KeyFile: filepath.Join(dir,"client-key.pem"),
+		CAFile: filepath.Join(dir,"ca.pem"),
+	}
+	cli,err := config.NewClient()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _,err := cli.Put(ctx,"tls","1"); err != nil{
+		t.Fatalf("mTLS put failed: %v",err)
+	}
+
+	//没有客户端证书时服务端拒绝连接
+	noCert := *config
+	noCert.CertFile,noCert.KeyFile = "",""
+	if anon,err := noCert.NewClient(); err == nil{
+		defer anon.Close()
+		if _,err := anon.Put(ctx,"tls","2"); err == nil{
+			t.Fatal("put without a client certificate should be rejected")
+		}
+	}
+
+	bad := *config
+	bad.CAFile = filepath.Join(dir,"client.pem")//不是签发服务端证书的CA
+	if untrusted,err := bad.NewClient(); err == nil{
+		defer untrusted.Close()
+		if _,err := untrusted.Put(ctx,"tls","3"); err == nil{
+			t.Fatal("a client that does not trust the server CA should fail")
+		}
+	}
+}
+
+//testCA 测试用的CA
+type testCA struct{
+	cert *x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T,dir string) *testCA{
+	key,_ := ecdsa.GenerateKey(elliptic.P256(),rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "etcdtest-ca"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		KeyUsage: x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der,err := x509.CreateCertificate(rand.Reader,tmpl,tmpl,&key.PublicKey,key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	cert,_ := x509.ParseCertificate(der)
+	writePEM(t,filepath.Join(dir,"ca.pem"),"CERTIFICATE",der)
+	return &testCA{cert: cert,key: key}
+}
+
+//issue 签发证书，写入dir下的name.pem和name-key.pem
+func (ca *testCA) issue(t *testing.T,dir,name string,serial int64,ips ...net.IP){
+	key,_ := ecdsa.GenerateKey(elliptic.P256(),rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,x509.ExtKeyUsageClientAuth},
+		IPAddresses: ips,
+	}
+	der,err := x509.CreateCertificate(rand.Reader,tmpl,ca.cert,&key.PublicKey,ca.key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	keyDER,_ := x509.MarshalECPrivateKey(key)
+	writePEM(t,filepath.Join(dir,name+".pem"),"CERTIFICATE",der)
+	writePEM(t,filepath.Join(dir,name+"-key.pem"),"EC PRIVATE KEY",keyDER)
+}
+
+func writePEM(t *testing.T,path,typ string,der []byte){
+	if err := os.WriteFile(path,pem.EncodeToMemory(&pem.Block{Type: typ,Bytes: der}),0600); err != nil{
+		t.Fatal(err)
+	}
+}
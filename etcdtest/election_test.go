@@ -0,0 +1,82 @@
+package etcdtest
+
+import(
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+//electionTTL 选举租约的TTL，与registry中的一致
+const electionTTL = 10*time.Second
+
+func TestElectionHandover(t *testing.T){
+	cli := Start(t)
+
+	type candidate struct{
+		e *registry.Election
+		stop chan error
+	}
+	start := func(id string) candidate{
+		c := candidate{e: registry.NewElection(cli,"election-test",id),stop: make(chan error)}
+		go c.e.Run(c.stop)
+		return c
+	}
+	waitLeader := func(id string,e *registry.Election){
+		t.Helper()
+		deadline := time.Now().Add(10*time.Second)
+		for !e.IsLeader(){
+			if time.Now().After(deadline){
+				t.Fatalf("%s did not become leader",id)
+			}
+			time.Sleep(10*time.Millisecond)
+		}
+	}
+
+	a := start("a")
+	waitLeader("a",a.e)
+	first := a.e.Token()
+
+	changes := make(chan bool,4)
+	b := registry.NewElection(cli,"election-test","b")
+	b.OnChange(func(leader bool,token int64){ changes <- leader })
+	bStop := make(chan error)
+	go b.Run(bStop)
+	defer func(){
+		close(bStop)
+		<-b.Done()
+	}()
+
+	time.Sleep(200*time.Millisecond)
+	if b.IsLeader(){
+		t.Fatal("only one candidate can be leader")
+	}
+	if leader,err := a.e.Leader(context.Background()); err != nil || leader != "a"{
+		t.Fatalf("expected a to be the leader, got %q, %v",leader,err)
+	}
+
+	//a停止后先失去leader身份，再放弃，b不需要等租约过期就能接替
+	stopped := time.Now()
+	close(a.stop)
+	<-a.e.Done()
+	if a.e.IsLeader() || a.e.Token() != 0{
+		t.Fatal("a should have given up leadership")
+	}
+	waitLeader("b",b)
+	if elapsed := time.Since(stopped); elapsed >= electionTTL{
+		t.Fatalf("b should take over after a resigns, took %v",elapsed)
+	}
+	if b.Token() <= first{
+		t.Fatalf("fencing token should increase across terms: %d -> %d",first,b.Token())
+	}
+	if leader,_ := b.Leader(context.Background()); leader != "b"{
+		t.Fatalf("expected b to be the leader, got %q",leader)
+	}
+	if _,ok := a.e.Fence(); ok{
+		t.Fatal("a former leader should not be able to fence writes")
+	}
+	if leader := <-changes; !leader || len(changes) != 0{
+		t.Fatal("b should have been notified once that it became leader")
+	}
+}
@@ -0,0 +1,68 @@
+//Package etcdtest 在测试进程内启动单节点etcd，用于依赖etcd的集成测试
+//etcd服务端的依赖很多，因此放在单独的模块中，主模块不依赖它：
+//	cd etcdtest && go test ./...
+package etcdtest
+
+import(
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+//Start 启动一个单节点etcd并返回连接它的客户端，测试结束时关闭
+func Start(t testing.TB) *clientv3.Client{
+	t.Helper()
+	cli,err := clientv3.New(clientv3.Config{
+		Endpoints: []string{StartServer(t,nil)},
+		DialTimeout: 5*time.Second,
+	})
+	if err != nil{
+		t.Fatalf("failed to connect to etcd: %v",err)
+	}
+	t.Cleanup(func(){ cli.Close() })
+	return cli
+}
+
+//StartServer 启动一个单节点etcd并返回客户端地址，configure不为nil时可以在启动前修改配置
+func StartServer(t testing.TB,configure func(cfg *embed.Config)) string{
+	t.Helper()
+
+	cfg := embed.NewConfig()
+	cfg.Name = "etcdtest"
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	clientURL,peerURL := freeURL(t),freeURL(t)
+	cfg.ListenClientUrls,cfg.AdvertiseClientUrls = []url.URL{clientURL},[]url.URL{clientURL}
+	cfg.ListenPeerUrls,cfg.AdvertisePeerUrls = []url.URL{peerURL},[]url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	if configure != nil{
+		configure(cfg)
+	}
+
+	e,err := embed.StartEtcd(cfg)
+	if err != nil{
+		t.Fatalf("failed to start etcd: %v",err)
+	}
+	t.Cleanup(e.Close)
+	select{
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10*time.Second):
+		t.Fatal("etcd did not become ready")
+	}
+	return clientURL.Host
+}
+
+//freeURL 返回本机一个空闲端口的地址
+func freeURL(t testing.TB) url.URL{
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return url.URL{Scheme: "http",Host: lis.Addr().String()}
+}
@@ -0,0 +1,84 @@
+package etcdtest
+
+import(
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestRegistrationRecoversRevokedLease(t *testing.T){
+	cli := Start(t)
+	r,err := registry.NewRegistration("registration-test","127.0.0.1:8001",registry.WithEtcdClient(cli))
+	if err != nil{
+		t.Fatal(err)
+	}
+	states := make(chan registry.State,16)
+	r.OnStateChange(func(s registry.State){ states <- s })
+
+	stopCh := make(chan error)
+	go r.Run(stopCh)
+
+	const key = "/services/registration-test/127.0.0.1:8001"
+	ctx := context.Background()
+	waitKey := func() *clientv3.GetResponse{
+		t.Helper()
+		deadline := time.Now().Add(10*time.Second)
+		for{
+			resp,err := cli.Get(ctx,key)
+			if err == nil && len(resp.Kvs) > 0 && r.State() == registry.StateRegistered{
+				return resp
+			}
+			if time.Now().After(deadline){
+				t.Fatalf("%s was not registered, state %v",key,r.State())
+			}
+			time.Sleep(10*time.Millisecond)
+		}
+	}
+
+	first := waitKey()
+	lease := clientv3.LeaseID(first.Kvs[0].Lease)
+
+	//租约被撤销（如etcd侧清理），key随之删除，注册管理器应重新注册
+	if _,err := cli.Revoke(ctx,lease); err != nil{
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10*time.Second)
+	for r.Reregistrations() == 0{
+		if time.Now().After(deadline){
+			t.Fatal("registration was not restored after the lease was revoked")
+		}
+		time.Sleep(10*time.Millisecond)
+	}
+	again := waitKey()
+	if again.Kvs[0].Lease == int64(lease){
+		t.Fatal("re-registration should use a new lease")
+	}
+	if node,err := registry.ParseNode(again.Kvs[0].Value); err != nil || node.Addr != "127.0.0.1:8001"{
+		t.Fatalf("unexpected registration %q, %v",again.Kvs[0].Value,err)
+	}
+
+	//停止时撤销租约，key立即删除
+	close(stopCh)
+	<-r.Done()
+	resp,err := cli.Get(ctx,key)
+	if err != nil || len(resp.Kvs) != 0{
+		t.Fatalf("key should be removed after stop: %v, %v",resp,err)
+	}
+
+	var seen []registry.State
+	for len(states) > 0{
+		seen = append(seen,<-states)
+	}
+	want := []registry.State{registry.StateRegistered,registry.StateLost,registry.StateRegistering,registry.StateRegistered,registry.StateStopped}
+	if len(seen) != len(want){
+		t.Fatalf("expected states %v, got %v",want,seen)
+	}
+	for i := range want{
+		if seen[i] != want[i]{
+			t.Fatalf("expected states %v, got %v",want,seen)
+		}
+	}
+}
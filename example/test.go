@@ -8,6 +8,7 @@ import (
 	"time"
 
 	lcache "github.com/Rampage-cd/DistributedCache"
+	"github.com/Rampage-cd/DistributedCache/registry"
 	//lcache是导入包时起的别名
 )
 
@@ -20,17 +21,33 @@ func main(){
 	addr := fmt.Sprintf(":%d",*port)
 	log.Printf("[节点%s] 启动，地址：%s",*nodeID,addr)
 
+	//服务器和节点选择器共用一个etcd客户端
+	etcdConfig := &registry.Config{
+		Endpoints: []string{"localhost:2379"},
+		DialTimeout: 5*time.Second,
+		RequestTimeout: 3*time.Second,
+	}
+	etcdCli,err := etcdConfig.NewClient()
+	if err != nil{
+		log.Fatal("创建etcd客户端失败：",err)
+	}
+	defer etcdCli.Close()
+
 	//创建节点
 	node,err := lcache.NewServer(addr,"my-cache",
-		lcache.WithEtcdEndpoints([]string{"localhost:2379"}),
-		lcache.WithDialTimeout(5*time.Second),
+		lcache.WithEtcdConfig(etcdConfig),
+		lcache.WithEtcdClient(etcdCli),
 	)//node是Server结构体类型的
 	if err != nil{
 		log.Fatal("创建节点失败：",err)
 	}
 
 	//创建节点选择器
-	picker,err := lcache.NewClientPicker(addr)
+	picker,err := lcache.NewClientPicker(addr,
+		lcache.WithDiscoveryConfig(etcdConfig),
+		lcache.WithDiscoveryClient(etcdCli),
+		lcache.WithLeader(node),//只由leader发布拓扑
+	)
 	if err != nil{
 		log.Fatal("创建节点选择器失败：",err)
 	}//picker是ClientPicker结构体类型的,实现了PeerPicker接口
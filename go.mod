@@ -9,6 +9,7 @@ require (
 	go.etcd.io/etcd/client/v3 v3.6.7
 	google.golang.org/grpc v1.71.1
 	google.golang.org/protobuf v1.36.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -10,6 +10,7 @@ import(
 
 	"github.com/sirupsen/logrus"
 	"github.com/Rampage-cd/DistributedCache/singleflight"
+	"github.com/Rampage-cd/DistributedCache/tracing"
 )
 
 //定义常见的错误
@@ -38,8 +39,39 @@ func (f GetterFunc) Get(ctx context.Context,key string) ([]byte,error){
 var(
 	groupsMu sync.RWMutex
 	groups = make(map[string]*Group)
+
+	groupWatchersMu sync.Mutex
+	groupWatchers = make(map[int]func())//缓存组创建或关闭时的回调
+	nextGroupWatcher int
 )
 
+//watchGroups 缓存组创建或关闭时调用fn（不持有groupsMu，fn不能阻塞），返回取消监听的函数
+func watchGroups(fn func()) func(){
+	groupWatchersMu.Lock()
+	defer groupWatchersMu.Unlock()
+	id := nextGroupWatcher
+	nextGroupWatcher++
+	groupWatchers[id] = fn
+	return func(){
+		groupWatchersMu.Lock()
+		defer groupWatchersMu.Unlock()
+		delete(groupWatchers,id)
+	}
+}
+
+//notifyGroupsChanged 通知所有监听者缓存组发生了变化
+func notifyGroupsChanged(){
+	groupWatchersMu.Lock()
+	fns := make([]func(),0,len(groupWatchers))
+	for _,fn := range groupWatchers{
+		fns = append(fns,fn)
+	}
+	groupWatchersMu.Unlock()
+	for _,fn := range fns{
+		fn()
+	}
+}
+
 //缓存命名空间结构体
 type Group struct{
 	name		string
@@ -50,6 +82,18 @@ type Group struct{
 	expiration	time.Duration			//缓存过期时间，0表示永不过期
 	closed		int32					//原子变量，标记组是否关闭
 	stats 		groupStats				//统计信息
+	stopCh		chan struct{}			//关闭信号，用于停止后台协程
+	antiEntropyInterval time.Duration	//反熵间隔，0表示不开启
+	invalidationQueueSize int			//失效广播每个节点的队列上限，0表示不开启
+	invalidator	*invalidationBus		//失效总线
+	setter		Setter					//写入数据源的回调（write-through/write-behind模式）
+	deleter		Deleter					//从数据源删除的回调，为nil时删除不会同步到数据源
+	writeMode	WriteMode				//写入数据源的模式
+	writeBehindOpts WriteBehindOptions	//write-behind配置
+	writeBehind	*writeBehindQueue		//write-behind队列
+	quota		*groupQuota				//限流和字节配额，为nil时不限制
+	hotKeyOpts	HotKeyOptions			//热点key检测配置
+	hotKeys		*hotKeyTracker			//热点key跟踪器，为nil时不检测
 }
 
 //统计信息结构体
@@ -62,6 +106,27 @@ type groupStats struct{
 	loaderHits		int64//从加载器获取的成功和失败次数
 	loaderErrors	int64
 	loadDuration	int64//加载总耗时
+	aeRounds		int64//反熵轮数，发现的不一致缓存项数，修复的缓存项数以及失败次数
+	aeDivergent		int64
+	aeRepaired		int64
+	aeErrors		int64
+	migratedIn		int64//迁移进来的缓存项数，双归属窗口内从原主节点命中的次数，以及推送给后继节点的缓存项数
+	handoffHits		int64
+	handoffOut		int64
+	invPublished	int64//广播的失效次数，送达的key数，重试次数，因队列满丢弃的key数，收到的key数
+	invDelivered	int64
+	invRetries		int64
+	invDropped		int64
+	invReceived		int64
+	invMaxLag		int64//失效通知从入队到送达的最大延迟
+	wbQueued		int64//write-behind入队次数，合并次数，成功写入数据源的次数，重试次数，重试用完的次数，重新入队的次数以及最终放弃的次数
+	wbCoalesced		int64
+	wbFlushed		int64
+	wbRetries		int64
+	wbFailed		int64
+	wbRequeued		int64
+	wbDeadLetters	int64
+	epochMismatches	int64//收到的请求中哈希环纪元与本节点不一致的次数
 }
 
 //定义Group的配置选项
@@ -92,7 +157,53 @@ func WithCacheOptions(opts CacheOptions) GroupOption{
 	}
 }
 
-//4.创建一个新的Group实例
+//4.开启副本之间的反熵（需要PeerPicker支持多副本）
+func WithAntiEntropy(interval time.Duration) GroupOption{
+	return func(g *Group){
+		g.antiEntropyInterval = interval
+	}
+}
+
+//5.设置失效广播每个节点的队列上限，0表示不开启失效广播
+func WithInvalidation(queueSize int) GroupOption{
+	return func(g *Group){
+		g.invalidationQueueSize = queueSize
+	}
+}
+
+//6.开启write-through：Set/Delete先同步写数据源，成功后才更新缓存
+func WithWriteThrough(setter Setter,deleter Deleter) GroupOption{
+	if setter == nil{
+		panic("nil Setter")
+	}
+	return func(g *Group){
+		g.setter = setter
+		g.deleter = deleter
+		g.writeMode = WriteThrough
+	}
+}
+
+//7.开启write-behind：Set/Delete更新缓存后入队，后台异步写数据源
+func WithWriteBehind(setter Setter,deleter Deleter,opts WriteBehindOptions) GroupOption{
+	if setter == nil{
+		panic("nil Setter")
+	}
+	return func(g *Group){
+		g.setter = setter
+		g.deleter = deleter
+		g.writeMode = WriteBehind
+		g.writeBehindOpts = opts
+	}
+}
+
+//8.设置缓存组和组内各调用方的请求速率限制和字节配额
+func WithQuota(q GroupQuota) GroupOption{
+	return func(g *Group){
+		g.quota = newGroupQuota(q)
+	}
+}
+
+//9.创建一个新的Group实例
 func NewGroup(name string,cacheBytes int64,getter Getter,opts ...GroupOption) *Group{
 	if getter == nil{
 		panic("nil Getter")
@@ -107,23 +218,41 @@ func NewGroup(name string,cacheBytes int64,getter Getter,opts ...GroupOption) *G
 		getter:		getter,
 		mainCache: 	NewCache(cacheOpts),
 		loader:		&singleflight.Group{},
+		stopCh:		make(chan struct{}),
+		invalidationQueueSize: defaultInvalidationQueueSize,
+		hotKeyOpts:	DefaultHotKeyOptions,
 	}
 
 	for _,opt := range opts{//opts实际上是多个匿名函数的切片
 		opt(g)//调用匿名函数，闭包生效
 	}
 
+	if g.antiEntropyInterval > 0{
+		go g.antiEntropyLoop()
+	}
+	if g.invalidationQueueSize > 0{
+		g.invalidator = newInvalidationBus(g,g.invalidationQueueSize)
+	}
+	if g.writeMode == WriteBehind{
+		g.writeBehind = newWriteBehindQueue(g,g.writeBehindOpts)
+	}
+	if g.hotKeyOpts.TopK > 0{
+		g.hotKeys = newHotKeyTracker(g.hotKeyOpts)
+	}
+	if g.peers != nil{
+		go g.pullOwnedRanges()
+	}
+
 	//注册到全局映射
 	groupsMu.Lock()
-	defer groupsMu.Unlock()
-
 	if _,exists := groups[name]; exists{
 		logrus.Warnf("Group with name %s already exists, will be replaced",name)
 	}
-
 	groups[name] = g
-	logrus.Infof("Created cache group [%s] with cacheBytes=%d,expiration=%v",name,cacheBytes,g.expiration)
+	groupsMu.Unlock()
+	notifyGroupsChanged()
 
+	logrus.Infof("Created cache group [%s] with cacheBytes=%d,expiration=%v",name,cacheBytes,g.expiration)
 	return g
 }
 
@@ -136,7 +265,11 @@ func GetGroup(name string) *Group{
 
 //绑定方法
 //1.Get从缓存获取数据
-func (g *Group) Get(ctx context.Context,key string) (ByteView,error){
+func (g *Group) Get(ctx context.Context,key string) (view ByteView,err error){
+	defer observeGroupOp(g.name,"get",time.Now(),&err)
+	ctx,span := startSpan(ctx,"mycache.Group.Get",tracing.SpanKindInternal,"mycache.group",g.name,"mycache.key",key)
+	defer endSpan(span,&err)
+
 	//检查组是否已经关闭，键是否为空
 	if atomic.LoadInt32(&g.closed) == 1{
 		return ByteView{}, ErrGroupClosed
@@ -146,8 +279,19 @@ func (g *Group) Get(ctx context.Context,key string) (ByteView,error){
 		return ByteView{}, ErrKeyRequired
 	}
 
+	if err := g.admit(ctx); err != nil{
+		return ByteView{},err
+	}
+
+	if g.hotKeys != nil{
+		g.hotKeys.record(key)
+	}
+
 	//从本地缓存获取
+	_,lookup := startSpan(ctx,"mycache.cache.lookup",tracing.SpanKindInternal)
 	view, ok := g.mainCache.Get(ctx,key)
+	lookup.SetAttribute("mycache.hit",ok)
+	lookup.End()
 	if ok{
 		atomic.AddInt64(&g.stats.localHits,1)
 		return view,nil
@@ -161,11 +305,17 @@ func (g *Group) Get(ctx context.Context,key string) (ByteView,error){
 
 //2.load加载数据
 func (g *Group) load(ctx context.Context,key string) (value ByteView,err error){
+	ctx,span := startSpan(ctx,"mycache.Group.load",tracing.SpanKindInternal)
+	defer endSpan(span,&err)
+
 	//使用singleflight确保并发请求只加载一次
 	startTime := time.Now()
+	shared := true//是否等待了其他请求的加载结果
 	viewi,err := g.loader.Do(key, func() (interface{}, error) {
+		shared = false
 		return g.loadData(ctx,key)
 	})
+	span.SetAttribute("mycache.singleflight.shared",shared)
 
 	//记录加载时间
 	loadDuration := time.Since(startTime).Nanoseconds()
@@ -192,8 +342,22 @@ func (g *Group) load(ctx context.Context,key string) (value ByteView,err error){
 //3.实际加载数据的方法
 func (g *Group) loadData(ctx context.Context,key string) (value ByteView,err error){
 	//尝试从远程节点获取
+	//其他节点转发过来的请求不再转发，避免节点之间的哈希环或负载不一致时来回转发
+	isPeerRequest := ctx.Value("from_peer") != nil
 	if g.peers != nil{
-		peer,ok,isSelf := g.peers.PickPeer(key)
+		var peer Peer
+		var ok,isSelf bool
+		if isPeerRequest{
+			ok,isSelf = true,true
+		}else{
+			peer,ok,isSelf = g.peers.PickPeer(ctx,key)
+			if ok{
+				defer g.releasePeer(peer)
+			}
+			if ok && !isSelf && !g.peerServesGroup(peer){
+				ok = false//对端没有提供这个缓存组，直接从数据源加载
+			}
+		}
 		if ok && !isSelf{
 			value,err := g.getFromPeer(ctx,peer,key)
 			if err == nil{
@@ -204,10 +368,20 @@ func (g *Group) loadData(ctx context.Context,key string) (value ByteView,err err
 			atomic.AddInt64(&g.stats.peerMisses,1)
 			logrus.Warnf("[mycache] failed to get from peer: %v",err)
 		}
+
+		//本节点刚加入集群时，先去原主节点查询，避免迁移完成前的请求全部打到数据源
+		if ok && isSelf{
+			if value,ok := g.peekPreviousOwner(ctx,key); ok{
+				return value,nil
+			}
+		}
 	}
 
 	//从数据源加载
-	bytes,err := g.getter.Get(ctx,key)
+	getterCtx,span := startSpan(ctx,"mycache.Getter.Get",tracing.SpanKindInternal)
+	bytes,err := g.getter.Get(getterCtx,key)
+	span.RecordError(err)
+	span.End()
 	if err != nil{
 		return ByteView{},fmt.Errorf("failed to get data: %w",err)
 	}
@@ -218,7 +392,7 @@ func (g *Group) loadData(ctx context.Context,key string) (value ByteView,err err
 
 //4.getFromPeer从其他节点获取数据
 func (g *Group) getFromPeer(ctx context.Context,peer Peer,key string) (ByteView,error){
-	bytes,err := peer.Get(g.name,key)
+	bytes,err := peer.Get(ctx,g.name,key)
 	if err != nil{
 		return ByteView{},fmt.Errorf("failed to get from peer: %w",err)
 	}
@@ -226,7 +400,11 @@ func (g *Group) getFromPeer(ctx context.Context,peer Peer,key string) (ByteView,
 }
 
 //5.Set设置缓存值
-func (g *Group) Set(ctx context.Context,key string,value []byte) error{
+func (g *Group) Set(ctx context.Context,key string,value []byte) (err error){
+	defer observeGroupOp(g.name,"set",time.Now(),&err)
+	ctx,span := startSpan(ctx,"mycache.Group.Set",tracing.SpanKindInternal,"mycache.group",g.name,"mycache.key",key)
+	defer endSpan(span,&err)
+
 	//检查缓存组是否关闭，键是否为空，值是否为空
 	if atomic.LoadInt32(&g.closed) == 1 {
 		return ErrGroupClosed
@@ -242,6 +420,25 @@ func (g *Group) Set(ctx context.Context,key string,value []byte) error{
 	//检查是否是从其他节点同步过来的请求
 	isPeerRequest := ctx.Value("from_peer") != nil
 
+	if err := g.admit(ctx); err != nil{
+		return err
+	}
+	undo := func(){}
+	if g.quota != nil && !fromVerifiedPeer(ctx){
+		var err error
+		if undo,err = g.quota.reserve(callerName(ctx),key,int64(len(key)+len(value)),g.mainCache.Contains); err != nil{
+			return err
+		}
+	}
+
+	//写入数据源(同步过来的请求已经由发起写操作的节点写过了)
+	if !isPeerRequest{
+		if err := g.persistSet(ctx,key,value); err != nil{
+			undo()//没有写入的值不占用配额
+			return fmt.Errorf("failed to persist data: %w",err)
+		}
+	}
+
 	//创建缓存视图
 	view := ByteView{b: cloneBytes(value)}
 
@@ -255,6 +452,7 @@ func (g *Group) Set(ctx context.Context,key string,value []byte) error{
 	//如果不是从其他节点同步过来的请求，且启用了分布式模式，同步到其他节点
 	if !isPeerRequest && g.peers != nil{
 		go g.syncToPeers(ctx,"set",key,value)
+		g.publishInvalidation(key)
 	}
 
 	return nil
@@ -266,30 +464,89 @@ func (g *Group) syncToPeers(ctx context.Context,op string,key string,value []byt
 		return 
 	}
 
-	//选择对等节点
-	peer,ok,isSelf := g.peers.PickPeer(key)
-	if !ok || isSelf{
-		return 
+	//选择对等节点(开启多副本时同步到除本节点外的所有副本)
+	var targets []Peer
+	if rp,ok := g.peers.(ReplicaPicker); ok{
+		for _,addr := range rp.Replicas(key){
+			if addr == rp.Self(){
+				continue
+			}
+			if peer,ok := rp.GetPeer(addr); ok{
+				targets = append(targets,peer)
+			}
+		}
+	}else{
+		peer,ok,isSelf := g.peers.PickPeer(ctx,key)
+		if !ok{
+			return
+		}
+		defer g.releasePeer(peer)
+		if isSelf{
+			return 
+		}
+		targets = append(targets,peer)
+	}
+
+	//同步是异步进行的，不随原请求取消，但保留原请求ctx中的值，每个节点使用默认超时
+	syncCtx := context.WithValue(context.WithoutCancel(ctx),"from_peer",true)
+
+	for _,peer := range targets{
+		var err error
+		switch op{
+		case "set":
+			err = peer.Set(syncCtx,g.name,key,value)
+		case "delete":
+			_,err = peer.Delete(syncCtx,g.name,key)
+		}
+
+		if err != nil{
+			logrus.Errorf("[mycache] failed to sync %s to peer: %v",op,err)
+		}
 	}
+}
 
-	//选择同步请求上下文
-	syncCtx := context.WithValue(context.Background(),"from_peer",true)
+//admit 检查调用方和缓存组的请求速率，认证过的节点转发和同步过来的请求不限制
+func (g *Group) admit(ctx context.Context) error{
+	if g.quota == nil || fromVerifiedPeer(ctx){
+		return nil
+	}
+	return g.quota.admit(callerName(ctx))
+}
 
-	var err error
-	switch op{
-	case "set":
-		err = peer.Set(syncCtx,g.name,key,value)
-	case "delete":
-		_,err = peer.Delete(g.name,key)
+//peerServesGroup 根据节点的注册信息判断peer是否提供本缓存组
+func (g *Group) peerServesGroup(peer Peer) bool{
+	np,ok := g.peers.(NodeInfoPicker)
+	if !ok{
+		return true
+	}
+	ap,ok := peer.(interface{ Addr() string })
+	if !ok{
+		return true
 	}
+	node,ok := np.NodeInfo(ap.Addr())
+	return !ok || node.ServesGroup(g.name)
+}
 
-	if err != nil{
-		logrus.Errorf("[mycache] failed to sync %s to peer: %v",op,err)
+//releasePeer 释放PickPeer选中的节点的负载（PeerPicker按负载选择节点时）
+func (g *Group) releasePeer(peer Peer){
+	if lr,ok := g.peers.(LoadReleaser); ok{
+		lr.Release(peer)
+	}
+}
+
+//publishInvalidation 通知其他节点删除key的旧副本
+func (g *Group) publishInvalidation(key string){
+	if g.invalidator != nil{
+		g.invalidator.publish(key)
 	}
 }
 
 //7.Delete删除缓存值
-func (g *Group) Delete(ctx context.Context,key string) error{
+func (g *Group) Delete(ctx context.Context,key string) (err error){
+	defer observeGroupOp(g.name,"delete",time.Now(),&err)
+	ctx,span := startSpan(ctx,"mycache.Group.Delete",tracing.SpanKindInternal,"mycache.group",g.name,"mycache.key",key)
+	defer endSpan(span,&err)
+
 	//检查组是否已经关闭
 	if atomic.LoadInt32(&g.closed) == 1{
 		return ErrGroupClosed
@@ -299,15 +556,30 @@ func (g *Group) Delete(ctx context.Context,key string) error{
 		return ErrKeyRequired
 	}
 
-	//从本地缓存删除
-	g.mainCache.Delete(key)
-
 	//检查是否是从其他节点同步过来的请求
 	isPeerRequest := ctx.Value("from_peer") != nil
 
+	if err := g.admit(ctx); err != nil{
+		return err
+	}
+
+	//从数据源删除
+	if !isPeerRequest{
+		if err := g.persistDelete(ctx,key); err != nil{
+			return fmt.Errorf("failed to persist delete: %w",err)
+		}
+	}
+
+	//从本地缓存删除
+	g.mainCache.Delete(key)
+	if g.quota != nil{
+		g.quota.forget(key)
+	}
+
 	//如果不是从其他节点同步过来的请求，且开启了分布式模式，则同步到其他节点
 	if !isPeerRequest && g.peers != nil{
 		go g.syncToPeers(ctx,"delete",key,nil)
+		g.publishInvalidation(key)
 	}
 
 	return nil
@@ -331,6 +603,14 @@ func (g *Group) Close() error {
 		return nil
 	}
 
+	// 停止后台协程
+	close(g.stopCh)
+
+	// 把write-behind队列中剩余的数据刷到数据源
+	if g.writeBehind != nil {
+		g.writeBehind.close()
+	}
+
 	// 关闭本地缓存
 	if g.mainCache != nil {
 		g.mainCache.Close()
@@ -340,6 +620,7 @@ func (g *Group) Close() error {
 	groupsMu.Lock()
 	delete(groups, g.name)
 	groupsMu.Unlock()
+	notifyGroupsChanged()
 
 	logrus.Infof("[KamaCache] closed cache group [%s]", g.name)
 	return nil
@@ -352,6 +633,8 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 	}
 	g.peers = peers
 	logrus.Infof("[MyCache] registered peers for group [%s]", g.name)
+
+	go g.pullOwnedRanges()
 }
 
 // Stats 返回缓存统计信息
@@ -367,6 +650,70 @@ func (g *Group) Stats() map[string]interface{} {
 		"peer_misses":   atomic.LoadInt64(&g.stats.peerMisses),
 		"loader_hits":   atomic.LoadInt64(&g.stats.loaderHits),
 		"loader_errors": atomic.LoadInt64(&g.stats.loaderErrors),
+		"ae_rounds":     atomic.LoadInt64(&g.stats.aeRounds),
+		"ae_divergent":  atomic.LoadInt64(&g.stats.aeDivergent),
+		"ae_repaired":   atomic.LoadInt64(&g.stats.aeRepaired),
+		"ae_errors":     atomic.LoadInt64(&g.stats.aeErrors),
+		"migrated_in":   atomic.LoadInt64(&g.stats.migratedIn),
+		"handoff_hits":  atomic.LoadInt64(&g.stats.handoffHits),
+		"handoff_out":   atomic.LoadInt64(&g.stats.handoffOut),
+		"invalidations_published": atomic.LoadInt64(&g.stats.invPublished),
+		"invalidations_delivered": atomic.LoadInt64(&g.stats.invDelivered),
+		"invalidations_retries":   atomic.LoadInt64(&g.stats.invRetries),
+		"invalidations_dropped":   atomic.LoadInt64(&g.stats.invDropped),
+		"invalidations_received":  atomic.LoadInt64(&g.stats.invReceived),
+		"invalidation_max_lag_ms": float64(atomic.LoadInt64(&g.stats.invMaxLag)) / float64(time.Millisecond),
+		"write_mode":              g.writeMode,
+		"epoch_mismatches":        atomic.LoadInt64(&g.stats.epochMismatches),
+	}
+
+	// 哈希环纪元
+	if tp, ok := g.peers.(TopologyPicker); ok {
+		stats["ring_epoch"] = tp.Epoch()
+	}
+
+	// 各节点的断路器和重试预算
+	if sp, ok := g.peers.(PeerStatsPicker); ok {
+		stats["peers"] = sp.PeerStats()
+	}
+
+	// write-behind队列情况
+	if g.writeBehind != nil {
+		stats["write_behind_pending"] = g.writeBehind.len()
+		stats["write_behind_queued"] = atomic.LoadInt64(&g.stats.wbQueued)
+		stats["write_behind_coalesced"] = atomic.LoadInt64(&g.stats.wbCoalesced)
+		stats["write_behind_flushed"] = atomic.LoadInt64(&g.stats.wbFlushed)
+		stats["write_behind_retries"] = atomic.LoadInt64(&g.stats.wbRetries)
+		stats["write_behind_failed"] = atomic.LoadInt64(&g.stats.wbFailed)
+		stats["write_behind_requeued"] = atomic.LoadInt64(&g.stats.wbRequeued)
+		stats["write_behind_dead_letters"] = atomic.LoadInt64(&g.stats.wbDeadLetters)
+	}
+
+	// 限流和配额的使用情况
+	if g.quota != nil {
+		stats["quota"] = g.quota.stats()
+	}
+
+	// 热点key
+	if g.hotKeys != nil {
+		keys, rate := g.hotKeys.top(0)
+		hot := make([]map[string]interface{}, 0, len(keys))
+		for _, k := range keys {
+			hot = append(hot, map[string]interface{}{
+				"key":   k.Key,
+				"rate":  k.Rate,
+				"error": k.Error,
+				"share": k.Share,
+			})
+		}
+		stats["hot_keys"] = hot
+		stats["request_rate"] = rate
+	}
+
+	// 失效广播当前的积压情况
+	if g.invalidator != nil {
+		stats["invalidations_pending"] = g.invalidator.pending()
+		stats["invalidation_lag_ms"] = float64(g.invalidator.lag()) / float64(time.Millisecond)
 	}
 
 	// 计算各种命中率
@@ -407,12 +754,12 @@ func ListGroups() []string {
 
 // DestroyGroup 销毁指定名称的缓存组
 func DestroyGroup(name string) bool {
-	groupsMu.Lock()
-	defer groupsMu.Unlock()
+	groupsMu.RLock()
+	g, exists := groups[name]
+	groupsMu.RUnlock()
 
-	if g, exists := groups[name]; exists {
-		g.Close()
-		delete(groups, name)
+	if exists {
+		g.Close() // Close会加锁从全局组映射中移除
 		logrus.Infof("[KamaCache] destroyed cache group [%s]", name)
 		return true
 	}
@@ -422,12 +769,15 @@ func DestroyGroup(name string) bool {
 
 // DestroyAllGroups 销毁所有缓存组
 func DestroyAllGroups() {
-	groupsMu.Lock()
-	defer groupsMu.Unlock()
-
+	groupsMu.RLock()
+	all := make(map[string]*Group, len(groups))
 	for name, g := range groups {
+		all[name] = g
+	}
+	groupsMu.RUnlock()
+
+	for name, g := range all {
 		g.Close()
-		delete(groups, name)
 		logrus.Infof("[KamaCache] destroyed cache group [%s]", name)
 	}
 }
\ No newline at end of file
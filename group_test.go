@@ -0,0 +1,78 @@
+package mycache
+
+import(
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+func TestDestroyGroup(t *testing.T){
+	getter := GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte(key),nil
+	})
+	NewGroup("destroy-a",1<<10,getter)
+	NewGroup("destroy-b",1<<10,getter)
+
+	done := make(chan bool)
+	go func(){
+		ok := DestroyGroup("destroy-a")
+		DestroyAllGroups()
+		done <- ok
+	}()
+	select{
+	case ok := <-done:
+		if !ok{
+			t.Fatal("DestroyGroup should report the existing group")
+		}
+	case <-time.After(5*time.Second):
+		t.Fatal("DestroyGroup deadlocked on groupsMu")
+	}
+	if GetGroup("destroy-a") != nil || GetGroup("destroy-b") != nil{
+		t.Fatal("destroyed groups should be removed from the registry")
+	}
+	if DestroyGroup("destroy-a"){
+		t.Fatal("DestroyGroup should report a missing group")
+	}
+}
+
+//启动后新建和关闭的缓存组也会更新到注册的节点信息中
+func TestServerAdvertisesGroupChanges(t *testing.T){
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"advertise-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	//等待注册的缓存组中是否包含name变为want
+	advertised := func(name string,want bool) bool{
+		for deadline := time.Now().Add(2*time.Second); time.Now().Before(deadline); time.Sleep(10*time.Millisecond){
+			if reg,ok := srv.registration.Load().(registry.Registrar); ok && slices.Contains(reg.Node().Groups,name) == want{
+				return true
+			}
+		}
+		return false
+	}
+
+	g := NewGroup("advertise-late",1<<10,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte(key),nil
+	}))
+	if !advertised("advertise-late",true){
+		t.Fatal("a group created after Start should be advertised")
+	}
+	g.Close()
+	if !advertised("advertise-late",false){
+		t.Fatal("a closed group should no longer be advertised")
+	}
+}
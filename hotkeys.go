@@ -0,0 +1,239 @@
+package mycache
+
+import(
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+)
+
+//热点key检测
+//每个缓存组用Space-Saving算法在固定大小的内存中跟踪请求最多的key：
+//	1.最多跟踪Capacity个key，新的key在跟踪已满时替换计数最小的key，继承它的计数作为误差上限（估计值只会偏高）
+//	2.计数按HalfLife指数衰减，已经不热的key会逐渐被替换；实现上不逐个衰减，而是让新请求的权重随时间指数增长（前向衰减）
+//	3.衰减后的计数乘以衰减系数即为每秒请求数的估计值
+//只统计Get（包括其他节点转发过来的请求），结果通过Group.HotKeys、Stats和CacheAdmin.HotKeys获取；
+//key可能包含用户数据，默认不输出到Prometheus指标，ExportKeys开启后指标mycache_hot_key_rate只带key的哈希（HotKeyHash）
+
+//HotKeyOptions 热点key检测的配置
+type HotKeyOptions struct{
+	TopK int					//返回的热点key数，<=0表示不检测
+	Capacity int				//跟踪的key数，越大越准确，小于TopK时为TopK的10倍
+	HalfLife time.Duration		//计数衰减一半的时间
+	ExportKeys bool				//是否在指标中输出热点key的速率（标签为HotKeyHash，不含原始key）
+}
+
+//DefaultHotKeyOptions 默认配置
+var DefaultHotKeyOptions = HotKeyOptions{
+	TopK: 10,
+	Capacity: 256,
+	HalfLife: time.Minute,
+}
+
+//HotKey 热点key
+type HotKey struct{
+	Key string
+	Rate float64	//估计的每秒请求数（可能偏高，最多偏高Error）
+	Error float64	//估计值的误差上限
+	Share float64	//占缓存组请求数的比例
+}
+
+//maxHotKeyWeight 请求的权重超过这个值时重新以当前时间为基准，避免溢出
+const maxHotKeyWeight = 1e100
+
+//hotEntry 跟踪的一个key
+type hotEntry struct{
+	key string
+	count float64//以landmark为基准的计数
+	err float64
+	index int//在堆中的位置
+}
+
+//hotHeap 按计数排列的最小堆
+type hotHeap []*hotEntry
+
+func (h hotHeap) Len() int{ return len(h) }
+func (h hotHeap) Less(i,j int) bool{ return h[i].count < h[j].count }
+func (h hotHeap) Swap(i,j int){
+	h[i],h[j] = h[j],h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *hotHeap) Push(x interface{}){
+	e := x.(*hotEntry)
+	e.index = len(*h)
+	*h = append(*h,e)
+}
+func (h *hotHeap) Pop() interface{}{
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+//hotKeyTracker 热点key跟踪器
+type hotKeyTracker struct{
+	opts HotKeyOptions
+	lambda float64//每秒的衰减系数
+	mu sync.Mutex
+	landmark time.Time
+	total float64//缓存组的总计数
+	entries map[string]*hotEntry
+	heap hotHeap
+}
+
+func newHotKeyTracker(opts HotKeyOptions) *hotKeyTracker{
+	if opts.Capacity < opts.TopK{
+		opts.Capacity = 10*opts.TopK
+	}
+	if opts.HalfLife <= 0{
+		opts.HalfLife = DefaultHotKeyOptions.HalfLife
+	}
+	return &hotKeyTracker{
+		opts: opts,
+		lambda: math.Ln2/opts.HalfLife.Seconds(),
+		landmark: time.Now(),
+		entries: make(map[string]*hotEntry,opts.Capacity),
+		heap: make(hotHeap,0,opts.Capacity),
+	}
+}
+
+//1.record 记录key的一次请求
+func (t *hotKeyTracker) record(key string){
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w := math.Exp(t.lambda*now.Sub(t.landmark).Seconds())
+	if w > maxHotKeyWeight{
+		t.rescale(now)
+		w = 1
+	}
+	t.total += w
+
+	if e,ok := t.entries[key]; ok{
+		e.count += w
+		heap.Fix(&t.heap,e.index)
+		return
+	}
+	if len(t.heap) < t.opts.Capacity{
+		e := &hotEntry{key: key,count: w}
+		t.entries[key] = e
+		heap.Push(&t.heap,e)
+		return
+	}
+
+	//替换计数最小的key
+	e := t.heap[0]
+	delete(t.entries,e.key)
+	e.key = key
+	e.err = e.count
+	e.count += w
+	t.entries[key] = e
+	heap.Fix(&t.heap,0)
+}
+
+//rescale 以now为基准重新计算所有计数（调用方需持有锁），衰减对所有计数的比例相同，不改变堆的顺序
+func (t *hotKeyTracker) rescale(now time.Time){
+	f := math.Exp(-t.lambda*now.Sub(t.landmark).Seconds())
+	for _,e := range t.heap{
+		e.count *= f
+		e.err *= f
+	}
+	t.total *= f
+	t.landmark = now
+}
+
+//2.top 返回计数最高的n个key，n<=0时返回TopK个，同时返回缓存组的每秒请求数
+func (t *hotKeyTracker) top(n int) ([]HotKey,float64){
+	if n <= 0{
+		n = t.opts.TopK
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries := append([]*hotEntry(nil),t.heap...)
+	sort.Slice(entries,func(i,j int) bool{
+		if entries[i].count != entries[j].count{
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].key < entries[j].key
+	})
+	if len(entries) > n{
+		entries = entries[:n]
+	}
+
+	//计数乘以衰减系数得到每秒请求数
+	scale := t.lambda*math.Exp(-t.lambda*now.Sub(t.landmark).Seconds())
+	keys := make([]HotKey,0,len(entries))
+	for _,e := range entries{
+		keys = append(keys,HotKey{
+			Key: e.key,
+			Rate: e.count*scale,
+			Error: e.err*scale,
+			Share: e.count/t.total,
+		})
+	}
+	return keys,t.total*scale
+}
+
+//HotKeyHash 返回指标中热点key的标签值：SHA-256的前8字节（十六进制），可以与CacheAdmin.HotKeys返回的key对照
+func HotKeyHash(key string) string{
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+//WithHotKeys 设置热点key检测，TopK<=0时不检测
+func WithHotKeys(opts HotKeyOptions) GroupOption{
+	return func(g *Group){
+		g.hotKeyOpts = opts
+	}
+}
+
+//HotKeys 返回缓存组请求最多的key，按估计的每秒请求数从高到低排列，n<=0时返回配置的TopK个
+//没有开启热点key检测时返回nil
+func (g *Group) HotKeys(n int) []HotKey{
+	if g.hotKeys == nil{
+		return nil
+	}
+	keys,_ := g.hotKeys.top(n)
+	return keys
+}
+
+//HotKeys 实现CacheAdmin服务的HotKeys方法
+func (a *adminServer) HotKeys(ctx context.Context,req *pb.HotKeysRequest) (*pb.HotKeysResponse,error){
+	names := []string{req.Group}
+	if req.Group == ""{
+		names = ListGroups()
+	}
+
+	resp := &pb.HotKeysResponse{}
+	for _,name := range names{
+		g := GetGroup(name)
+		if g == nil{
+			if req.Group != ""{
+				return nil,fmt.Errorf("group %s not found",name)
+			}
+			continue
+		}
+		if g.hotKeys == nil{
+			continue
+		}
+
+		keys,rate := g.hotKeys.top(int(req.Limit))
+		gk := &pb.GroupHotKeys{Group: name,Rate: rate}
+		for _,k := range keys{
+			gk.Keys = append(gk.Keys,&pb.HotKey{Key: k.Key,Rate: k.Rate,Error: k.Error,Share: k.Share})
+		}
+		resp.Groups = append(resp.Groups,gk)
+	}
+	return resp,nil
+}
@@ -0,0 +1,76 @@
+package mycache
+
+import(
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+)
+
+func TestHotKeyTracker(t *testing.T){
+	tracker := newHotKeyTracker(HotKeyOptions{TopK: 3,Capacity: 20,HalfLife: 50*time.Millisecond})
+
+	//3个热点key混在大量只出现一次的key中
+	for i := 0; i < 2000; i++{
+		tracker.record(fmt.Sprintf("cold-%d",i))
+		if i%2 == 0{
+			tracker.record("hot-a")
+		}
+		if i%4 == 0{
+			tracker.record("hot-b")
+		}
+		if i%8 == 0{
+			tracker.record("hot-c")
+		}
+	}
+	keys,_ := tracker.top(0)
+	if len(keys) != 3 || keys[0].Key != "hot-a" || keys[1].Key != "hot-b" || keys[2].Key != "hot-c"{
+		t.Fatalf("unexpected top keys: %+v",keys)
+	}
+	if keys[0].Share < 0.25 || keys[0].Share > 0.4{
+		t.Fatalf("unexpected share of hot-a: %v",keys[0].Share)
+	}
+
+	//之前的热点衰减后被新的热点替换
+	time.Sleep(500*time.Millisecond)
+	for i := 0; i < 100; i++{
+		tracker.record("new-hot")
+	}
+	keys,_ = tracker.top(1)
+	if keys[0].Key != "new-hot" || keys[0].Share < 0.9{
+		t.Fatalf("old hot keys should have decayed: %+v",keys)
+	}
+}
+
+func TestHotKeysAdmin(t *testing.T){
+	g := NewGroup("hotkeys-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}))
+	defer DestroyGroup("hotkeys-test")
+	NewGroup("hotkeys-off",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithHotKeys(HotKeyOptions{}))
+	defer DestroyGroup("hotkeys-off")
+
+	for i := 0; i < 10; i++{
+		g.Get(context.Background(),"a")
+	}
+	g.Get(context.Background(),"b")
+
+	admin := &adminServer{}
+	resp,err := admin.HotKeys(context.Background(),&pb.HotKeysRequest{Group: "hotkeys-test",Limit: 1})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(resp.Groups) != 1 || len(resp.Groups[0].Keys) != 1 || resp.Groups[0].Keys[0].Key != "a" || resp.Groups[0].Rate <= 0{
+		t.Fatalf("unexpected response: %v",resp)
+	}
+	if _,ok := GetGroup("hotkeys-off").Stats()["hot_keys"]; ok{
+		t.Fatal("hot key detection should be disabled")
+	}
+	if _,err := admin.HotKeys(context.Background(),&pb.HotKeysRequest{Group: "missing"}); err == nil{
+		t.Fatal("expected an error for a missing group")
+	}
+}
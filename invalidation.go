@@ -0,0 +1,299 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//集群范围的失效广播
+//Group.load会把从其他节点获取的值存到本地缓存，Set在非主节点上也会写本地缓存，
+//而Delete/Set只会通过syncToPeers同步到副本节点，其他节点上的副本要等到过期才会消失。
+//失效总线在Set/Delete之后向所有非副本节点广播Invalidate，让它们删除本地的旧副本：
+//	1.每个节点一个待发送队列，同一个key只保留一条（合并），队列有上限
+//	2.发送失败时按指数退避重试，直到成功或者节点离开集群（至少一次送达）；
+//	  节点没有这个缓存组（NotFound）或者拒绝处理（FailedPrecondition）时重试没有意义，丢弃这一批并计入丢弃数
+//	3.统计从入队到送达的延迟（lag），用于监控广播是否跟得上
+
+const(
+	//defaultInvalidationQueueSize 每个节点待发送队列的默认上限
+	defaultInvalidationQueueSize = 10000
+	//invalidationBatchSize 每次Invalidate请求携带的key数量
+	invalidationBatchSize = 128
+	//invalidationTimeout 单次Invalidate请求的超时时间
+	invalidationTimeout = 3*time.Second
+	//invalidationMaxBackoff 重试的最大等待时间
+	invalidationMaxBackoff = 5*time.Second
+)
+
+//errPeerGone 目标节点已经离开集群
+var errPeerGone = errors.New("peer is no longer in the cluster")
+
+//invalidatePeer 支持失效广播的peer（Client实现了该接口）
+type invalidatePeer interface{
+	Invalidate(ctx context.Context,group string,keys []string) (int,error)
+}
+
+//invalidationBus 失效总线
+type invalidationBus struct{
+	g *Group
+	maxPending int
+	mu sync.Mutex
+	queues map[string]*invalidationQueue//节点地址到待发送队列的映射
+}
+
+//invalidationQueue 发往单个节点的待发送队列
+type invalidationQueue struct{
+	mu sync.Mutex
+	pending map[string]*pendingKey
+	seq uint64//入队序号
+	notify chan struct{}
+}
+
+//pendingKey 待发送的key
+type pendingKey struct{
+	since time.Time//最早的入队时间
+	seq uint64//最近一次入队的序号，发送期间再次入队时序号会变化
+}
+
+//newInvalidationBus 创建失效总线，maxPending为每个节点待发送队列的上限
+func newInvalidationBus(g *Group,maxPending int) *invalidationBus{
+	return &invalidationBus{
+		g: g,
+		maxPending: maxPending,
+		queues: make(map[string]*invalidationQueue),
+	}
+}
+
+//1.publish 向除副本节点外的所有节点广播key的失效（副本节点由syncToPeers同步）
+func (b *invalidationBus) publish(key string){
+	rp,ok := b.g.peers.(ReplicaPicker)
+	if !ok{
+		return
+	}
+
+	replicas := rp.Replicas(key)
+	now := time.Now()
+	for _,addr := range rp.Peers(){
+		if containsAddr(replicas,addr){
+			continue
+		}
+		b.enqueue(addr,key,now)
+	}
+	atomic.AddInt64(&b.g.stats.invPublished,1)
+}
+
+//2.enqueue 将key加入发往addr的队列，必要时启动该节点的发送协程
+func (b *invalidationBus) enqueue(addr,key string,now time.Time){
+	b.mu.Lock()
+	q,ok := b.queues[addr]
+	if !ok{
+		q = &invalidationQueue{
+			pending: make(map[string]*pendingKey),
+			notify: make(chan struct{},1),
+		}
+		b.queues[addr] = q
+		go b.sendLoop(addr,q)
+	}
+	b.mu.Unlock()
+
+	q.mu.Lock()
+	q.seq++
+	if pk,exists := q.pending[key]; exists{
+		pk.seq = q.seq//已经在队列中的key保留最早的入队时间
+	}else{
+		if len(q.pending) >= b.maxPending{
+			q.mu.Unlock()
+			atomic.AddInt64(&b.g.stats.invDropped,1)
+			logrus.Warnf("[mycache] invalidation queue for %s is full, dropping key %s",addr,key)
+			return
+		}
+		q.pending[key] = &pendingKey{since: now,seq: q.seq}
+	}
+	q.mu.Unlock()
+
+	select{
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+//3.sendLoop 向单个节点发送失效通知的协程，组关闭或节点离开集群时退出
+func (b *invalidationBus) sendLoop(addr string,q *invalidationQueue){
+	backoff := 100*time.Millisecond
+	for{
+		select{
+		case <-b.g.stopCh:
+			return
+		case <-q.notify:
+		}
+
+		for{
+			keys,seqs,oldest := q.batch(invalidationBatchSize)
+			if len(keys) == 0{
+				break
+			}
+
+			err := b.send(addr,keys)
+			if err == errPeerGone{
+				b.remove(addr)
+				return
+			}
+			if finalInvalidationError(err){
+				q.ack(keys,seqs)
+				atomic.AddInt64(&b.g.stats.invDropped,int64(len(keys)))
+				logrus.Warnf("[mycache] dropping %d invalidations for %s: %v",len(keys),addr,err)
+				backoff = 100*time.Millisecond
+				continue
+			}
+			if err != nil{
+				atomic.AddInt64(&b.g.stats.invRetries,1)
+				logrus.Debugf("[mycache] failed to send invalidation to %s, retrying in %v: %v",addr,backoff,err)
+				select{
+				case <-b.g.stopCh:
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2,invalidationMaxBackoff)
+				continue
+			}
+
+			backoff = 100*time.Millisecond
+			q.ack(keys,seqs)
+			atomic.AddInt64(&b.g.stats.invDelivered,int64(len(keys)))
+
+			//记录本批次中最早入队的key的送达延迟
+			lag := time.Since(oldest).Nanoseconds()
+			for{
+				maxLag := atomic.LoadInt64(&b.g.stats.invMaxLag)
+				if lag <= maxLag || atomic.CompareAndSwapInt64(&b.g.stats.invMaxLag,maxLag,lag){
+					break
+				}
+			}
+		}
+	}
+}
+
+//finalInvalidationError 重试也不会成功的错误
+func finalInvalidationError(err error) bool{
+	switch status.Code(err){
+	case codes.NotFound,codes.FailedPrecondition:
+		return true
+	}
+	return false
+}
+
+//4.send 向addr发送一批失效通知
+func (b *invalidationBus) send(addr string,keys []string) error{
+	rp,ok := b.g.peers.(ReplicaPicker)
+	if !ok{
+		return errPeerGone
+	}
+	peer,ok := rp.GetPeer(addr)
+	if !ok{
+		return errPeerGone//节点已经离开集群，其缓存也不会再被访问
+	}
+	ip,ok := peer.(invalidatePeer)
+	if !ok{
+		return errPeerGone
+	}
+
+	ctx,cancel := context.WithTimeout(context.Background(),invalidationTimeout)
+	defer cancel()
+
+	_,err := ip.Invalidate(ctx,b.g.name,keys)
+	return err
+}
+
+//5.remove 移除节点的待发送队列
+func (b *invalidationBus) remove(addr string){
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.queues,addr)
+}
+
+//6.lag 返回所有队列中最早入队且尚未送达的key已经等待的时间
+func (b *invalidationBus) lag() time.Duration{
+	b.mu.Lock()
+	queues := make([]*invalidationQueue,0,len(b.queues))
+	for _,q := range b.queues{
+		queues = append(queues,q)
+	}
+	b.mu.Unlock()
+
+	var maxLag time.Duration
+	now := time.Now()
+	for _,q := range queues{
+		q.mu.Lock()
+		for _,pk := range q.pending{
+			maxLag = max(maxLag,now.Sub(pk.since))
+		}
+		q.mu.Unlock()
+	}
+	return maxLag
+}
+
+//7.pending 返回所有队列中尚未送达的key的数量
+func (b *invalidationBus) pending() int{
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+	for _,q := range b.queues{
+		q.mu.Lock()
+		n += len(q.pending)
+		q.mu.Unlock()
+	}
+	return n
+}
+
+//batch 取出最多n个待发送的key及其入队序号（不从队列中删除，送达后由ack删除），并返回其中最早的入队时间
+func (q *invalidationQueue) batch(n int) ([]string,[]uint64,time.Time){
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var oldest time.Time
+	keys := make([]string,0,min(n,len(q.pending)))
+	seqs := make([]uint64,0,cap(keys))
+	for key,pk := range q.pending{
+		if len(keys) >= n{
+			break
+		}
+		keys = append(keys,key)
+		seqs = append(seqs,pk.seq)
+		if oldest.IsZero() || pk.since.Before(oldest){
+			oldest = pk.since
+		}
+	}
+	return keys,seqs,oldest
+}
+
+//ack 删除已经送达的key（发送期间再次入队的key保留，需要再发送一次）
+func (q *invalidationQueue) ack(keys []string,seqs []uint64){
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i,key := range keys{
+		if pk,ok := q.pending[key]; ok && pk.seq == seqs[i]{
+			delete(q.pending,key)
+		}
+	}
+}
+
+//8.invalidateLocal 删除本地缓存中的副本（供Server.Invalidate调用，不会继续传播）
+func (g *Group) invalidateLocal(keys []string) int{
+	purged := 0
+	for _,key := range keys{
+		if g.mainCache.Delete(key){
+			purged++
+		}
+	}
+	atomic.AddInt64(&g.stats.invReceived,int64(len(keys)))
+	return purged
+}
@@ -0,0 +1,201 @@
+package mycache
+
+import(
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//invalidationPicker 只有一个其他节点的ReplicaPicker，本节点是所有key的副本
+type invalidationPicker struct{
+	peer *invalidationPeer
+}
+
+func (p *invalidationPicker) PickPeer(ctx context.Context,key string) (Peer,bool,bool){ return nil,false,false }
+func (p *invalidationPicker) Close() error{ return nil }
+func (p *invalidationPicker) Replicas(key string) []string{ return []string{"self"} }
+func (p *invalidationPicker) GetPeer(addr string) (Peer,bool){ return p.peer,addr == "peer" }
+func (p *invalidationPicker) Self() string{ return "self" }
+func (p *invalidationPicker) Peers() []string{ return []string{"peer"} }
+
+//invalidationPeer 记录收到的失效通知，gate不为nil时第一次调用阻塞到gate关闭
+type invalidationPeer struct{
+	mu sync.Mutex
+	batches [][]string
+	err error
+	started chan struct{}
+	gate chan struct{}
+}
+
+func (p *invalidationPeer) Get(ctx context.Context,group,key string) ([]byte,error){ return nil,nil }
+func (p *invalidationPeer) Set(ctx context.Context,group,key string,value []byte) error{ return nil }
+func (p *invalidationPeer) Delete(ctx context.Context,group,key string) (bool,error){ return false,nil }
+func (p *invalidationPeer) Close() error{ return nil }
+
+func (p *invalidationPeer) Invalidate(ctx context.Context,group string,keys []string) (int,error){
+	keys = append([]string(nil),keys...)
+	sort.Strings(keys)
+	p.mu.Lock()
+	p.batches = append(p.batches,keys)
+	first := len(p.batches) == 1
+	p.mu.Unlock()
+
+	if first && p.gate != nil{
+		close(p.started)
+		<-p.gate
+	}
+	return len(keys),p.err
+}
+
+func (p *invalidationPeer) sent() [][]string{
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]string(nil),p.batches...)
+}
+
+func newInvalidationGroup(t *testing.T,name string,peer *invalidationPeer) *Group{
+	g := NewGroup(name,1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithPeers(&invalidationPicker{peer: peer}))
+	t.Cleanup(func(){ DestroyGroup(name) })
+	return g
+}
+
+func waitDelivered(t *testing.T,g *Group){
+	t.Helper()
+	deadline := time.Now().Add(5*time.Second)
+	for g.invalidator.pending() > 0{
+		if time.Now().After(deadline){
+			t.Fatalf("%d invalidations still pending",g.invalidator.pending())
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+}
+
+func TestInvalidationCoalescing(t *testing.T){
+	peer := &invalidationPeer{started: make(chan struct{}),gate: make(chan struct{})}
+	g := newInvalidationGroup(t,"invalidation-coalesce",peer)
+	bus := g.invalidator
+
+	//第一批发送期间阻塞，之后的入队合并
+	bus.publish("a")
+	<-peer.started
+	for i := 0; i < 3; i++{
+		bus.publish("b")
+	}
+	bus.publish("a")//发送期间再次入队，送达后不能被第一批的确认删除
+	if n := bus.pending(); n != 2{
+		t.Fatalf("expected 2 coalesced keys pending, got %d",n)
+	}
+
+	time.Sleep(50*time.Millisecond)
+	if lag := bus.lag(); lag < 50*time.Millisecond{
+		t.Fatalf("lag should cover the time a is waiting, got %v",lag)
+	}
+
+	close(peer.gate)
+	waitDelivered(t,g)
+
+	batches := peer.sent()
+	if len(batches) != 2 || len(batches[0]) != 1 || batches[0][0] != "a" || len(batches[1]) != 2 || batches[1][0] != "a" || batches[1][1] != "b"{
+		t.Fatalf("unexpected batches: %v",batches)
+	}
+	if delivered := atomic.LoadInt64(&g.stats.invDelivered); delivered != 3{
+		t.Fatalf("expected 3 delivered keys, got %d",delivered)
+	}
+	if maxLag := time.Duration(atomic.LoadInt64(&g.stats.invMaxLag)); maxLag < 50*time.Millisecond{
+		t.Fatalf("max lag should be reported after delivery, got %v",maxLag)
+	}
+	if bus.lag() != 0{
+		t.Fatal("lag should be 0 once the queue is empty")
+	}
+}
+
+func TestInvalidationGroupNotFound(t *testing.T){
+	peer := &invalidationPeer{err: status.Error(codes.NotFound,"group not found")}
+	g := newInvalidationGroup(t,"invalidation-notfound",peer)
+
+	g.invalidator.publish("a")
+	g.invalidator.publish("b")
+	waitDelivered(t,g)
+
+	if retries := atomic.LoadInt64(&g.stats.invRetries); retries != 0{
+		t.Fatalf("NotFound should not be retried, got %d retries",retries)
+	}
+	if dropped := atomic.LoadInt64(&g.stats.invDropped); dropped != 2{
+		t.Fatalf("expected 2 dropped keys, got %d",dropped)
+	}
+}
+
+func TestInvalidationOnGRPCWrite(t *testing.T){
+	peer := &invalidationPeer{}
+	g := newInvalidationGroup(t,"invalidation-grpc",peer)
+
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"invalidation-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	conn,err := grpc.NewClient(addr,grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := pb.NewMyCacheClient(conn)
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+
+	//客户端直接发送的写入要广播失效通知
+	if _,err := cli.Set(ctx,&pb.Request{Group: g.name,Key: "a",Value: []byte("1")},grpc.WaitForReady(true)); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := cli.Delete(ctx,&pb.Request{Group: g.name,Key: "b"}); err != nil{
+		t.Fatal(err)
+	}
+	waitDelivered(t,g)
+
+	//其他节点同步过来的写入不再广播
+	if _,err := cli.Replicate(ctx,&pb.ReplicateRequest{Group: g.name,Key: "c",Value: []byte("3")}); err != nil{
+		t.Fatal(err)
+	}
+	//没有开启认证时，调用方自己加上的from-peer元数据不会跳过广播
+	forged := metadata.AppendToOutgoingContext(ctx,fromPeerKey,"true")
+	if _,err := cli.Set(forged,&pb.Request{Group: g.name,Key: "d",Value: []byte("4")}); err != nil{
+		t.Fatal(err)
+	}
+	waitDelivered(t,g)
+
+	var keys []string
+	for _,batch := range peer.sent(){
+		keys = append(keys,batch...)
+	}
+	sort.Strings(keys)
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "d"{
+		t.Fatalf("expected invalidations for a, b and d, got %v",keys)
+	}
+	if view,err := g.Get(ctx,"c"); err != nil || view.String() != "3"{
+		t.Fatalf("the synced write should be stored locally, got %q, %v",view.String(),err)
+	}
+}
@@ -0,0 +1,182 @@
+package merkle
+
+import(
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash/fnv"
+	"sort"
+)
+
+//默克尔树用于副本之间的反熵（anti-entropy）：
+//两个节点各自对共享的键区间构建一棵树，只需要比较根哈希就能判断数据是否一致，
+//不一致时自顶向下比较，找出不一致的叶子桶，然后只同步这些桶中的数据
+
+//DefaultLeaves 默认的叶子桶数量
+const DefaultLeaves = 64
+
+//MaxLeaves 叶子桶数量的上限，叶子数量可能来自其他节点，需要限制内存分配
+const MaxLeaves = 4096
+
+//ErrInvalidLeaves 叶子数量不合法
+var ErrInvalidLeaves = errors.New("merkle: leaf count must be a power of two no greater than MaxLeaves")
+
+//entry 叶子桶中的一个键值摘要
+type entry struct{
+	key string
+	sum [sha256.Size]byte
+}
+
+//Builder 用于逐个添加键值对并最终构建Tree
+type Builder struct{
+	leaves int
+	buckets [][]entry
+}
+
+//Tree 默克尔树(以数组形式存储的完全二叉树，nodes[1]为根，叶子位于[leaves,2*leaves))
+type Tree struct{
+	leaves int
+	nodes [][]byte
+}
+
+//NewBuilder 创建Builder，leaves会被调整为2的幂
+func NewBuilder(leaves int) *Builder{
+	leaves = normalizeLeaves(leaves)
+	return &Builder{
+		leaves: leaves,
+		buckets: make([][]entry,leaves),
+	}
+}
+
+//BucketOf 返回key所属的叶子桶下标
+func BucketOf(key string,leaves int) int{
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() & uint32(normalizeLeaves(leaves)-1))
+}
+
+//1.Add 添加一个键值对
+func (b *Builder) Add(key string,value []byte){
+	idx := BucketOf(key,b.leaves)
+	b.buckets[idx] = append(b.buckets[idx],entry{key: key,sum: sumEntry(key,value)})
+}
+
+//2.Build 构建默克尔树（桶内按key排序，保证结果与添加顺序无关）
+func (b *Builder) Build() *Tree{
+	t := &Tree{
+		leaves: b.leaves,
+		nodes: make([][]byte,2*b.leaves),
+	}
+
+	for i,bucket := range b.buckets{
+		sort.Slice(bucket,func(x,y int) bool{
+			return bucket[x].key < bucket[y].key
+		})
+
+		h := sha256.New()
+		for _,e := range bucket{
+			h.Write(e.sum[:])
+		}
+		t.nodes[b.leaves+i] = h.Sum(nil)
+	}
+
+	t.buildInner()
+	return t
+}
+
+//FromLeaves 根据远端传来的叶子哈希还原出一棵树
+func FromLeaves(leaves [][]byte) (*Tree,error){
+	n := len(leaves)
+	if n == 0 || n > MaxLeaves || n&(n-1) != 0{
+		return nil,ErrInvalidLeaves
+	}
+
+	t := &Tree{
+		leaves: n,
+		nodes: make([][]byte,2*n),
+	}
+	copy(t.nodes[n:],leaves)
+	t.buildInner()
+	return t,nil
+}
+
+//3.Root 返回根哈希
+func (t *Tree) Root() []byte{
+	return t.nodes[1]
+}
+
+//4.Leaves 返回所有叶子哈希
+func (t *Tree) Leaves() [][]byte{
+	leaves := make([][]byte,t.leaves)
+	copy(leaves,t.nodes[t.leaves:])
+	return leaves
+}
+
+//5.LeafCount 返回叶子数量
+func (t *Tree) LeafCount() int{
+	return t.leaves
+}
+
+//Diff 自顶向下比较两棵树，返回哈希不一致的叶子桶下标
+func Diff(a,b *Tree) []int{
+	if a.leaves != b.leaves{
+		//叶子数量不同无法比较，认为所有桶都不一致
+		all := make([]int,a.leaves)
+		for i := range all{
+			all[i] = i
+		}
+		return all
+	}
+
+	var diff []int
+	var walk func(i int)
+	walk = func(i int){
+		if bytes.Equal(a.nodes[i],b.nodes[i]){
+			return//子树一致，剪枝
+		}
+		if i >= a.leaves{
+			diff = append(diff,i-a.leaves)
+			return
+		}
+		walk(2*i)
+		walk(2*i+1)
+	}
+	walk(1)
+
+	return diff
+}
+
+//buildInner 由叶子自底向上计算内部节点
+func (t *Tree) buildInner(){
+	for i := t.leaves-1; i >= 1; i--{
+		h := sha256.New()
+		h.Write(t.nodes[2*i])
+		h.Write(t.nodes[2*i+1])
+		t.nodes[i] = h.Sum(nil)
+	}
+}
+
+//sumEntry 计算单个键值对的摘要（key与value之间加入长度前缀，防止拼接歧义）
+func sumEntry(key string,value []byte) [sha256.Size]byte{
+	buf := make([]byte,0,8+len(key)+len(value))
+	n := len(key)
+	buf = append(buf,byte(n>>24),byte(n>>16),byte(n>>8),byte(n))
+	buf = append(buf,key...)
+	buf = append(buf,value...)
+	return sha256.Sum256(buf)
+}
+
+//normalizeLeaves 将叶子数量调整为不小于1、不超过MaxLeaves的2的幂
+func normalizeLeaves(leaves int) int{
+	if leaves <= 0{
+		return DefaultLeaves
+	}
+	if leaves > MaxLeaves{
+		return MaxLeaves
+	}
+	n := 1
+	for n < leaves{
+		n <<= 1
+	}
+	return n
+}
@@ -0,0 +1,79 @@
+package merkle
+
+import(
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+//测试默克尔树的构建与比较
+func TestTreeDiff(t *testing.T){
+	//1.相同的数据（添加顺序不同）应得到相同的根哈希
+	t.Run("相同数据根哈希一致",func(t *testing.T){
+		a,b := NewBuilder(16),NewBuilder(16)
+		for i := 0; i<100; i++{
+			a.Add(fmt.Sprintf("key%d",i),[]byte(fmt.Sprintf("value%d",i)))
+		}
+		for i := 99; i>=0; i--{
+			b.Add(fmt.Sprintf("key%d",i),[]byte(fmt.Sprintf("value%d",i)))
+		}
+
+		ta,tb := a.Build(),b.Build()
+		if !bytes.Equal(ta.Root(),tb.Root()){
+			t.Fatal("相同数据的根哈希应一致")
+		}
+		if diff := Diff(ta,tb); len(diff) != 0{
+			t.Fatalf("相同数据不应有差异桶，实际为%v",diff)
+		}
+	})
+
+	//2.值不同或缺失的key只应出现在对应的叶子桶中
+	t.Run("定位不一致的叶子桶",func(t *testing.T){
+		a,b := NewBuilder(16),NewBuilder(16)
+		for i := 0; i<100; i++{
+			key := fmt.Sprintf("key%d",i)
+			a.Add(key,[]byte("v"))
+			switch i{
+			case 7:
+				b.Add(key,[]byte("changed"))
+			case 42:
+				//b中缺失key42
+			default:
+				b.Add(key,[]byte("v"))
+			}
+		}
+
+		diff := Diff(a.Build(),b.Build())
+		want := map[int]bool{BucketOf("key7",16): true,BucketOf("key42",16): true}
+		if len(diff) != len(want){
+			t.Fatalf("差异桶数量应为%d，实际为%v",len(want),diff)
+		}
+		for _,idx := range diff{
+			if !want[idx]{
+				t.Fatalf("桶%d不应出现在差异中",idx)
+			}
+		}
+	})
+
+	//3.由叶子还原的树与原树一致
+	t.Run("由叶子还原",func(t *testing.T){
+		b := NewBuilder(10)//会被调整为16
+		b.Add("a",[]byte("1"))
+		tree := b.Build()
+		if tree.LeafCount() != 16{
+			t.Fatalf("叶子数量应为16，实际为%d",tree.LeafCount())
+		}
+
+		restored,err := FromLeaves(tree.Leaves())
+		if err != nil{
+			t.Fatalf("还原失败：%v",err)
+		}
+		if !bytes.Equal(tree.Root(),restored.Root()){
+			t.Fatal("还原后的根哈希应与原树一致")
+		}
+
+		if _,err := FromLeaves(make([][]byte,3)); err != ErrInvalidLeaves{
+			t.Fatalf("叶子数量不是2的幂时应返回ErrInvalidLeaves，实际为%v",err)
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package mycache
+
+import(
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/consistenthash"
+	"github.com/Rampage-cd/DistributedCache/metrics"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc/status"
+)
+
+//Prometheus指标
+//请求路径上只累加counter和histogram（缓存组每个操作的结果和延迟、对端每个RPC的结果和延迟），
+//其余指标在抓取时从已有的统计信息读取：缓存组的命中情况、singleflight合并次数、存储的淘汰和过期次数、
+//限流和配额、热点key、断路器状态、哈希环各节点的负载占比（consistenthash.Map.GetStats），以及Server的注册状态和leader身份
+//MetricsHandler可以挂到应用自己的HTTP服务上，Server也可以通过WithMetricsAddr单独监听
+
+//Metrics 所有缓存组和节点共用的指标注册表，应用可以在上面注册自己的指标
+var Metrics = metrics.NewRegistry()
+
+var(
+	groupRequests = Metrics.Counter("mycache_group_requests_total",
+		"Group operations by result.","group","op","result")
+	groupLatency = Metrics.Histogram("mycache_group_request_duration_seconds",
+		"Latency of group operations.",nil,"group","op")
+	peerRequests = Metrics.Counter("mycache_peer_requests_total",
+		"RPCs sent to peers by gRPC status code, each retry counted separately.","peer","method","code")
+	peerLatency = Metrics.Histogram("mycache_peer_request_duration_seconds",
+		"Latency of RPCs sent to peers.",nil,"peer","method")
+)
+
+func init(){
+	Metrics.Collect(collectGroups)
+}
+
+//MetricsHandler 返回以Prometheus文本格式输出指标的http.Handler（不包括Server的注册状态，见Server.MetricsHandler）
+func MetricsHandler() http.Handler{
+	return metrics.Handler(Metrics)
+}
+
+//observeGroupOp 记录缓存组一次操作的结果和延迟
+func observeGroupOp(group,op string,start time.Time,err *error){
+	result := "ok"
+	switch{
+	case *err == nil:
+	case errors.Is(*err,ErrRateLimited) || errors.Is(*err,ErrQuotaExceeded):
+		result = "rejected"
+	default:
+		result = "error"
+	}
+	groupRequests.Inc(group,op,result)
+	groupLatency.Observe(time.Since(start).Seconds(),group,op)
+}
+
+//observePeerCall 记录对端一次RPC的结果和延迟
+func observePeerCall(peer,method string,start time.Time,err error){
+	peerRequests.Inc(peer,method,status.Code(err).String())
+	peerLatency.Observe(time.Since(start).Seconds(),peer,method)
+}
+
+//collectGroups 抓取时输出各缓存组的统计信息
+func collectGroups(e *metrics.Emitter){
+	pickers := make(map[*ClientPicker]bool)
+	for _,name := range ListGroups(){
+		g := GetGroup(name)
+		if g == nil{
+			continue
+		}
+
+		counters := []struct{
+			name,help string
+			value *int64
+		}{
+			{"mycache_group_loads_total","Loads after a local cache miss.",&g.stats.loads},
+			{"mycache_group_local_hits_total","Local cache hits.",&g.stats.localHits},
+			{"mycache_group_local_misses_total","Local cache misses.",&g.stats.localMisses},
+			{"mycache_group_peer_hits_total","Values fetched from peers.",&g.stats.peerHits},
+			{"mycache_group_peer_misses_total","Failed fetches from peers.",&g.stats.peerMisses},
+			{"mycache_group_loader_hits_total","Values loaded from the data source.",&g.stats.loaderHits},
+			{"mycache_group_loader_errors_total","Failed loads.",&g.stats.loaderErrors},
+		}
+		for _,c := range counters{
+			e.Counter(c.name,c.help,float64(atomic.LoadInt64(c.value)),"group",name)
+		}
+
+		calls,dedups := g.loader.Stats()
+		e.Counter("mycache_singleflight_calls_total","Loads executed by singleflight.",float64(calls),"group",name)
+		e.Counter("mycache_singleflight_deduplicated_total","Loads that waited for an in-flight load of the same key.",float64(dedups),"group",name)
+
+		if m,ok := g.mainCache.storeMetrics(); ok{
+			e.Counter("mycache_store_evictions_total","Entries evicted because the store was full.",float64(m.Evictions),"group",name)
+			e.Counter("mycache_store_expirations_total","Entries removed after expiring.",float64(m.Expirations),"group",name)
+		}
+		e.Gauge("mycache_cache_items","Entries in the local cache.",float64(g.mainCache.Len()),"group",name)
+
+		if g.quota != nil{
+			e.Counter("mycache_group_rate_limited_total","Requests rejected by rate limits.",float64(atomic.LoadInt64(&g.quota.rateLimited)),"group",name)
+			e.Counter("mycache_group_quota_rejected_total","Writes rejected by memory quotas.",float64(atomic.LoadInt64(&g.quota.quotaRejected)),"group",name)
+		}
+
+		if g.hotKeys != nil{
+			keys,rate := g.hotKeys.top(0)
+			e.Gauge("mycache_group_request_rate","Decayed estimate of Get requests per second.",rate,"group",name)
+			if g.hotKeyOpts.ExportKeys{//原始key只通过CacheAdmin.HotKeys查看
+				for _,k := range keys{
+					e.Gauge("mycache_hot_key_rate","Decayed estimate of Get requests per second for the hottest keys, labeled by HotKeyHash.",k.Rate,"group",name,"key_hash",HotKeyHash(k.Key))
+				}
+			}
+		}
+
+		if p,ok := g.peers.(*ClientPicker); ok{
+			pickers[p] = true
+		}
+	}
+
+	for p := range pickers{
+		p.collect(e)
+	}
+}
+
+//collect 抓取时输出各节点的断路器状态和哈希环负载占比
+func (p *ClientPicker) collect(e *metrics.Emitter){
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for addr,client := range p.clients{
+		if client.health == nil{
+			continue
+		}
+		open := 0.0
+		if client.health.breaker.ejected(){
+			open = 1
+		}
+		e.Gauge("mycache_peer_circuit_open","Whether the circuit breaker of a peer is open.",open,"service",p.svcName,"peer",addr)
+	}
+
+	if m,ok := p.partitioner.(*consistenthash.Map); ok{
+		for node,share := range m.GetStats(){
+			e.Gauge("mycache_ring_load_share","Share of in-flight requests routed to each node of the hash ring.",share,"service",p.svcName,"node",node)
+		}
+	}
+}
+
+//MetricsHandler 返回以Prometheus文本格式输出指标的http.Handler，包括本节点的注册状态和leader身份
+func (s *Server) MetricsHandler() http.Handler{
+	return metrics.Handler(Metrics,s.collect)
+}
+
+//collect 抓取时输出本节点的注册状态、leader身份和正在处理的请求数
+func (s *Server) collect(e *metrics.Emitter){
+	current := s.RegistrationState()
+	for _,state := range []registry.State{registry.StateRegistering,registry.StateRegistered,registry.StateLost,registry.StateStopped}{
+		value := 0.0
+		if state == current{
+			value = 1
+		}
+		e.Gauge("mycache_registry_state","Registration state of this node in service discovery.",value,"service",s.svcName,"state",state.String())
+	}
+
+	if s.election != nil{
+		leader := 0.0
+		if s.IsLeader(){
+			leader = 1
+		}
+		e.Gauge("mycache_leader","Whether this node is the cluster leader.",leader,"service",s.svcName)
+	}
+	e.Gauge("mycache_server_inflight_requests","Requests being handled by this node.",float64(atomic.LoadInt64(&s.inflight)),"service",s.svcName)
+}
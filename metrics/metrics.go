@@ -0,0 +1,335 @@
+package metrics
+
+import(
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+//Prometheus文本格式的指标
+//不依赖Prometheus的客户端库，只实现缓存需要的部分：
+//	1.Counter和Histogram在请求路径上累加，按标签值区分
+//	2.Collect注册的回调在抓取时执行，把已有的统计信息（如Group.Stats、哈希环负载）转换为gauge或counter
+//	3.Registry实现http.Handler，按指标名排序输出，同名指标的HELP和TYPE只输出一次
+
+//DefBuckets 默认的延迟桶（秒）
+var DefBuckets = []float64{.0005,.001,.0025,.005,.01,.025,.05,.1,.25,.5,1,2.5,5}
+
+//Registry 指标注册表
+type Registry struct{
+	mu sync.RWMutex
+	counters []*CounterVec
+	histograms []*HistogramVec
+	collectors []func(*Emitter)
+}
+
+//NewRegistry 创建注册表
+func NewRegistry() *Registry{
+	return &Registry{}
+}
+
+//1.Counter 注册counter，labels为标签名
+func (r *Registry) Counter(name,help string,labels ...string) *CounterVec{
+	c := &CounterVec{desc: desc{name: name,help: help,labels: labels}}
+	r.mu.Lock()
+	r.counters = append(r.counters,c)
+	r.mu.Unlock()
+	return c
+}
+
+//2.Histogram 注册histogram，buckets为nil时使用DefBuckets
+func (r *Registry) Histogram(name,help string,buckets []float64,labels ...string) *HistogramVec{
+	if buckets == nil{
+		buckets = DefBuckets
+	}
+	h := &HistogramVec{desc: desc{name: name,help: help,labels: labels},buckets: buckets}
+	r.mu.Lock()
+	r.histograms = append(r.histograms,h)
+	r.mu.Unlock()
+	return h
+}
+
+//3.Collect 注册抓取时执行的回调
+func (r *Registry) Collect(fn func(*Emitter)){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors,fn)
+}
+
+//4.Write 以Prometheus文本格式输出所有指标，extra为本次抓取额外执行的回调
+func (r *Registry) Write(w io.Writer,extra ...func(*Emitter)) error{
+	e := &Emitter{families: make(map[string]*family)}
+
+	r.mu.RLock()
+	for _,c := range r.counters{
+		c.emit(e)
+	}
+	for _,h := range r.histograms{
+		h.emit(e)
+	}
+	collectors := append(append([]func(*Emitter){},r.collectors...),extra...)
+	r.mu.RUnlock()
+
+	for _,fn := range collectors{
+		fn(e)
+	}
+	return e.write(w)
+}
+
+//5.ServeHTTP 实现http.Handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter,req *http.Request){
+	Handler(r).ServeHTTP(w,req)
+}
+
+//Handler 返回输出注册表指标的http.Handler，extra为每次抓取额外执行的回调
+func Handler(r *Registry,extra ...func(*Emitter)) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter,req *http.Request){
+		w.Header().Set("Content-Type","text/plain; version=0.0.4; charset=utf-8")
+		if err := r.Write(w,extra...); err != nil{
+			http.Error(w,err.Error(),http.StatusInternalServerError)
+		}
+	})
+}
+
+//desc 指标的名称、说明和标签名
+type desc struct{
+	name string
+	help string
+	labels []string
+}
+
+//key 把标签值拼成map的键
+func (d *desc) key(values []string) string{
+	if len(values) != len(d.labels){
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",d.name,len(d.labels),len(values)))
+	}
+	return strings.Join(values,"\xff")
+}
+
+//CounterVec 按标签区分的counter
+type CounterVec struct{
+	desc
+	series sync.Map//标签值 -> *counterSeries
+}
+
+type counterSeries struct{
+	values []string
+	bits uint64//float64的位表示，原子更新
+}
+
+//1.Add 给标签值对应的counter增加v
+func (c *CounterVec) Add(v float64,values ...string){
+	key := c.key(values)
+	s,ok := c.series.Load(key)
+	if !ok{
+		s,_ = c.series.LoadOrStore(key,&counterSeries{values: append([]string(nil),values...)})
+	}
+	cs := s.(*counterSeries)
+	for{
+		old := atomic.LoadUint64(&cs.bits)
+		if atomic.CompareAndSwapUint64(&cs.bits,old,math.Float64bits(math.Float64frombits(old)+v)){
+			return
+		}
+	}
+}
+
+//2.Inc 给标签值对应的counter加1
+func (c *CounterVec) Inc(values ...string){
+	c.Add(1,values...)
+}
+
+func (c *CounterVec) emit(e *Emitter){
+	f := e.family(c.name,c.help,"counter")
+	c.series.Range(func(_,s interface{}) bool{
+		cs := s.(*counterSeries)
+		f.add(c.name,pairs(c.labels,cs.values),math.Float64frombits(atomic.LoadUint64(&cs.bits)))
+		return true
+	})
+}
+
+//HistogramVec 按标签区分的histogram
+type HistogramVec struct{
+	desc
+	buckets []float64
+	series sync.Map//标签值 -> *histogramSeries
+}
+
+type histogramSeries struct{
+	mu sync.Mutex
+	values []string
+	counts []uint64//每个桶的计数（不累积）
+	count uint64
+	sum float64
+}
+
+//Observe 记录标签值对应的一次观测
+func (h *HistogramVec) Observe(v float64,values ...string){
+	key := h.key(values)
+	s,ok := h.series.Load(key)
+	if !ok{
+		s,_ = h.series.LoadOrStore(key,&histogramSeries{values: append([]string(nil),values...),counts: make([]uint64,len(h.buckets))})
+	}
+	hs := s.(*histogramSeries)
+	i := sort.SearchFloat64s(h.buckets,v)//第一个>=v的桶
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if i < len(hs.counts){
+		hs.counts[i]++
+	}
+	hs.count++
+	hs.sum += v
+}
+
+func (h *HistogramVec) emit(e *Emitter){
+	f := e.family(h.name,h.help,"histogram")
+	h.series.Range(func(_,s interface{}) bool{
+		hs := s.(*histogramSeries)
+		hs.mu.Lock()
+		defer hs.mu.Unlock()
+
+		labels := pairs(h.labels,hs.values)
+		var cumulative uint64
+		series := formatLabels(labels)
+		for i,upper := range h.buckets{
+			cumulative += hs.counts[i]
+			f.addSeries(series,h.name+"_bucket",append(labels,"le",formatFloat(upper)),float64(cumulative))
+		}
+		f.addSeries(series,h.name+"_bucket",append(labels,"le","+Inf"),float64(hs.count))
+		f.addSeries(series,h.name+"_sum",labels,hs.sum)
+		f.addSeries(series,h.name+"_count",labels,float64(hs.count))
+		return true
+	})
+}
+
+//Emitter 收集一次抓取的所有样本
+type Emitter struct{
+	families map[string]*family
+}
+
+//family 同名指标的样本
+type family struct{
+	help string
+	typ string
+	samples []sample
+}
+
+//sample 一行样本，series为不含le的标签，用于排序（同一个histogram的各行保持输出顺序）
+type sample struct{
+	series string
+	line string
+}
+
+//1.Gauge 输出一个gauge样本，labels为标签名和标签值交替排列
+func (e *Emitter) Gauge(name,help string,value float64,labels ...string){
+	e.family(name,help,"gauge").add(name,labels,value)
+}
+
+//2.Counter 输出一个counter样本（由已有的累计值转换而来），labels为标签名和标签值交替排列
+func (e *Emitter) Counter(name,help string,value float64,labels ...string){
+	e.family(name,help,"counter").add(name,labels,value)
+}
+
+func (e *Emitter) family(name,help,typ string) *family{
+	f,ok := e.families[name]
+	if !ok{
+		f = &family{help: help,typ: typ}
+		e.families[name] = f
+	}
+	return f
+}
+
+func (f *family) add(name string,labels []string,value float64){
+	f.addSeries(formatLabels(labels),name,labels,value)
+}
+
+func (f *family) addSeries(series,name string,labels []string,value float64){
+	f.samples = append(f.samples,sample{
+		series: series,
+		line: name+formatLabels(labels)+" "+formatFloat(value),
+	})
+}
+
+//formatLabels 格式化标签，labels为标签名和标签值交替排列
+func formatLabels(labels []string) string{
+	if len(labels) == 0{
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2{
+		if i > 0{
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+//write 按指标名排序输出
+func (e *Emitter) write(w io.Writer) error{
+	names := make([]string,0,len(e.families))
+	for name,f := range e.families{
+		if len(f.samples) > 0{
+			names = append(names,name)
+		}
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _,name := range names{
+		f := e.families[name]
+		sort.SliceStable(f.samples,func(i,j int) bool{
+			return f.samples[i].series < f.samples[j].series
+		})
+		fmt.Fprintf(bw,"# HELP %s %s\n# TYPE %s %s\n",name,escapeHelp(f.help),name,f.typ)
+		for _,s := range f.samples{
+			bw.WriteString(s.line)
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+//pairs 把标签名和标签值交替排列
+func pairs(names,values []string) []string{
+	labels := make([]string,0,2*len(names))
+	for i,name := range names{
+		labels = append(labels,name,values[i])
+	}
+	return labels
+}
+
+func formatFloat(v float64) string{
+	switch{
+	case math.IsInf(v,1):
+		return "+Inf"
+	case math.IsInf(v,-1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v,'g',-1,64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`,`\\`,"\n",`\n`,`"`,`\"`)
+var helpEscaper = strings.NewReplacer(`\`,`\\`,"\n",`\n`)
+
+func escapeLabel(s string) string{
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string{
+	return helpEscaper.Replace(s)
+}
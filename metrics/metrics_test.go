@@ -0,0 +1,43 @@
+package metrics
+
+import(
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T){
+	r := NewRegistry()
+	requests := r.Counter("app_requests_total","Requests.","op")
+	latency := r.Histogram("app_latency_seconds","Latency.",[]float64{0.1,1},"op")
+	r.Collect(func(e *Emitter){
+		e.Gauge("app_items","Items.",3,"group","a\"b")
+	})
+
+	requests.Inc("get")
+	requests.Add(2,"get")
+	latency.Observe(0.05,"get")
+	latency.Observe(0.5,"get")
+	latency.Observe(5,"get")
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil{
+		t.Fatal(err)
+	}
+	want := `# HELP app_items Items.
+# TYPE app_items gauge
+app_items{group="a\"b"} 3
+# HELP app_latency_seconds Latency.
+# TYPE app_latency_seconds histogram
+app_latency_seconds_bucket{op="get",le="0.1"} 1
+app_latency_seconds_bucket{op="get",le="1"} 2
+app_latency_seconds_bucket{op="get",le="+Inf"} 3
+app_latency_seconds_sum{op="get"} 5.55
+app_latency_seconds_count{op="get"} 3
+# HELP app_requests_total Requests.
+# TYPE app_requests_total counter
+app_requests_total{op="get"} 3
+`
+	if b.String() != want{
+		t.Fatalf("unexpected output:\n%s",b.String())
+	}
+}
@@ -0,0 +1,70 @@
+package mycache
+
+import(
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T){
+	g := NewGroup("metrics-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}))
+	defer DestroyGroup("metrics-test")
+
+	for i := 0; i < 3; i++{
+		if _,err := g.Get(context.Background(),"k"); err != nil{
+			t.Fatal(err)
+		}
+	}
+	g.Get(context.Background(),"")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec,httptest.NewRequest("GET","/metrics",nil))
+	body := rec.Body.String()
+	for _,line := range []string{
+		`mycache_group_requests_total{group="metrics-test",op="get",result="ok"} 3`,
+		`mycache_group_requests_total{group="metrics-test",op="get",result="error"} 1`,
+		`mycache_group_request_duration_seconds_count{group="metrics-test",op="get"} 4`,
+		`mycache_group_loader_hits_total{group="metrics-test"} 1`,
+		`mycache_singleflight_calls_total{group="metrics-test"} 1`,
+		`mycache_store_evictions_total{group="metrics-test"} 0`,
+		"# TYPE mycache_group_request_duration_seconds histogram",
+	}{
+		if !strings.Contains(body,line+"\n"){
+			t.Errorf("missing %q in metrics output",line)
+		}
+	}
+}
+
+//热点key默认不输出到指标，开启后只输出key的哈希
+func TestHotKeyMetrics(t *testing.T){
+	getter := GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	})
+	hidden := NewGroup("metrics-hot-hidden",1<<20,getter)
+	defer DestroyGroup("metrics-hot-hidden")
+	opts := DefaultHotKeyOptions
+	opts.ExportKeys = true
+	exported := NewGroup("metrics-hot-exported",1<<20,getter,WithHotKeys(opts))
+	defer DestroyGroup("metrics-hot-exported")
+
+	for _,g := range []*Group{hidden,exported}{
+		g.Get(context.Background(),"user:alice@example.com")
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec,httptest.NewRequest("GET","/metrics",nil))
+	body := rec.Body.String()
+	if strings.Contains(body,"alice@example.com"){
+		t.Fatal("raw keys must not appear in metrics")
+	}
+	if strings.Contains(body,`mycache_hot_key_rate{group="metrics-hot-hidden"`){
+		t.Fatal("hot keys should not be exported unless ExportKeys is set")
+	}
+	want := `mycache_hot_key_rate{group="metrics-hot-exported",key_hash="`+HotKeyHash("user:alice@example.com")+`"}`
+	if !strings.Contains(body,want){
+		t.Fatalf("missing %q in metrics output",want)
+	}
+}
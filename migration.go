@@ -0,0 +1,231 @@
+package mycache
+
+import(
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+//成员变更时的数据迁移
+//节点加入时，consistenthash.Map.Add会把部分键区间划给新节点，新节点的缓存是空的，
+//如果不做迁移，这些key全部都会打到数据源上。因此：
+//	1.新节点启动后，向每个已知节点拉取（Transfer）现在由自己负责的缓存项
+//	2.双归属窗口内，新节点本地未命中的key先去原主节点查询（Peek），查不到再加载
+//	3.节点离开前（Server.Stop注销之前），把自己负责的缓存项推送（Handoff）给后继节点
+
+const(
+	//migrationRetries 拉取失败时的重试次数（对端可能还没有感知到本节点加入）
+	migrationRetries = 5
+	//migrationBackoff 第一次重试前的等待时间，之后每次翻倍
+	migrationBackoff = time.Second
+	//handoffBatchSize 每次Handoff推送的缓存项数量
+	handoffBatchSize = 256
+)
+
+//migrationPeer 支持数据迁移的peer（Client实现了该接口）
+type migrationPeer interface{
+	Peek(ctx context.Context,group,key string) ([]byte,error)
+	Transfer(ctx context.Context,group,peer string) ([]*pb.Entry,error)
+	Handoff(ctx context.Context,group string,entries []*pb.Entry) (int,error)
+}
+
+//ErrNotOwner 请求方不是所请求缓存项的副本节点（对端的哈希环还没有包含请求方）
+var ErrNotOwner = status.Error(codes.Unavailable,"requesting peer is not in the ring yet")
+
+//1.pullOwnedRanges 从所有已知节点拉取现在由本节点负责的缓存项
+func (g *Group) pullOwnedRanges(){
+	mp,ok := g.peers.(MigrationPicker)
+	if !ok{
+		return
+	}
+
+	for _,addr := range mp.Peers(){
+		backoff := migrationBackoff
+		for attempt := 0; attempt <= migrationRetries; attempt++{
+			n,err := g.pullFrom(mp,addr)
+			if err == nil{
+				if n > 0{
+					logrus.Infof("[mycache] migrated %d entries from %s for group [%s]",n,addr,g.name)
+				}
+				break
+			}
+			if status.Code(err) != codes.Unavailable || attempt == migrationRetries{
+				logrus.Warnf("[mycache] failed to migrate entries from %s for group [%s]: %v",addr,g.name,err)
+				break
+			}
+
+			select{
+			case <-g.stopCh:
+				return
+			case <-time.After(backoff):
+				backoff *= 2
+			}
+		}
+	}
+}
+
+//2.pullFrom 从指定节点拉取现在由本节点负责的缓存项
+func (g *Group) pullFrom(mp MigrationPicker,addr string) (int,error){
+	peer,ok := mp.GetPeer(addr)
+	if !ok{
+		return 0,fmt.Errorf("peer %s not found",addr)
+	}
+	migPeer,ok := peer.(migrationPeer)
+	if !ok{
+		return 0,fmt.Errorf("peer %s does not support migration",addr)
+	}
+
+	ctx,cancel := context.WithTimeout(context.Background(),antiEntropyTimeout)
+	defer cancel()
+
+	entries,err := migPeer.Transfer(ctx,g.name,mp.Self())
+	if err != nil{
+		return 0,err
+	}
+
+	for _,e := range entries{
+		g.storeEntry(e)
+	}
+	atomic.AddInt64(&g.stats.migratedIn,int64(len(entries)))
+	return len(entries),nil
+}
+
+//3.peekPreviousOwner 双归属窗口内，从key在本节点加入前的主节点查询缓存
+func (g *Group) peekPreviousOwner(ctx context.Context,key string) (ByteView,bool){
+	mp,ok := g.peers.(MigrationPicker)
+	if !ok{
+		return ByteView{},false
+	}
+	peer,ok := mp.PreviousOwner(key)
+	if !ok{
+		return ByteView{},false
+	}
+	migPeer,ok := peer.(migrationPeer)
+	if !ok{
+		return ByteView{},false
+	}
+
+	bytes,err := migPeer.Peek(ctx,g.name,key)
+	if err != nil{
+		return ByteView{},false
+	}
+
+	atomic.AddInt64(&g.stats.handoffHits,1)
+	return ByteView{b: bytes},true
+}
+
+//4.handoff 将本节点负责的缓存项推送给本节点离开后的副本节点
+func (g *Group) handoff(ctx context.Context){
+	mp,ok := g.peers.(MigrationPicker)
+	if !ok{
+		return
+	}
+
+	//按目标节点分批
+	self := mp.Self()
+	batches := make(map[string][]*pb.Entry)
+	g.mainCache.Range(func(key string,value ByteView,ttl time.Duration) bool{
+		replicas := mp.Replicas(key)
+		if !containsAddr(replicas,self){
+			return true//本节点不是副本，只是缓存了副本
+		}
+		for _,addr := range mp.Successors(key){
+			if !containsAddr(replicas,addr){
+				batches[addr] = append(batches[addr],newEntry(key,value,ttl))
+			}
+		}//已经是副本的节点不需要推送
+		return true
+	})
+
+	for addr,entries := range batches{
+		peer,ok := mp.GetPeer(addr)
+		if !ok{
+			continue
+		}
+		migPeer,ok := peer.(migrationPeer)
+		if !ok{
+			continue
+		}
+
+		for start := 0; start < len(entries); start += handoffBatchSize{
+			end := min(start+handoffBatchSize,len(entries))
+			n,err := migPeer.Handoff(ctx,g.name,entries[start:end])
+			if err != nil{
+				logrus.Warnf("[mycache] failed to handoff entries to %s for group [%s]: %v",addr,g.name,err)
+				break
+			}
+			atomic.AddInt64(&g.stats.handoffOut,int64(n))
+		}
+	}
+}
+
+//5.ownedEntries 返回本地缓存中由peer负责的缓存项（供Server.Transfer调用）
+func (g *Group) ownedEntries(peer string,fn func(e *pb.Entry) error) error{
+	rp,ok := g.peers.(ReplicaPicker)
+	if !ok{
+		return fmt.Errorf("group %s does not support migration",g.name)
+	}
+	//peer要在本节点的哈希环上，否则Replicas不会返回它，只能返回空结果。
+	//返回ErrNotOwner让新节点稍后重试，直到本节点采用了包含它的拓扑
+	known := containsAddr(rp.Peers(),peer)
+	if ring,ok := g.peers.(RingPicker); ok{
+		known = ring.InRing(peer)
+	}
+	if !known{
+		return ErrNotOwner
+	}
+
+	//先在锁内复制，再在锁外发送，避免慢的接收方一直占用缓存的读锁
+	var entries []*pb.Entry
+	g.mainCache.Range(func(key string,value ByteView,ttl time.Duration) bool{
+		if containsAddr(rp.Replicas(key),peer){
+			entries = append(entries,newEntry(key,value,ttl))
+		}
+		return true
+	})
+
+	for _,e := range entries{
+		if err := fn(e); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+//6.acceptEntries 接收其他节点推送的缓存项（供Server.Handoff调用）
+func (g *Group) acceptEntries(entries []*pb.Entry) int{
+	for _,e := range entries{
+		g.storeEntry(e)
+	}
+	atomic.AddInt64(&g.stats.migratedIn,int64(len(entries)))
+	return len(entries)
+}
+
+//newEntry 将缓存项转换为pb.Entry
+func newEntry(key string,value ByteView,ttl time.Duration) *pb.Entry{
+	ttlMs := ttl.Milliseconds()
+	if ttl > 0 && ttlMs == 0{
+		ttlMs = 1//不足1毫秒的按1毫秒处理，避免被当作永不过期
+	}
+	return &pb.Entry{
+		Key: key,
+		Value: value.ByteSlice(),
+		TtlMs: ttlMs,
+	}
+}
+
+//containsAddr 判断地址列表中是否包含addr
+func containsAddr(addrs []string,addr string) bool{
+	for _,a := range addrs{
+		if a == addr{
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+package mycache
+
+import(
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/Rampage-cd/DistributedCache/store"
+)
+
+//migrationCluster 进程内的集群，节点之间直接调用对方的Group
+type migrationCluster struct{
+	mu sync.Mutex
+	nodes map[string]*migrationNode
+	replicas map[string][]string	//key -> 副本节点，没有配置的key由"old"负责
+	successors map[string][]string	//key -> 离开后的副本节点
+	previous map[string]string		//key -> 加入前的主节点
+}
+
+func newMigrationCluster() *migrationCluster{
+	return &migrationCluster{
+		nodes: make(map[string]*migrationNode),
+		replicas: make(map[string][]string),
+		successors: make(map[string][]string),
+		previous: make(map[string]string),
+	}
+}
+
+func (c *migrationCluster) node(addr string) (*migrationNode,bool){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n,ok := c.nodes[addr]
+	return n,ok
+}
+
+//join 创建节点的缓存组并加入集群，创建时会从其他节点拉取
+func (c *migrationCluster) join(t *testing.T,addr string,getter Getter,opts ...GroupOption) *Group{
+	name := "migration-"+t.Name()+"-"+addr
+	n := &migrationNode{}
+	c.mu.Lock()
+	c.nodes[addr] = n
+	c.mu.Unlock()
+
+	g := NewGroup(name,1<<20,getter,append(opts,WithPeers(&migrationTestPicker{cluster: c,self: addr}))...)
+	c.mu.Lock()
+	n.g = g
+	c.mu.Unlock()
+	t.Cleanup(func(){ DestroyGroup(name) })
+	return g
+}
+
+//migrationTestPicker 实现MigrationPicker，PickPeer总是选中本节点
+type migrationTestPicker struct{
+	cluster *migrationCluster
+	self string
+}
+
+func (p *migrationTestPicker) PickPeer(ctx context.Context,key string) (Peer,bool,bool){ return nil,true,true }
+func (p *migrationTestPicker) Close() error{ return nil }
+func (p *migrationTestPicker) Self() string{ return p.self }
+
+func (p *migrationTestPicker) Replicas(key string) []string{
+	p.cluster.mu.Lock()
+	defer p.cluster.mu.Unlock()
+	if r,ok := p.cluster.replicas[key]; ok{
+		return r
+	}
+	return []string{"old"}
+}
+
+func (p *migrationTestPicker) Successors(key string) []string{
+	p.cluster.mu.Lock()
+	defer p.cluster.mu.Unlock()
+	return p.cluster.successors[key]
+}
+
+func (p *migrationTestPicker) GetPeer(addr string) (Peer,bool){
+	n,ok := p.cluster.node(addr)
+	if !ok || n.g == nil{
+		return nil,false
+	}
+	return n,true
+}
+
+func (p *migrationTestPicker) Peers() []string{
+	p.cluster.mu.Lock()
+	defer p.cluster.mu.Unlock()
+	var addrs []string
+	for addr := range p.cluster.nodes{
+		if addr != p.self{
+			addrs = append(addrs,addr)
+		}
+	}
+	return addrs
+}
+
+func (p *migrationTestPicker) PreviousOwner(key string) (Peer,bool){
+	p.cluster.mu.Lock()
+	addr,ok := p.cluster.previous[key]
+	p.cluster.mu.Unlock()
+	if !ok{
+		return nil,false
+	}
+	return p.GetPeer(addr)
+}
+
+//migrationNode 实现Peer和migrationPeer
+type migrationNode struct{
+	g *Group
+}
+
+func (n *migrationNode) Get(ctx context.Context,group,key string) ([]byte,error){ return nil,nil }
+func (n *migrationNode) Set(ctx context.Context,group,key string,value []byte) error{ return nil }
+func (n *migrationNode) Delete(ctx context.Context,group,key string) (bool,error){ return false,nil }
+func (n *migrationNode) Close() error{ return nil }
+
+func (n *migrationNode) Peek(ctx context.Context,group,key string) ([]byte,error){
+	view,ok := n.g.mainCache.Get(ctx,key)
+	if !ok{
+		return nil,ErrNotOwner
+	}
+	return view.ByteSlice(),nil
+}
+
+func (n *migrationNode) Transfer(ctx context.Context,group,peer string) ([]*pb.Entry,error){
+	var entries []*pb.Entry
+	err := n.g.ownedEntries(peer,func(e *pb.Entry) error{
+		entries = append(entries,e)
+		return nil
+	})
+	return entries,err
+}
+
+func (n *migrationNode) Handoff(ctx context.Context,group string,entries []*pb.Entry) (int,error){
+	return n.g.acceptEntries(entries),nil
+}
+
+//countingGetter 记录数据源被访问的次数
+func countingGetter(calls *int64) Getter{
+	return GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		atomic.AddInt64(calls,1)
+		return []byte("source:"+key),nil
+	})
+}
+
+func TestMigrationPullOnJoin(t *testing.T){
+	c := newMigrationCluster()
+	var loads int64
+	old := c.join(t,"old",countingGetter(&loads))
+	for _,key := range []string{"a","b","c"}{
+		old.mainCache.Add(key,ByteView{b: []byte("old:"+key)})
+	}
+
+	//新节点负责a和b
+	c.mu.Lock()
+	c.replicas["a"] = []string{"new"}
+	c.replicas["b"] = []string{"new","old"}
+	c.mu.Unlock()
+	joined := c.join(t,"new",countingGetter(&loads))
+
+	deadline := time.Now().Add(5*time.Second)
+	for atomic.LoadInt64(&joined.stats.migratedIn) < 2{
+		if time.Now().After(deadline){
+			t.Fatal("new node did not pull its ranges")
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+	for _,key := range []string{"a","b"}{
+		view,err := joined.Get(context.Background(),key)
+		if err != nil || view.String() != "old:"+key{
+			t.Fatalf("%s should have been migrated, got %q, %v",key,view.String(),err)
+		}
+	}
+	if cached(joined,"c"){
+		t.Fatal("c is not owned by the new node")
+	}
+	if atomic.LoadInt64(&loads) != 0{
+		t.Fatal("migrated keys should not hit the data source")
+	}
+}
+
+func TestMigrationPreviousOwner(t *testing.T){
+	c := newMigrationCluster()
+	var loads int64
+	old := c.join(t,"old",countingGetter(&loads))
+	old.mainCache.Add("d",ByteView{b: []byte("old:d")})
+	joined := c.join(t,"new",countingGetter(&loads))
+
+	//d在新节点加入前由old负责，还没有迁移过来
+	c.mu.Lock()
+	c.previous["d"] = "old"
+	c.previous["e"] = "old"
+	c.mu.Unlock()
+
+	view,err := joined.Get(context.Background(),"d")
+	if err != nil || view.String() != "old:d"{
+		t.Fatalf("expected the previous owner's value, got %q, %v",view.String(),err)
+	}
+	if atomic.LoadInt64(&loads) != 0 || atomic.LoadInt64(&joined.stats.handoffHits) != 1{
+		t.Fatal("the previous owner should have served d")
+	}
+
+	//原主节点也没有时从数据源加载
+	view,err = joined.Get(context.Background(),"e")
+	if err != nil || view.String() != "source:e" || atomic.LoadInt64(&loads) != 1{
+		t.Fatalf("expected e to be loaded from the source, got %q, %v",view.String(),err)
+	}
+}
+
+func TestMigrationHandoffOnLeave(t *testing.T){
+	c := newMigrationCluster()
+	var loads int64
+	old := c.join(t,"old",countingGetter(&loads))
+	successor := c.join(t,"next",countingGetter(&loads))
+
+	old.mainCache.Add("a",ByteView{b: []byte("old:a")})
+	old.mainCache.Add("b",ByteView{b: []byte("old:b")})
+	old.mainCache.Add("cached",ByteView{b: []byte("copy")})
+	c.mu.Lock()
+	c.successors["a"] = []string{"next"}
+	c.successors["b"] = []string{"next"}
+	c.replicas["cached"] = []string{"next"}//old只是缓存了副本
+	c.mu.Unlock()
+
+	old.handoff(context.Background())
+
+	if n := atomic.LoadInt64(&old.stats.handoffOut); n != 2{
+		t.Fatalf("expected 2 entries handed off, got %d",n)
+	}
+	for _,key := range []string{"a","b"}{
+		if !cached(successor,key){
+			t.Fatalf("%s should have been handed off",key)
+		}
+	}
+	if cached(successor,"cached"){
+		t.Fatal("entries the leaving node does not own should not be handed off")
+	}
+}
+
+func TestOwnedEntriesReleasesLock(t *testing.T){
+	c := newMigrationCluster()
+	opts := DefaultCacheOptions()
+	opts.CacheType = store.LRU
+	old := c.join(t,"old",GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return nil,nil
+	}),WithCacheOptions(opts))
+	old.mainCache.Add("a",ByteView{b: []byte("1")})
+	old.mainCache.Add("b",ByteView{b: []byte("2")})
+	c.join(t,"new",GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return nil,nil
+	}))
+	c.mu.Lock()
+	c.replicas["a"] = []string{"new"}
+	c.replicas["b"] = []string{"new"}
+	c.mu.Unlock()
+
+	//接收方很慢时，写入和清空不能被阻塞
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	go old.ownedEntries("new",func(e *pb.Entry) error{
+		select{
+		case sending <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	})
+	<-sending
+	defer close(release)
+
+	done := make(chan struct{})
+	go func(){
+		old.mainCache.Add("c",ByteView{b: []byte("3")})
+		old.Clear()
+		close(done)
+	}()
+	select{
+	case <-done:
+	case <-time.After(2*time.Second):
+		t.Fatal("cache writes are blocked by a slow transfer")
+	}
+}
+
+//cached 本地缓存中是否有该key
+func cached(g *Group,key string) bool{
+	_,ok := g.mainCache.Get(context.Background(),key)
+	return ok
+}
@@ -4,7 +4,7 @@ import(
 	"context"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,17 +16,76 @@ import(
 
 const defaultSvcName = "my-cache"
 
+//defaultHandoffWindow 默认的双归属窗口
+const defaultHandoffWindow = 30*time.Second
+
 //PeerPicker 定义了peer选择器的接口
 type PeerPicker interface{
-	PickPeer(key string) (peer Peer,ok bool,self bool)
+	PickPeer(ctx context.Context,key string) (peer Peer,ok bool,self bool)
 	Close() error
 }
 
+//ReplicaPicker 由支持多副本放置的PeerPicker实现
+type ReplicaPicker interface{
+	//Replicas 返回key的副本节点地址，第一个为主节点
+	Replicas(key string) []string
+	//GetPeer 根据地址返回对应的peer
+	GetPeer(addr string) (Peer,bool)
+	//Self 返回本节点地址
+	Self() string
+	//Peers 返回除本节点外所有已知节点的地址
+	Peers() []string
+}
+
+//MigrationPicker 由支持成员变更时数据迁移的PeerPicker实现
+type MigrationPicker interface{
+	ReplicaPicker
+	//PreviousOwner 本节点加入集群后的双归属窗口内，返回key在本节点加入前的主节点
+	PreviousOwner(key string) (Peer,bool)
+	//Successors 返回本节点离开集群后key的副本节点地址
+	Successors(key string) []string
+}
+
+//LoadReleaser 由按负载选择节点的PeerPicker实现
+//PickPeer选中节点（包括本节点）后会计入该节点的负载，请求结束后必须调用Release释放
+type LoadReleaser interface{
+	//Release 释放PickPeer返回的peer的负载，peer为nil表示本节点
+	Release(peer Peer)
+}
+
+//TopologyPicker 由使用集群统一哈希环的PeerPicker实现
+type TopologyPicker interface{
+	//Epoch 返回当前哈希环的纪元
+	Epoch() uint64
+	//ObserveEpoch 收到其他节点的纪元，比本地新时应尽快更新哈希环
+	ObserveEpoch(epoch uint64)
+}
+
+//RingPicker 由区分已知节点和哈希环成员的PeerPicker实现
+//采用集群拓扑后，新发现的节点要等到新纪元的拓扑才会加入哈希环，在此之前Replicas不会返回它
+type RingPicker interface{
+	//InRing 返回节点是否在本节点当前的哈希环上
+	InRing(addr string) bool
+}
+
+//NodeInfoPicker 由保存了节点注册信息的PeerPicker实现
+type NodeInfoPicker interface{
+	//NodeInfo 返回节点的注册信息
+	NodeInfo(addr string) (registry.Node,bool)
+}
+
+//PeerStatsPicker 由跟踪节点健康状况的PeerPicker实现
+type PeerStatsPicker interface{
+	//PeerStats 返回各节点的断路器状态和重试预算
+	PeerStats() map[string]interface{}
+}
+
 //Peer 定义了缓存节点的接口
+//所有操作都接收调用方的ctx，ctx的截止时间（剩余的超时预算）、取消和元数据会随请求传给对端
 type Peer interface{
-	Get(group string,key string) ([]byte,error)
+	Get(ctx context.Context,group string,key string) ([]byte,error)
 	Set(ctx context.Context,group string,key string,value []byte) error
-	Delete(group string,key string) (bool,error)
+	Delete(ctx context.Context,group string,key string) (bool,error)
 	Close() error
 }
 
@@ -34,14 +93,44 @@ type Peer interface{
 type ClientPicker struct{
 	selfAddr string
 	svcName string
+	replicas int				//每个key的副本数（以集群拓扑为准）
+	configuredReplicas int		//本节点配置的副本数，只在第一次发布拓扑时生效
+	joinedAt time.Time			//本节点加入集群的时间
+	handoffWindow time.Duration	//双归属窗口，窗口内本地未命中的key会先转发给原主节点
 	mu sync.RWMutex
-	consHash *consistenthash.Map
+	partitioner consistenthash.Partitioner	//分区器，默认为带虚拟节点的一致性哈希
+	ring map[string]registry.Member	//哈希环上的节点及其权重、可用区和机架
+	zone string					//本节点所在的可用区，读请求优先选择同可用区的副本
+	localityAware bool			//哈希环上是否有节点带可用区/机架标签
+	epoch uint64				//哈希环的纪元（原子变量）
+	publishCh chan struct{}		//通知发布新拓扑
+	refreshCh chan struct{}		//通知重新读取拓扑
+	leader Leader				//集群leader的判断，设置后只有leader发布拓扑
+	tls *PeerTLS				//节点之间的mTLS，为nil时不使用TLS
+	peerToken string			//访问其他节点使用的内部token
+	breakerOpts BreakerOptions	//断路器、重试和摘除的配置
+	retryBudget *retryBudget	//所有节点共用的重试预算
 	clients map[string]*Client
-	etcdCli *clientv3.Client
+	nodes map[string]registry.Node	//节点的注册信息
+	discovery registry.Discovery	//服务发现，默认基于etcd
+	topology registry.TopologyStore	//集群拓扑的存储，服务发现不支持时为nil（各节点各自构建哈希环）
+	ownsDiscovery bool			//服务发现是否由picker创建（关闭时一并关闭）
+	etcdCli *clientv3.Client	//共享的etcd客户端（使用默认的etcd服务发现时）
+	etcdConfig *registry.Config	//创建etcd客户端的配置，也用于服务发现请求的超时
 	ctx context.Context
 	cancel context.CancelFunc
 }
 
+//编译期接口断言
+var _ PeerPicker = (*ClientPicker)(nil)
+var _ ReplicaPicker = (*ClientPicker)(nil)
+var _ MigrationPicker = (*ClientPicker)(nil)
+var _ LoadReleaser = (*ClientPicker)(nil)
+var _ TopologyPicker = (*ClientPicker)(nil)
+var _ RingPicker = (*ClientPicker)(nil)
+var _ NodeInfoPicker = (*ClientPicker)(nil)
+var _ PeerStatsPicker = (*ClientPicker)(nil)
+
 //PickerOption 定义配置选项
 type PickerOption func(*ClientPicker)
 
@@ -52,14 +141,106 @@ func WithServiceName(name string) PickerOption{
 	}
 }
 
+//WithReplicas 设置每个key的副本数（包括主节点）
+func WithReplicas(n int) PickerOption{
+	return func(p *ClientPicker){
+		if n > 0{
+			p.replicas = n
+			p.configuredReplicas = n
+		}
+	}
+}
+
+//WithPartitioner 设置分区器（如consistenthash.NewRendezvous()、consistenthash.NewMaglev(0)）
+func WithPartitioner(partitioner consistenthash.Partitioner) PickerOption{
+	return func(p *ClientPicker){
+		p.partitioner = partitioner
+	}
+}
+
+//WithZone 设置本节点所在的可用区（不设置时使用本节点注册的可用区）
+func WithZone(zone string) PickerOption{
+	return func(p *ClientPicker){
+		p.zone = zone
+	}
+}
+
+//WithDiscoveryConfig 设置服务发现使用的etcd配置（端点、TLS、认证、key前缀、超时），应与Server使用相同的配置
+func WithDiscoveryConfig(config *registry.Config) PickerOption{
+	return func(p *ClientPicker){
+		if config != nil{
+			p.etcdConfig = config
+		}
+	}
+}
+
+//WithDiscoveryClient 使用共享的etcd客户端（如与Server共用一个客户端），关闭picker时不会关闭该客户端
+func WithDiscoveryClient(cli *clientv3.Client) PickerOption{
+	return func(p *ClientPicker){
+		p.etcdCli = cli
+	}
+}
+
+//WithDiscovery 设置服务发现（如registry.NewStaticDiscovery、registry.NewFileDiscovery），应与Server使用相同的服务发现
+//设置后忽略WithDiscoveryConfig和WithDiscoveryClient，关闭picker时不会关闭该服务发现
+func WithDiscovery(d registry.Discovery) PickerOption{
+	return func(p *ClientPicker){
+		p.discovery = d
+	}
+}
+
+//WithLeader 只由集群leader发布拓扑（如传入使用etcd服务发现的Server），其他节点只读取和监听拓扑
+func WithLeader(l Leader) PickerOption{
+	return func(p *ClientPicker){
+		p.leader = l
+	}
+}
+
+//WithPeerTLS 访问其他节点时使用mTLS，应与Server的WithMutualTLS使用相同的证书配置
+func WithPeerTLS(t *PeerTLS) PickerOption{
+	return func(p *ClientPicker){
+		p.tls = t
+	}
+}
+
+//WithPeerToken 访问其他节点时携带内部角色的token（对应TokenAuthenticator.AddPeerToken），需要同时使用WithPeerTLS
+func WithPeerToken(token string) PickerOption{
+	return func(p *ClientPicker){
+		p.peerToken = token
+	}
+}
+
+//WithBreakerOptions 设置断路器、重试和异常节点摘除的配置，FailureThreshold为0时不开启
+func WithBreakerOptions(opts BreakerOptions) PickerOption{
+	return func(p *ClientPicker){
+		p.breakerOpts = opts
+	}
+}
+
+//WithHandoffWindow 设置本节点加入集群后的双归属窗口，0表示不开启
+func WithHandoffWindow(d time.Duration) PickerOption{
+	return func(p *ClientPicker){
+		p.handoffWindow = d
+	}
+}
+
 //NewClientPicker 创建新的ClientPicker实例
 func NewClientPicker(addr string,opts ...PickerOption) (*ClientPicker,error){
 	ctx,cancel := context.WithCancel(context.Background())//创建一个可主动取消的子context
 	picker := &ClientPicker{
 		selfAddr: addr,
 		svcName: defaultSvcName,
+		replicas: 1,
+		configuredReplicas: 1,
+		joinedAt: time.Now(),
+		handoffWindow: defaultHandoffWindow,
 		clients: make(map[string]*Client),
-		consHash: consistenthash.New(),
+		nodes: make(map[string]registry.Node),
+		ring: make(map[string]registry.Member),
+		publishCh: make(chan struct{},1),
+		refreshCh: make(chan struct{},1),
+		etcdConfig: registry.DefaultConfig,
+		breakerOpts: DefaultBreakerOptions,
 		ctx: ctx,
 		cancel: cancel,
 	}
@@ -67,21 +248,50 @@ func NewClientPicker(addr string,opts ...PickerOption) (*ClientPicker,error){
 	for _,opt := range opts{
 		opt(picker)
 	}
-
-	cli,err := clientv3.New(clientv3.Config{
-		Endpoints:     registry.DefaultConfig.Endpoints,
-		DialTimeout:   registry.DefaultConfig.DialTimeout,
-	})
-	if err != nil{
+	if picker.peerToken != "" && picker.tls == nil{
 		cancel()
-		return nil,fmt.Errorf("failed to create etcd client: %v",err)
+		return nil,ErrTokenWithoutTLS
+	}
+	if picker.partitioner == nil{
+		picker.partitioner = consistenthash.New()
+	}
+	picker.retryBudget = newRetryBudget(&picker.breakerOpts)
+
+	//拿到集群拓扑之前，本节点也是哈希环的成员，否则PickPeer永远不会选中自己
+	picker.partitioner.Add(addr)
+	picker.ring[addr] = registry.Member{Addr: addr,Weight: 1,Zone: picker.zone}
+
+	//没有指定服务发现时使用etcd（没有共享的etcd客户端时按配置创建）
+	switch{
+	case picker.discovery != nil:
+	case picker.etcdCli != nil:
+		picker.discovery = registry.NewEtcdDiscovery(picker.etcdCli,picker.etcdConfig)
+	default:
+		d,err := registry.DialEtcdDiscovery(picker.etcdConfig)
+		if err != nil{
+			cancel()
+			return nil,err
+		}
+		picker.discovery = d
+		picker.ownsDiscovery = true
+	}
+	picker.topology,_ = picker.discovery.(registry.TopologyStore)
+
+	//成为leader时按当前的成员列表发布拓扑
+	if picker.leader != nil{
+		picker.leader.OnLeaderChange(func(leader bool,token int64){
+			if leader{
+				picker.triggerPublish()
+			}
+		})
 	}
-	picker.etcdCli = cli
 
 	//启动服务发现
 	if err := picker.startServiceDiscovery(); err != nil{
 		cancel()
-		cli.Close()
+		if picker.ownsDiscovery{
+			picker.discovery.Close()
+		}
 		return nil,err
 	}
 
@@ -108,43 +318,54 @@ func (p *ClientPicker) startServiceDiscovery() error{
 
 	//启动增量更新
 	go p.watchServiceChanges()
+	//发布并监听集群拓扑
+	if p.topology != nil{
+		go p.topologyLoop()
+	}
 	return nil
 }
 
 //3.watchServiceChanges 监听服务实例变化
 func (p *ClientPicker) watchServiceChanges(){
-	watcher := clientv3.NewWatcher(p.etcdCli)//Watcher接口实例化,复用client中的gRPC连接
-	watchChan := watcher.Watch(p.ctx,"/services/"+p.svcName,clientv3.WithPrefix())//开始监听
-	//WatchChan是一个只读channel，元素类型是WatchResponse
+	watchChan := p.discovery.Watch(p.ctx,p.svcName)//ctx取消后关闭
 	for{
 		select{
 		case <-p.ctx.Done():
-			watcher.Close()
 			return
-		case resp := <-watchChan:
-			p.handleWatchEvents(resp.Events)
+		case events,ok := <-watchChan:
+			if !ok{
+				return
+			}
+			p.handleWatchEvents(events)
 		}
 	}
 }
 
 //4.handleWatchEvents 处理监听到的事件
-func (p *ClientPicker) handleWatchEvents(events []*clientv3.Event){
+func (p *ClientPicker) handleWatchEvents(events []registry.Event){
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for _,event := range events{
-		addr := string(event.Kv.Value)
-		if addr == p.selfAddr{
-			continue
-		}
+	//成员变化（包括本节点）后发布新的拓扑
+	if len(events) > 0{
+		p.triggerPublish()
+	}
 
+	for _,event := range events{
 		switch event.Type{
-		case clientv3.EventTypePut:
-			if _,exists := p.clients[addr]; !exists{
-				p.set(addr)
-				logrus.Infof("New service discovered at %s",addr)
+		case registry.EventPut:
+			node := event.Node
+			if node.Addr == p.selfAddr{
+				continue
 			}
-		case clientv3.EventTypeDelete:
+			if _,exists := p.clients[node.Addr]; !exists{
+				p.set(node)
+				logrus.Infof("New service discovered at %s",node.Addr)
+			}else{
+				p.nodes[node.Addr] = node//节点重新注册（如重启），更新注册信息
+			}
+		case registry.EventDelete:
+			addr := event.Node.Addr
 			if client,exists := p.clients[addr]; exists{
 				client.Close()
 				p.remove(addr)
@@ -156,31 +377,52 @@ func (p *ClientPicker) handleWatchEvents(events []*clientv3.Event){
 
 //5.fetchAllServices 获取所有服务实例
 func (p *ClientPicker) fetchAllServices() error{
-	ctx,cancel := context.WithTimeout(p.ctx,3*time.Second)
+	ctx,cancel := context.WithTimeout(p.ctx,p.etcdConfig.Timeout())
 	defer cancel()
 
-	resp, err := p.etcdCli.Get(ctx,"/services/"+p.svcName,clientv3.WithPrefix())
+	nodes,err := p.discovery.List(ctx,p.svcName)
 	if err != nil{
-		return fmt.Errorf("failed to get all services: %v",err)
+		return err
 	}
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	for _,kv := range resp.Kvs{
-		addr := string(kv.Value)
-		if addr != "" && addr != p.selfAddr{
-			p.set(addr)
-			logrus.Infof("Discovered service at %s",addr)
+	for _,node := range nodes{
+		if node.Addr != p.selfAddr{
+			p.set(node)
+			logrus.Infof("Discovered service at %s",node.Addr)
 		}
 	}
 	return nil
 }
 
 //6.set 添加服务实例
-func (p *ClientPicker) set(addr string){
-	if client,err := NewClient(addr,p.svcName,p.etcdCli); err == nil{
-		p.consHash.Add(addr)
+func (p *ClientPicker) set(node registry.Node){
+	addr := node.Addr
+	if node.Version != 0 && node.Version != registry.ProtocolVersion{
+		logrus.Warnf("Service %s (%s) uses protocol version %d, local version is %d",addr,node.ID,node.Version,registry.ProtocolVersion)
+	}
+	var opts []ClientOption
+	if p.tls != nil{
+		opts = append(opts,WithTransportCredentials(p.tls.ClientCredentials(node)))//校验对端证书与注册的节点身份一致
+	}
+	if p.peerToken != ""{
+		opts = append(opts,WithBearerToken(p.peerToken))
+	}
+	if client,err := NewClient(addr,p.svcName,p.etcdCli,opts...); err == nil{
+		p.nodes[addr] = node
+		client.epoch = p.Epoch
+		if p.breakerOpts.FailureThreshold > 0{
+			client.health = &peerHealth{
+				opts: &p.breakerOpts,
+				breaker: newCircuitBreaker(&p.breakerOpts),
+				budget: p.retryBudget,
+			}
+		}
+		if p.Epoch() == 0{//拿到集群拓扑之后，哈希环只由拓扑决定
+			p.addToRing(node.Member())
+		}
 		p.clients[addr] = client
 		logrus.Infof("Successfully created client for %s",addr)
 	}else{
@@ -188,26 +430,220 @@ func (p *ClientPicker) set(addr string){
 	}
 }
 
+//addToRing 按权重把节点加入哈希环（分区器不支持权重时忽略权重，调用方需持有写锁）
+func (p *ClientPicker) addToRing(m registry.Member){
+	if wp,ok := p.partitioner.(consistenthash.WeightedPartitioner); ok{
+		wp.AddWithWeight(m.Addr,max(m.Weight,1))
+	}else{
+		p.partitioner.Add(m.Addr)
+	}
+	p.ring[m.Addr] = m
+	p.updateLocality()
+}
+
 //7.remove 移除服务实例
 func (p *ClientPicker) remove(addr string){
-	p.consHash.Remove(addr)
+	if p.Epoch() == 0{
+		p.partitioner.Remove(addr)
+		delete(p.ring,addr)
+		p.updateLocality()
+	}
 	delete(p.clients,addr)
+	delete(p.nodes,addr)
 }
 
 //8.PickPeer 选择peer节点
-func (p *ClientPicker) PickPeer(key string) (Peer,bool,bool){
+//带可用区标签时优先选择同可用区的副本；断路器打开的节点暂时摘除；分区器支持有界负载时，主节点超载会选择哈希环上的下一个节点，并计入所选节点的负载
+func (p *ClientPicker) PickPeer(ctx context.Context,key string) (Peer,bool,bool){
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	if addr := p.consHash.Get(key); addr != ""{
+	bounded,isBounded := p.partitioner.(consistenthash.BoundedPartitioner)
+	addr := p.localReplica(key)//优先选择同可用区的副本
+	switch{
+	case addr != "" && isBounded:
+		bounded.AcquireNode(addr)
+	case addr != "":
+	case isBounded:
+		addr = bounded.Acquire(key)
+	default:
+		addr = p.partitioner.Get(key)
+	}
+
+	//主节点被摘除时选择哈希环上的下一个节点
+	if addr != "" && p.ejected(addr){
+		if alt := p.fallback(key,addr); alt != ""{
+			if isBounded{
+				bounded.Done(addr)
+				bounded.AcquireNode(alt)
+			}
+			addr = alt
+		}
+	}
+
+	if addr != ""{
+		if addr == p.selfAddr{
+			return nil,true,true
+		}
 		if client,ok := p.clients[addr]; ok{
 			return client,true,addr ==  p.selfAddr
 		}
+		if isBounded{
+			bounded.Done(addr)
+		}
 	}
 	return nil,false,false
 }
 
-//9.Close 关闭所有资源
+//ejected 判断节点是否被摘除（调用方需持有读锁），被摘除的节点超过MaxEjectionPercent时不再摘除（至少允许摘除一个）
+func (p *ClientPicker) ejected(addr string) bool{
+	client,ok := p.clients[addr]
+	if !ok || client.health == nil || !client.health.breaker.ejected(){
+		return false
+	}
+
+	count := 0
+	for _,c := range p.clients{
+		if c.health != nil && c.health.breaker.ejected(){
+			count++
+		}
+	}
+	return count <= 1 || count*100 <= len(p.clients)*p.breakerOpts.MaxEjectionPercent//至少允许摘除一个节点
+}
+
+//fallback 返回哈希环上skip之后第一个没有被摘除的节点（调用方需持有读锁）
+func (p *ClientPicker) fallback(key,skip string) string{
+	for _,addr := range p.partitioner.GetN(key,len(p.ring)){
+		if addr == skip{
+			continue
+		}
+		if addr == p.selfAddr{
+			return addr
+		}
+		if client,ok := p.clients[addr]; ok && (client.health == nil || !client.health.breaker.ejected()){
+			return addr
+		}
+	}
+	return ""
+}
+
+//PeerStats 返回各节点的断路器状态和重试预算
+func (p *ClientPicker) PeerStats() map[string]interface{}{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	breakers := make(map[string]interface{},len(p.clients))
+	for addr,client := range p.clients{
+		if client.health != nil{
+			breakers[addr] = client.health.breaker.stats()
+		}
+	}
+	return map[string]interface{}{
+		"breakers": breakers,
+		"retry_budget": p.retryBudget.stats(),
+	}
+}
+
+//Release 释放PickPeer选中的节点的负载
+func (p *ClientPicker) Release(peer Peer){
+	bounded,ok := p.partitioner.(consistenthash.BoundedPartitioner)
+	if !ok{
+		return
+	}
+
+	addr := p.selfAddr
+	if peer != nil{//按地址释放，PickPeer返回的peer都带有地址
+		ap,ok := peer.(interface{ Addr() string })
+		if !ok{
+			return
+		}
+		addr = ap.Addr()
+	}
+	bounded.Done(addr)
+}
+
+//9.Replicas 返回key的副本节点地址（第一个为主节点）
+func (p *ClientPicker) Replicas(key string) []string{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.placement(key,p.replicas,"")
+}
+
+//10.GetPeer 根据地址返回对应的peer
+func (p *ClientPicker) GetPeer(addr string) (Peer,bool){
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	client,ok := p.clients[addr]
+	if !ok{
+		return nil,false
+	}
+	return client,true
+}
+
+//NodeInfo 返回节点的注册信息
+func (p *ClientPicker) NodeInfo(addr string) (registry.Node,bool){
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	node,ok := p.nodes[addr]
+	return node,ok
+}
+
+//11.Self 返回本节点地址
+func (p *ClientPicker) Self() string{
+	return p.selfAddr
+}
+
+//12.Peers 返回除本节点外所有已知节点的地址
+func (p *ClientPicker) Peers() []string{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	addrs := make([]string,0,len(p.clients))
+	for addr := range p.clients{
+		addrs = append(addrs,addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+//InRing 返回节点是否在当前的哈希环上
+func (p *ClientPicker) InRing(addr string) bool{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	_,ok := p.ring[addr]
+	return ok
+}
+
+//13.PreviousOwner 双归属窗口内返回key在本节点加入前的主节点
+func (p *ClientPicker) PreviousOwner(key string) (Peer,bool){
+	if time.Since(p.joinedAt) >= p.handoffWindow{
+		return nil,false
+	}
+
+	//移除本节点后，原本属于本节点的key会落到GetN返回的第二个节点上（一致性哈希和Rendezvous严格成立，Maglev近似成立），
+	//因此当本节点是主节点时，第二个节点就是加入前的主节点
+	p.mu.RLock()
+	nodes := p.partitioner.GetN(key,2)
+	p.mu.RUnlock()
+	if len(nodes) < 2 || nodes[0] != p.selfAddr{
+		return nil,false
+	}
+	return p.GetPeer(nodes[1])
+}
+
+//14.Successors 返回本节点离开集群后key的副本节点地址
+func (p *ClientPicker) Successors(key string) []string{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.placement(key,p.replicas,p.selfAddr)
+}
+
+//15.Close 关闭所有资源
 func (p *ClientPicker) Close() error{
 	p.cancel()
 	p.mu.Lock()
@@ -220,8 +656,10 @@ func (p *ClientPicker) Close() error{
 		}
 	}
 
-	if err := p.etcdCli.Close(); err != nil{
-		errs = append(errs,fmt.Errorf("failed to close etcd client: %v",err))
+	if p.ownsDiscovery{
+		if err := p.discovery.Close(); err != nil{
+			errs = append(errs,fmt.Errorf("failed to close discovery: %v",err))
+		}
 	}
 
 	if len(errs) > 0{
@@ -229,12 +667,3 @@ func (p *ClientPicker) Close() error{
 	}
 	return nil
 }
-
-//parseAddrFromKey 从etcd key中解析地址
-func parseAddrFromKey(key, svcName string) string{
-	prefix := fmt.Sprintf("/services/%s/",svcName)
-	if strings.HasPrefix(key,prefix){
-		return strings.TrimPrefix(key,prefix)//是否有前缀，有前缀的前提下，去掉前缀
-	}
-	return ""
-}
\ No newline at end of file
@@ -0,0 +1,44 @@
+package mycache
+
+import(
+	"context"
+	"testing"
+
+	"github.com/Rampage-cd/DistributedCache/consistenthash"
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+//addrPeer 带地址的Peer（不是*Client）
+type addrPeer struct{
+	invalidationPeer
+	addr string
+}
+
+func (p *addrPeer) Addr() string{ return p.addr }
+
+func TestClientPickerRelease(t *testing.T){
+	ring := consistenthash.New()
+	picker,err := NewClientPicker("self",WithDiscovery(registry.NewStaticDiscovery("self")),WithPartitioner(ring))
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer picker.Close()
+
+	if _,ok,self := picker.PickPeer(context.Background(),"k"); !ok || !self{
+		t.Fatal("the only node should pick itself")
+	}
+	if ring.GetStats()["self"] != 1{
+		t.Fatalf("the pick should be counted on self: %v",ring.GetStats())
+	}
+
+	//其他类型的Peer按地址释放，没有地址时不能释放本节点的负载
+	picker.Release(&invalidationPeer{})
+	picker.Release(&addrPeer{addr: "other"})
+	if ring.GetStats()["self"] != 1{
+		t.Fatalf("releasing other peers should not lower self's load: %v",ring.GetStats())
+	}
+	picker.Release(&addrPeer{addr: "self"})
+	if len(ring.GetStats()) != 0{
+		t.Fatalf("expected no load after release, got %v",ring.GetStats())
+	}
+}
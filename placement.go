@@ -0,0 +1,103 @@
+package mycache
+
+import(
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+//按可用区/机架放置副本
+//节点注册时可以带上可用区和机架标签（registry.WithLocality），哈希环上有标签时：
+//	1.主节点仍然是哈希环上的第一个节点，其余副本沿哈希环依次优先选择新的可用区、新的机架，最后按哈希环顺序补齐
+//	2.读请求优先选择与本节点同可用区的副本，减少跨可用区的流量
+//所有节点都没有标签时退化为沿哈希环选择，与原来的行为一致
+
+//placeReplicas 从按哈希环顺序排列的候选节点中选出n个副本，第一个为主节点
+func placeReplicas(candidates []string,n int,ring map[string]registry.Member) []string{
+	if len(candidates) <= n{
+		return candidates
+	}
+
+	replicas := make([]string,0,n)
+	chosen := make(map[string]bool,n)
+	zones := make(map[string]bool)
+	racks := make(map[string]bool)
+	choose := func(addr string){
+		m := ring[addr]
+		replicas = append(replicas,addr)
+		chosen[addr] = true
+		zones[m.Zone] = true
+		racks[m.Zone+"/"+m.Rack] = true
+	}
+	choose(candidates[0])
+
+	//依次按新的可用区、新的机架、哈希环顺序选择
+	distinct := []func(m registry.Member) bool{
+		func(m registry.Member) bool{ return !zones[m.Zone] },
+		func(m registry.Member) bool{ return !racks[m.Zone+"/"+m.Rack] },
+		func(m registry.Member) bool{ return true },
+	}
+	for _,accept := range distinct{
+		for _,addr := range candidates[1:]{
+			if len(replicas) >= n{
+				return replicas
+			}
+			if !chosen[addr] && accept(ring[addr]){
+				choose(addr)
+			}
+		}
+	}
+	return replicas
+}
+
+//1.updateLocality 哈希环成员变化后重新判断是否启用按可用区放置（调用方需持有写锁）
+func (p *ClientPicker) updateLocality(){
+	p.localityAware = false
+	for _,m := range p.ring{
+		if m.Zone != "" || m.Rack != ""{
+			p.localityAware = true
+			return
+		}
+	}
+}
+
+//2.placement 返回key的n个副本节点，exclude不为空时排除该节点（调用方需持有读锁）
+func (p *ClientPicker) placement(key string,n int,exclude string) []string{
+	var candidates []string
+	if p.localityAware{
+		candidates = p.partitioner.GetN(key,len(p.ring))
+	}else{
+		candidates = p.partitioner.GetN(key,n+1)
+	}
+
+	if exclude != ""{
+		filtered := candidates[:0:0]
+		for _,addr := range candidates{
+			if addr != exclude{
+				filtered = append(filtered,addr)
+			}
+		}
+		candidates = filtered
+	}
+
+	if !p.localityAware{
+		return candidates[:min(n,len(candidates))]
+	}
+	return placeReplicas(candidates,n,p.ring)
+}
+
+//3.localReplica 返回key在本节点所在可用区的副本，本节点是副本时返回本节点（调用方需持有读锁）
+func (p *ClientPicker) localReplica(key string) string{
+	if p.zone == "" || !p.localityAware{
+		return ""
+	}
+
+	replicas := p.placement(key,p.replicas,"")
+	if containsAddr(replicas,p.selfAddr){
+		return p.selfAddr
+	}
+	for _,addr := range replicas{
+		if p.ring[addr].Zone == p.zone{
+			return addr
+		}
+	}
+	return ""
+}
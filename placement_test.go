@@ -0,0 +1,44 @@
+package mycache
+
+import(
+	"testing"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+func TestPlaceReplicas(t *testing.T){
+	ring := map[string]registry.Member{
+		"a": {Addr: "a",Zone: "z1",Rack: "r1"},
+		"b": {Addr: "b",Zone: "z1",Rack: "r1"},
+		"c": {Addr: "c",Zone: "z1",Rack: "r2"},
+		"d": {Addr: "d",Zone: "z2",Rack: "r1"},
+		"e": {Addr: "e",Zone: "z3",Rack: "r1"},
+		"f": {Addr: "f",Zone: "z1",Rack: "r1"},
+	}
+
+	tests := []struct{
+		name string
+		candidates []string
+		n int
+		want []string
+	}{
+		{"优先选择不同的可用区",[]string{"a","b","c","d","e"},3,[]string{"a","d","e"}},
+		{"可用区不够时选择不同的机架",[]string{"a","b","c","d"},3,[]string{"a","d","c"}},
+		{"最后按哈希环顺序补齐",[]string{"a","b","f","c","d","e"},5,[]string{"a","d","e","c","b"}},
+		{"候选节点不足",[]string{"b","a"},3,[]string{"b","a"}},
+	}
+
+	for _,tt := range tests{
+		t.Run(tt.name,func(t *testing.T){
+			got := placeReplicas(tt.candidates,tt.n,ring)
+			if len(got) != len(tt.want){
+				t.Fatalf("期望%v，实际为%v",tt.want,got)
+			}
+			for i := range got{
+				if got[i] != tt.want[i]{
+					t.Fatalf("期望%v，实际为%v",tt.want,got)
+				}
+			}
+		})
+	}
+}
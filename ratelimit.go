@@ -0,0 +1,404 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+//限流和配额
+//一个调用方大量请求某个缓存组时，不能拖慢同一节点上的其他缓存组和调用方：
+//	1.Server按调用方限制请求速率（WithCallerLimits），调用方为认证后的Principal，没有开启认证时为对端IP
+//	2.Group按缓存组和组内的调用方限制请求速率，并限制通过Set写入的字节数（WithQuota）；调用方的识别与1相同，
+//	  本进程内直接调用Group（没有调用方）只受缓存组的限制
+//	3.速率限制使用令牌桶，超出时返回ErrRateLimited；写入超出字节配额时返回ErrQuotaExceeded，gRPC状态码都为ResourceExhausted
+//	4.认证过的节点（内部角色）转发和同步的请求已经在入口节点计过，不再限制；从数据源加载的数据不计入字节配额
+//	  没有开启认证时无法确认请求来自节点，节点之间的请求和其他调用方一样按对端IP限制
+//配额在每个节点上单独计算；写入的缓存项被淘汰或过期后，超出配额时会先回收这部分字节再判断
+
+//ErrRateLimited 请求速率超出限制
+var ErrRateLimited = errors.New("mycache: rate limit exceeded")
+
+//ErrQuotaExceeded 写入的字节数超出配额
+var ErrQuotaExceeded = errors.New("mycache: memory quota exceeded")
+
+//maxIdleBuckets 调用方的令牌桶超过这个数量时清理已经回满的令牌桶
+const maxIdleBuckets = 4096
+
+//Limit 请求速率限制，Rate<=0表示不限制
+type Limit struct{
+	Rate float64	//每秒请求数
+	Burst int		//允许的突发请求数，小于1时为1
+}
+
+//CallerQuota 调用方在缓存组内的配额
+type CallerQuota struct{
+	Limit Limit
+	MaxBytes int64//通过Set写入的字节上限，0表示不限制
+}
+
+//GroupQuota 缓存组的配额
+type GroupQuota struct{
+	Limit Limit							//整个缓存组的请求速率
+	MaxBytes int64						//整个缓存组通过Set写入的字节上限，0表示不限制
+	Caller CallerQuota					//每个调用方的默认配额
+	Callers map[string]CallerQuota		//单独配置的调用方
+}
+
+//tokenBucket 令牌桶
+type tokenBucket struct{
+	rate float64
+	burst float64
+	tokens float64
+	last time.Time
+}
+
+func newTokenBucket(l Limit) *tokenBucket{
+	burst := float64(max(l.Burst,1))
+	return &tokenBucket{rate: l.Rate,burst: burst,tokens: burst,last: time.Now()}
+}
+
+//allow 补充令牌后取一个令牌（调用方需持有锁）
+//now可能早于令牌桶的创建时间（调用方先取时间再创建令牌桶），此时不补充也不扣减
+func (b *tokenBucket) allow(now time.Time) bool{
+	if now.After(b.last){
+		b.tokens = min(b.burst,b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	if b.tokens < 1{
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+//full 令牌桶是否已经回满（调用方需持有锁）
+func (b *tokenBucket) full(now time.Time) bool{
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+//limiterSet 按调用方的令牌桶
+type limiterSet struct{
+	mu sync.Mutex
+	limit Limit
+	overrides map[string]Limit
+	buckets map[string]*tokenBucket
+	allowed map[string]int64
+	rejected map[string]int64
+}
+
+func newLimiterSet(limit Limit,overrides map[string]Limit) *limiterSet{
+	return &limiterSet{
+		limit: limit,
+		overrides: overrides,
+		buckets: make(map[string]*tokenBucket),
+		allowed: make(map[string]int64),
+		rejected: make(map[string]int64),
+	}
+}
+
+//1.allow 判断调用方的请求是否在速率限制内
+func (s *limiterSet) allow(caller string) bool{
+	limit,ok := s.overrides[caller]
+	if !ok{
+		limit = s.limit
+	}
+	if limit.Rate <= 0{
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b,ok := s.buckets[caller]
+	if !ok{
+		if len(s.buckets) >= maxIdleBuckets{
+			s.sweep(now)
+		}
+		b = newTokenBucket(limit)
+		s.buckets[caller] = b
+	}
+	if !b.allow(now){
+		s.rejected[caller]++
+		return false
+	}
+	s.allowed[caller]++
+	return true
+}
+
+//sweep 清理已经回满的令牌桶（调用方需持有锁），统计信息一并清理
+func (s *limiterSet) sweep(now time.Time){
+	for caller,b := range s.buckets{
+		if b.full(now){
+			delete(s.buckets,caller)
+			delete(s.allowed,caller)
+			delete(s.rejected,caller)
+		}
+	}
+}
+
+//2.stats 返回各调用方的请求数和被拒绝的次数
+func (s *limiterSet) stats() map[string]interface{}{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]interface{},len(s.buckets))
+	for caller := range s.buckets{
+		stats[caller] = map[string]interface{}{
+			"allowed": s.allowed[caller],
+			"rate_limited": s.rejected[caller],
+		}
+	}
+	return stats
+}
+
+//keyOwner 通过Set写入的缓存项的调用方和大小
+type keyOwner struct{
+	caller string
+	size int64
+	seq uint64//写入的序号，区分同一调用方写入相同大小的两次写入
+}
+
+//groupQuota 缓存组的限流和字节配额
+type groupQuota struct{
+	quota GroupQuota
+	mu sync.Mutex
+	bucket *tokenBucket					//整个缓存组的令牌桶
+	callers *limiterSet					//组内各调用方的令牌桶
+	owners map[string]keyOwner			//key -> 写入的调用方
+	usage map[string]int64				//调用方 -> 写入的字节数
+	bytes int64							//整个缓存组写入的字节数
+	reclaimedAt time.Time				//上次回收已淘汰缓存项的时间
+	seq uint64							//最近一次写入的序号
+	rateLimited int64
+	quotaRejected int64
+}
+
+func newGroupQuota(q GroupQuota) *groupQuota{
+	overrides := make(map[string]Limit,len(q.Callers))
+	for caller,cq := range q.Callers{
+		overrides[caller] = cq.Limit
+	}
+	gq := &groupQuota{
+		quota: q,
+		callers: newLimiterSet(q.Caller.Limit,overrides),
+		owners: make(map[string]keyOwner),
+		usage: make(map[string]int64),
+	}
+	if q.Limit.Rate > 0{
+		gq.bucket = newTokenBucket(q.Limit)
+	}
+	return gq
+}
+
+//callerQuota 返回调用方的配额
+func (q *groupQuota) callerQuota(caller string) CallerQuota{
+	if cq,ok := q.quota.Callers[caller]; ok{
+		return cq
+	}
+	return q.quota.Caller
+}
+
+//1.admit 检查调用方和缓存组的请求速率，先检查调用方，被限流的调用方不会消耗缓存组的令牌
+func (q *groupQuota) admit(caller string) error{
+	if caller != "" && !q.callers.allow(caller){
+		atomic.AddInt64(&q.rateLimited,1)
+		return ErrRateLimited
+	}
+	if q.bucket != nil{
+		q.mu.Lock()
+		ok := q.bucket.allow(time.Now())
+		q.mu.Unlock()
+		if !ok{
+			atomic.AddInt64(&q.rateLimited,1)
+			return ErrRateLimited
+		}
+	}
+	return nil
+}
+
+//2.reserve 记录调用方写入key的size字节，超出缓存组或调用方的字节配额时返回ErrQuotaExceeded
+//超出时先回收已经不在缓存中（被淘汰或过期）的缓存项再判断，回收最多每秒一次
+//返回的undo在写入失败时撤销这次记录，恢复key原来的占用
+func (q *groupQuota) reserve(caller,key string,size int64,contains func(string) bool) (undo func(),err error){
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.exceeds(caller,key,size) && time.Since(q.reclaimedAt) >= time.Second{
+		q.reclaim(contains)
+	}
+	if q.exceeds(caller,key,size){
+		atomic.AddInt64(&q.quotaRejected,1)
+		return nil,ErrQuotaExceeded
+	}
+
+	old,had := q.owners[key]
+	q.release(key)//覆盖写入时释放旧值的字节
+	q.seq++
+	owner := keyOwner{caller: caller,size: size,seq: q.seq}
+	q.acquire(key,owner)
+
+	return func(){
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.owners[key] != owner{
+			return//之后又有写入或删除，以它们为准
+		}
+		q.release(key)
+		if had{
+			q.acquire(key,old)
+		}
+	},nil
+}
+
+//acquire 记录key的占用（调用方需持有锁）
+func (q *groupQuota) acquire(key string,owner keyOwner){
+	q.owners[key] = owner
+	q.usage[owner.caller] += owner.size
+	q.bytes += owner.size
+}
+
+//exceeds 判断调用方写入key后是否超出配额（调用方需持有锁）
+func (q *groupQuota) exceeds(caller,key string,size int64) bool{
+	old := q.owners[key]
+	if q.quota.MaxBytes > 0 && q.bytes-old.size+size > q.quota.MaxBytes{
+		return true
+	}
+	if caller == ""{
+		return false
+	}
+	cq := q.callerQuota(caller)
+	if cq.MaxBytes <= 0{
+		return false
+	}
+	usage := q.usage[caller]+size
+	if old.caller == caller{
+		usage -= old.size
+	}
+	return usage > cq.MaxBytes
+}
+
+//3.forget 删除key时释放它的字节
+func (q *groupQuota) forget(key string){
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(key)
+}
+
+//release 释放key的字节（调用方需持有锁）
+func (q *groupQuota) release(key string){
+	old,ok := q.owners[key]
+	if !ok{
+		return
+	}
+	delete(q.owners,key)
+	q.usage[old.caller] -= old.size
+	if q.usage[old.caller] <= 0{
+		delete(q.usage,old.caller)
+	}
+	q.bytes -= old.size
+}
+
+//reclaim 回收已经不在缓存中的缓存项（调用方需持有锁）
+func (q *groupQuota) reclaim(contains func(string) bool){
+	q.reclaimedAt = time.Now()
+	for key := range q.owners{
+		if !contains(key){
+			q.release(key)
+		}
+	}
+}
+
+//4.stats 返回限流和配额的使用情况
+func (q *groupQuota) stats() map[string]interface{}{
+	callers := q.callers.stats()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for caller,usage := range q.usage{
+		if caller == ""{
+			continue//本地调用（没有调用方）只计入缓存组
+		}
+		cs,ok := callers[caller].(map[string]interface{})
+		if !ok{
+			cs = make(map[string]interface{})
+			callers[caller] = cs
+		}
+		cs["bytes"] = usage
+		if cq := q.callerQuota(caller); cq.MaxBytes > 0{
+			cs["max_bytes"] = cq.MaxBytes
+		}
+	}
+
+	stats := map[string]interface{}{
+		"rate_limited": atomic.LoadInt64(&q.rateLimited),
+		"quota_rejected": atomic.LoadInt64(&q.quotaRejected),
+		"bytes": q.bytes,
+		"callers": callers,
+	}
+	if q.quota.MaxBytes > 0{
+		stats["max_bytes"] = q.quota.MaxBytes
+	}
+	return stats
+}
+
+//callerName 返回请求的调用方：认证后的Principal，没有开启认证时为对端IP，本进程内的调用返回空字符串
+func callerName(ctx context.Context) string{
+	if p,ok := PrincipalFromContext(ctx); ok{
+		return p.Name
+	}
+	if p,ok := peer.FromContext(ctx); ok && p.Addr != nil{
+		host,_,err := net.SplitHostPort(p.Addr.String())
+		if err != nil{
+			return p.Addr.String()
+		}
+		return host
+	}
+	return ""
+}
+
+//fromVerifiedPeer 请求是否来自认证过的节点（内部角色）
+//from-peer元数据可以由任何客户端携带，不能据此跳过限流和配额
+func fromVerifiedPeer(ctx context.Context) bool{
+	p,ok := PrincipalFromContext(ctx)
+	return ok && p.Peer
+}
+
+//1.limitUnary 按调用方限制请求速率（一元RPC拦截器），认证过的节点之间的请求不限制
+func (s *Server) limitUnary(ctx context.Context,req interface{},info *grpc.UnaryServerInfo,handler grpc.UnaryHandler) (interface{},error){
+	if s.limiter == nil || fromVerifiedPeer(ctx){
+		return handler(ctx,req)
+	}
+
+	caller := callerName(ctx)//没有开启认证时按对端IP限制
+	if !s.limiter.allow(caller){
+		return nil,status.Errorf(codes.ResourceExhausted,"rate limit exceeded for %s",caller)
+	}
+	return handler(ctx,req)
+}
+
+//2.RateLimitStats 返回按调用方限流的统计信息
+func (s *Server) RateLimitStats() map[string]interface{}{
+	if s.limiter == nil{
+		return nil
+	}
+	return s.limiter.stats()
+}
+
+//toStatus 把限流和配额错误转换为ResourceExhausted
+func toStatus(err error) error{
+	if errors.Is(err,ErrRateLimited) || errors.Is(err,ErrQuotaExceeded){
+		return status.Error(codes.ResourceExhausted,err.Error())
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGroupQuota(t *testing.T){
+	g := NewGroup("quota-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithQuota(GroupQuota{
+		Caller: CallerQuota{Limit: Limit{Rate: 0.001,Burst: 2},MaxBytes: 10},
+		Callers: map[string]CallerQuota{"batch": {MaxBytes: 100}},
+	}))
+	defer DestroyGroup("quota-test")
+
+	as := func(name string) context.Context{
+		return context.WithValue(context.Background(),principalKey{},&Principal{Name: name})
+	}
+
+	//调用方的令牌用完后被限流，不影响其他调用方
+	noisy := as("noisy")
+	for i := 0; i < 2; i++{
+		if _,err := g.Get(noisy,"k"); err != nil{
+			t.Fatalf("request %d should be allowed: %v",i,err)
+		}
+	}
+	if _,err := g.Get(noisy,"k"); !errors.Is(err,ErrRateLimited){
+		t.Fatalf("expected ErrRateLimited, got %v",err)
+	}
+	if status.Code(toStatus(ErrRateLimited)) != codes.ResourceExhausted{
+		t.Fatal("rate limit errors should map to ResourceExhausted")
+	}
+	if _,err := g.Get(as("quiet"),"k"); err != nil{
+		t.Fatalf("other callers should not be limited: %v",err)
+	}
+
+	//字节配额：key+value累计超过10字节的写入被拒绝，删除会释放字节
+	batch := as("batch")
+	if err := g.Set(batch,"a",[]byte("1234567")); err != nil{
+		t.Fatal(err)
+	}
+	if err := g.Set(batch,"b",[]byte("1234567")); err != nil{
+		t.Fatal(err)
+	}
+	writer := as("writer")
+	if err := g.Set(writer,"c",[]byte("1234567")); err != nil{
+		t.Fatal(err)
+	}
+	if err := g.Set(writer,"d",[]byte("1234567")); !errors.Is(err,ErrQuotaExceeded){
+		t.Fatalf("expected ErrQuotaExceeded, got %v",err)
+	}
+	if err := g.Delete(batch,"c"); err != nil{
+		t.Fatal(err)
+	}
+	if err := g.Set(as("writer2"),"d",[]byte("1234567")); err != nil{
+		t.Fatalf("write within quota failed: %v",err)
+	}
+
+	stats := g.Stats()["quota"].(map[string]interface{})
+	callers := stats["callers"].(map[string]interface{})
+	if stats["quota_rejected"].(int64) != 1 || callers["batch"].(map[string]interface{})["bytes"].(int64) != 16{
+		t.Fatalf("unexpected quota stats: %v",stats)
+	}
+	if _,ok := callers["writer"].(map[string]interface{})["bytes"]; ok{
+		t.Fatalf("deleted key should be released: %v",callers["writer"])
+	}
+}
+
+func TestGroupQuotaFailedWrite(t *testing.T){
+	var failing atomic.Bool
+	failing.Store(true)
+	setter := SetterFunc(func(ctx context.Context,key string,value []byte) error{
+		if failing.Load(){
+			return errors.New("source unavailable")
+		}
+		return nil
+	})
+	g := NewGroup("quota-failed-write",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithWriteThrough(setter,nil),WithQuota(GroupQuota{Caller: CallerQuota{MaxBytes: 10}}))
+	defer DestroyGroup("quota-failed-write")
+
+	ctx := context.WithValue(context.Background(),principalKey{},&Principal{Name: "writer"})
+
+	//写数据源失败的值没有写入缓存，不能占用配额
+	for i := 0; i < 3; i++{
+		if err := g.Set(ctx,"a",[]byte("1234567")); err == nil || errors.Is(err,ErrQuotaExceeded){
+			t.Fatalf("expected the setter error, got %v",err)
+		}
+	}
+	failing.Store(false)
+	if err := g.Set(ctx,"b",[]byte("1234567")); err != nil{
+		t.Fatalf("failed writes should not consume the quota: %v",err)
+	}
+
+	//覆盖写入失败时恢复旧值的占用
+	failing.Store(true)
+	if err := g.Set(ctx,"b",[]byte("12")); err == nil{
+		t.Fatal("expected the setter error")
+	}
+	failing.Store(false)
+	if err := g.Set(ctx,"c",[]byte("1234567")); !errors.Is(err,ErrQuotaExceeded){
+		t.Fatalf("b should still hold its bytes, got %v",err)
+	}
+}
+
+//没有开启认证时，组内的调用方配额按对端IP计算
+func TestGroupQuotaWithoutAuth(t *testing.T){
+	g := NewGroup("quota-no-auth",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithQuota(GroupQuota{Caller: CallerQuota{Limit: Limit{Rate: 0.001,Burst: 1}}}))
+	defer DestroyGroup("quota-no-auth")
+
+	from := func(ip string,port int) context.Context{
+		return peer.NewContext(context.Background(),&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip),Port: port}})
+	}
+	if _,err := g.Get(from("10.0.0.1",1000),"k"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := g.Get(from("10.0.0.1",2000),"k"); !errors.Is(err,ErrRateLimited){
+		t.Fatalf("connections from the same IP should share a quota, got %v",err)
+	}
+	if _,err := g.Get(from("10.0.0.2",1000),"k"); err != nil{
+		t.Fatalf("another IP should have its own quota: %v",err)
+	}
+	for i := 0; i < 3; i++{
+		if _,err := g.Get(context.Background(),"k"); err != nil{
+			t.Fatalf("in-process calls have no caller quota: %v",err)
+		}
+	}
+}
+
+//撤销只针对本次写入，之后同一调用方写入相同大小的值不会被撤销
+func TestGroupQuotaUndoOwnWrite(t *testing.T){
+	q := newGroupQuota(GroupQuota{MaxBytes: 100})
+	contains := func(string) bool{ return true }
+
+	undoFirst,err := q.reserve("w","k",5,contains)
+	if err != nil{
+		t.Fatal(err)
+	}
+	undoSecond,err := q.reserve("w","k",5,contains)
+	if err != nil{
+		t.Fatal(err)
+	}
+	undoFirst()
+	if q.bytes != 5 || q.usage["w"] != 5{
+		t.Fatalf("undoing a superseded write released the newer one: bytes=%d usage=%d",q.bytes,q.usage["w"])
+	}
+	undoSecond()
+	if q.bytes != 5{
+		t.Fatalf("undoing the latest write should restore the previous one, bytes=%d",q.bytes)
+	}
+}
@@ -0,0 +1,127 @@
+package registry
+
+import(
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/namespace"
+)
+
+//Config 定义etcd客户端配置
+//Server、ClientPicker和注册管理器都通过它创建etcd客户端，也可以直接共享同一个客户端
+type Config struct{
+	Endpoints []string 		//集群地址
+	DialTimeout time.Duration//连接超时时间
+	RequestTimeout time.Duration//单次请求的超时时间
+	Username string			//用户名（etcd开启认证时）
+	Password string			//密码
+	CertFile string			//TLS客户端证书（mTLS）
+	KeyFile string			//TLS客户端私钥
+	CAFile string			//用于校验etcd服务端证书的CA
+	ServerName string		//校验服务端证书时使用的主机名，默认为端点的主机名
+	Namespace string		//key前缀，所有key都会加上该前缀（如"/prod"），用于多个集群共享一个etcd；共享的客户端也会加上（见Namespaced）
+}
+
+//DefaultConfig 提供默认配置
+var DefaultConfig = &Config{
+	Endpoints:		[]string{"localhost:2379"},
+	DialTimeout:	5*time.Second,
+	RequestTimeout:	3*time.Second,
+}
+
+//1.NewClient 根据配置创建etcd客户端
+func (c *Config) NewClient() (*clientv3.Client,error){
+	tlsConfig,err := c.tlsConfig()
+	if err != nil{
+		return nil,err
+	}
+
+	cli,err := clientv3.New(clientv3.Config{
+		Endpoints:		c.Endpoints,
+		DialTimeout:	c.DialTimeout,
+		Username:		c.Username,
+		Password:		c.Password,
+		TLS:			tlsConfig,
+	})
+	if err != nil{
+		return nil,fmt.Errorf("failed to create etcd client: %v",err)
+	}
+
+	//加上key前缀，调用方无需感知
+	if prefix := c.prefix(); prefix != ""{
+		cli.KV = namespace.NewKV(cli.KV,prefix)
+		cli.Watcher = namespace.NewWatcher(cli.Watcher,prefix)
+		cli.Lease = namespace.NewLease(cli.Lease,prefix)
+	}
+	return cli,nil
+}
+
+//2.Timeout 返回单次请求的超时时间
+func (c *Config) Timeout() time.Duration{
+	if c == nil || c.RequestTimeout <= 0{
+		return 3*time.Second
+	}
+	return c.RequestTimeout
+}
+
+//3.Namespaced 给共享的etcd客户端加上Namespace前缀，没有前缀时原样返回
+//返回的客户端与cli共用连接，不会修改cli，关闭cli后也不能再使用；cli自己已经加过前缀时不要再设置Namespace
+func (c *Config) Namespaced(cli *clientv3.Client) *clientv3.Client{
+	prefix := c.prefix()
+	if cli == nil || prefix == ""{
+		return cli
+	}
+
+	wrapped := clientv3.NewCtxClient(cli.Ctx(),clientv3.WithZapLogger(cli.GetLogger()))
+	wrapped.Cluster = cli.Cluster
+	wrapped.Auth = cli.Auth
+	wrapped.Maintenance = cli.Maintenance
+	wrapped.KV = namespace.NewKV(cli.KV,prefix)
+	wrapped.Watcher = namespace.NewWatcher(cli.Watcher,prefix)
+	wrapped.Lease = namespace.NewLease(cli.Lease,prefix)
+	return wrapped
+}
+
+//prefix 返回key前缀，没有配置时为空
+func (c *Config) prefix() string{
+	if c == nil{
+		return ""
+	}
+	return strings.TrimSuffix(c.Namespace,"/")
+}
+
+//tlsConfig 加载TLS配置，没有配置证书和CA时返回nil（不使用TLS）
+func (c *Config) tlsConfig() (*tls.Config,error){
+	if c.CertFile == "" && c.CAFile == ""{
+		return nil,nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CertFile != ""{
+		cert,err := tls.LoadX509KeyPair(c.CertFile,c.KeyFile)
+		if err != nil{
+			return nil,fmt.Errorf("failed to load etcd client certificate: %v",err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != ""{
+		pem,err := os.ReadFile(c.CAFile)
+		if err != nil{
+			return nil,fmt.Errorf("failed to read etcd CA: %v",err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem){
+			return nil,fmt.Errorf("no valid certificates in %s",c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig,nil
+}
@@ -0,0 +1,268 @@
+package registry
+
+import(
+	"context"
+	"fmt"
+	"sync"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+//可插拔的服务发现
+//Server通过Discovery注册本节点，ClientPicker通过它获取和监听节点列表。内置三种实现：
+//	1.EtcdDiscovery：基于etcd的租约和watch（默认），同时支持发布集群拓扑（TopologyStore）
+//	2.StaticDiscovery：固定的节点列表，适合小集群和本地开发
+//	3.FileDiscovery：从JSON/YAML文件读取节点列表，文件变化时自动重新加载
+//	4.GossipDiscovery：节点之间通过SWIM协议维护成员列表，不依赖外部组件
+//不支持TopologyStore的实现没有集群统一的拓扑纪元，各节点根据相同的节点列表各自构建哈希环
+
+//EventType 节点变化事件的类型
+type EventType int
+
+const(
+	EventPut EventType = iota	//节点加入或注册信息更新
+	EventDelete					//节点离开
+)
+
+//Event 节点变化事件
+type Event struct{
+	Type EventType
+	Node Node//EventDelete时只保证Addr有效
+}
+
+//Discovery 服务发现接口
+type Discovery interface{
+	//Register 创建本节点的注册，调用Registrar.Run后开始注册
+	Register(svcName,addr string,opts ...RegisterOption) (Registrar,error)
+	//List 返回当前所有节点
+	List(ctx context.Context,svcName string) ([]Node,error)
+	//Watch 监听节点变化，ctx取消时关闭返回的channel
+	Watch(ctx context.Context,svcName string) <-chan []Event
+	//Close 释放资源
+	Close() error
+}
+
+//Registrar 本节点的注册
+type Registrar interface{
+	//Run 维护注册直到stopCh关闭，阻塞直到注销完成
+	Run(stopCh <-chan error)
+	//State 返回当前注册状态
+	State() State
+	//OnStateChange 注册状态变化时的回调（需要在Run之前设置）
+	OnStateChange(fn func(State))
+	//Done 返回注销完成时关闭的channel
+	Done() <-chan struct{}
+	//Node 返回注册的节点信息
+	Node() Node
+}
+
+//GroupUpdater 支持注册之后更新节点提供的缓存组的Registrar（etcd、gossip和本地注册都实现了该接口）
+//节点启动后新建或关闭缓存组时调用，其他节点据此更新Node.Groups
+type GroupUpdater interface{
+	SetGroups(groups ...string) error
+}
+
+//TopologyStore 支持发布集群拓扑的服务发现（EtcdDiscovery实现了该接口）
+type TopologyStore interface{
+	GetTopology(ctx context.Context,svcName string) (*Topology,error)
+	PublishTopology(ctx context.Context,svcName string,members []Member,replicas int) (*Topology,error)
+	WatchTopology(ctx context.Context,svcName string) <-chan *Topology
+}
+
+//编译期接口断言
+var(
+	_ Discovery = (*EtcdDiscovery)(nil)
+	_ TopologyStore = (*EtcdDiscovery)(nil)
+	_ Registrar = (*Registration)(nil)
+	_ GroupUpdater = (*Registration)(nil)
+)
+
+//EtcdDiscovery 基于etcd的服务发现
+type EtcdDiscovery struct{
+	cli *clientv3.Client
+	config *Config
+	ownsClient bool
+}
+
+//NewEtcdDiscovery 使用共享的etcd客户端创建服务发现（Close时不会关闭该客户端）
+//config用于超时和key前缀（Namespace）等设置，可以为nil
+func NewEtcdDiscovery(cli *clientv3.Client,config *Config) *EtcdDiscovery{
+	if config == nil{
+		config = DefaultConfig
+	}
+	return &EtcdDiscovery{cli: config.Namespaced(cli),config: config}
+}
+
+//DialEtcdDiscovery 按配置创建etcd客户端和服务发现（Close时关闭该客户端）
+func DialEtcdDiscovery(config *Config) (*EtcdDiscovery,error){
+	if config == nil{
+		config = DefaultConfig
+	}
+	cli,err := config.NewClient()
+	if err != nil{
+		return nil,err
+	}
+	return &EtcdDiscovery{cli: cli,config: config,ownsClient: true},nil
+}
+
+//1.Client 返回etcd客户端
+func (d *EtcdDiscovery) Client() *clientv3.Client{
+	return d.cli
+}
+
+//2.Register 创建基于租约的注册，租约丢失后自动重新注册
+func (d *EtcdDiscovery) Register(svcName,addr string,opts ...RegisterOption) (Registrar,error){
+	opts = append([]RegisterOption{WithEtcdConfig(d.config)},opts...)
+	opts = append(opts,withNamespacedClient(d.cli))
+	return NewRegistration(svcName,addr,opts...)
+}
+
+//3.List 返回/services/<svcName>/下的所有节点
+func (d *EtcdDiscovery) List(ctx context.Context,svcName string) ([]Node,error){
+	resp,err := d.cli.Get(ctx,servicePrefix(svcName),clientv3.WithPrefix())
+	if err != nil{
+		return nil,fmt.Errorf("failed to get all services: %v",err)
+	}
+
+	nodes := make([]Node,0,len(resp.Kvs))
+	for _,kv := range resp.Kvs{
+		if node,err := ParseNode(kv.Value); err == nil{
+			nodes = append(nodes,node)
+		}
+	}
+	return nodes,nil
+}
+
+//4.Watch 监听/services/<svcName>/下的变化
+func (d *EtcdDiscovery) Watch(ctx context.Context,svcName string) <-chan []Event{
+	ch := make(chan []Event)
+	prefix := servicePrefix(svcName)
+	go func(){
+		defer close(ch)
+		for resp := range d.cli.Watch(ctx,prefix,clientv3.WithPrefix()){
+			events := make([]Event,0,len(resp.Events))
+			for _,event := range resp.Events{
+				switch event.Type{
+				case clientv3.EventTypePut:
+					if node,err := ParseNode(event.Kv.Value); err == nil{
+						events = append(events,Event{Type: EventPut,Node: node})
+					}
+				case clientv3.EventTypeDelete:
+					//删除事件没有value，从key中解析地址
+					addr := string(event.Kv.Key)[len(prefix):]
+					events = append(events,Event{Type: EventDelete,Node: Node{ID: addr,Addr: addr}})
+				}
+			}
+			if len(events) == 0{
+				continue
+			}
+			select{
+			case ch <- events:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+//5.GetTopology 读取当前拓扑
+func (d *EtcdDiscovery) GetTopology(ctx context.Context,svcName string) (*Topology,error){
+	t,_,err := GetTopology(ctx,d.cli,svcName)
+	return t,err
+}
+
+//6.PublishTopology 发布新的成员列表
+func (d *EtcdDiscovery) PublishTopology(ctx context.Context,svcName string,members []Member,replicas int) (*Topology,error){
+	return PublishTopology(ctx,d.cli,svcName,members,replicas)
+}
+
+//7.WatchTopology 监听拓扑变化
+func (d *EtcdDiscovery) WatchTopology(ctx context.Context,svcName string) <-chan *Topology{
+	return WatchTopology(ctx,d.cli,svcName)
+}
+
+//8.Close 关闭自己创建的etcd客户端
+func (d *EtcdDiscovery) Close() error{
+	if d.ownsClient{
+		return d.cli.Close()
+	}
+	return nil
+}
+
+//servicePrefix 返回服务在etcd中的key前缀
+func servicePrefix(svcName string) string{
+	return fmt.Sprintf("/services/%s/",svcName)
+}
+
+//nodeSet 由本地维护节点列表的服务发现（文件、gossip）共用，列表变化时通知所有watcher
+type nodeSet struct{
+	mu sync.RWMutex
+	nodes []Node
+	changed chan struct{}//节点列表变化时关闭并替换
+}
+
+func newNodeSet() *nodeSet{
+	return &nodeSet{changed: make(chan struct{})}
+}
+
+//list 返回当前的节点列表
+func (s *nodeSet) list() []Node{
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Node(nil),s.nodes...)
+}
+
+//contains 判断列表中是否包含addr
+func (s *nodeSet) contains(addr string) bool{
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return containsNode(s.nodes,addr)
+}
+
+//update 替换节点列表并通知watcher
+func (s *nodeSet) update(nodes []Node){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes = nodes
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+//watch 监听节点列表的变化，ctx取消或stopCh关闭时关闭返回的channel
+func (s *nodeSet) watch(ctx context.Context,stopCh <-chan struct{}) <-chan []Event{
+	ch := make(chan []Event)
+	s.mu.RLock()
+	last,changed := s.nodes,s.changed//在返回之前记录当前列表，之后的变化都会通知
+	s.mu.RUnlock()
+
+	go func(){
+		defer close(ch)
+		for{
+			select{
+			case <-ctx.Done():
+				return
+			case <-stopCh:
+				return
+			case <-changed:
+			}
+
+			s.mu.RLock()
+			current := s.nodes
+			changed = s.changed
+			s.mu.RUnlock()
+
+			events := diffNodes(last,current)
+			last = current
+			if len(events) == 0{
+				continue
+			}
+			select{
+			case ch <- events:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,193 @@
+package registry
+
+import(
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+//选主
+//集群范围的任务（发布拓扑、定时预热、协调清空、反熵调度）只需要一个节点执行，Election基于etcd的concurrency包选出唯一的leader：
+//	1.每个节点创建带租约的会话，在/election/<svcName>/下竞选，创建版本最小的key对应的节点成为leader
+//	2.会话的租约丢失（如网络分区超过TTL）时立即失去leader身份，按指数退避重新创建会话后继续竞选
+//	3.leader的key的创建版本作为fencing token，随leader更替单调递增；执行任务时携带token，下游可以拒绝旧leader的请求
+//	4.stopCh关闭时先通知回调失去leader身份，再主动放弃（Resign）并撤销租约，其他节点立即接替
+
+//electionTTL 选主会话的租约TTL（秒）
+const electionTTL = 10
+
+//Election 选主
+type Election struct{
+	cli *clientv3.Client
+	prefix string
+	id string
+	leader int32//原子变量，是否为leader
+	mu sync.Mutex
+	token int64				//担任leader期间的fencing token
+	key string				//担任leader期间本节点的竞选key
+	onChange []func(leader bool,token int64)
+	done chan struct{}
+}
+
+//ElectionKey 返回服务选主在etcd中的key前缀
+func ElectionKey(svcName string) string{
+	return fmt.Sprintf("/election/%s",svcName)
+}
+
+//NewElection 创建选主，id为本节点的标识（如节点ID或地址），调用Run后开始竞选
+func NewElection(cli *clientv3.Client,svcName,id string) *Election{
+	return &Election{
+		cli: cli,
+		prefix: ElectionKey(svcName),
+		id: id,
+		done: make(chan struct{}),
+	}
+}
+
+//1.IsLeader 返回本节点是否为leader
+func (e *Election) IsLeader() bool{
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+//2.Token 返回担任leader期间的fencing token，不是leader时返回0
+func (e *Election) Token() int64{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token
+}
+
+//3.Fence 返回校验本节点仍是leader的事务条件，用于在etcd中执行只允许leader进行的写入
+func (e *Election) Fence() (clientv3.Cmp,bool){
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.key == ""{
+		return clientv3.Cmp{},false
+	}
+	return clientv3.Compare(clientv3.CreateRevision(e.key),"=",e.token),true
+}
+
+//4.OnChange 设置leader身份变化时的回调
+func (e *Election) OnChange(fn func(leader bool,token int64)){
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onChange = append(e.onChange,fn)
+}
+
+//5.Leader 返回当前leader的标识，没有leader时返回空字符串
+func (e *Election) Leader(ctx context.Context) (string,error){
+	resp,err := e.cli.Get(ctx,e.prefix+"/",clientv3.WithFirstCreate()...)
+	if err != nil{
+		return "",fmt.Errorf("failed to get leader: %v",err)
+	}
+	if len(resp.Kvs) == 0{
+		return "",nil
+	}
+	return string(resp.Kvs[0].Value),nil
+}
+
+//6.Done 返回选主停止时关闭的channel
+func (e *Election) Done() <-chan struct{}{
+	return e.done
+}
+
+//7.Run 参加竞选直到stopCh关闭，阻塞直到放弃leader身份
+func (e *Election) Run(stopCh <-chan error){
+	defer close(e.done)
+
+	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func(){
+		select{
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := minRetryBackoff
+	for{
+		elected,err := e.campaign(ctx)
+		if ctx.Err() != nil{
+			return
+		}
+		if elected{
+			backoff = minRetryBackoff
+		}
+		logrus.Warnf("Leader election for %s interrupted, retrying in %v: %v",e.prefix,backoff,err)
+		if !sleepCtx(ctx,jitter(backoff)){
+			return
+		}
+		backoff = min(backoff*2,maxRetryBackoff)
+	}
+}
+
+//8.campaign 创建会话并竞选，当选后保持leader身份直到会话丢失或ctx取消，返回是否当选过
+func (e *Election) campaign(ctx context.Context) (bool,error){
+	session,err := concurrency.NewSession(e.cli,concurrency.WithTTL(electionTTL))
+	if err != nil{
+		return false,fmt.Errorf("failed to create session: %v",err)
+	}
+	defer session.Close()//撤销租约，删除竞选key
+
+	election := concurrency.NewElection(session,e.prefix)
+
+	//会话丢失时停止竞选（否则自己的key被删除后仍会一直等待）
+	campaignCtx,campaignCancel := context.WithCancel(ctx)
+	defer campaignCancel()
+	go func(){
+		select{
+		case <-session.Done():
+			campaignCancel()
+		case <-campaignCtx.Done():
+		}
+	}()
+
+	if err := election.Campaign(campaignCtx,e.id); err != nil{
+		return false,fmt.Errorf("failed to campaign: %v",err)
+	}
+	if campaignCtx.Err() != nil{
+		return false,fmt.Errorf("session expired during campaign")
+	}
+
+	e.setLeader(true,election.Rev(),election.Key())
+	logrus.Infof("%s became leader of %s (token=%d)",e.id,e.prefix,election.Rev())
+
+	select{
+	case <-session.Done():
+		e.setLeader(false,0,"")
+		logrus.Warnf("%s lost leadership of %s: session expired",e.id,e.prefix)
+		return true,fmt.Errorf("session expired")
+	case <-ctx.Done():
+		e.setLeader(false,0,"")//先停止leader任务，再让其他节点接替
+		resignCtx,resignCancel := context.WithTimeout(context.Background(),3*time.Second)
+		if err := election.Resign(resignCtx); err != nil{
+			logrus.Warnf("Failed to resign leadership of %s: %v",e.prefix,err)
+		}
+		resignCancel()
+		logrus.Infof("%s resigned leadership of %s",e.id,e.prefix)
+		return true,nil
+	}
+}
+
+//setLeader 更新leader身份并通知回调
+func (e *Election) setLeader(leader bool,token int64,key string){
+	value := int32(0)
+	if leader{
+		value = 1
+	}
+	atomic.StoreInt32(&e.leader,value)
+
+	e.mu.Lock()
+	e.token,e.key = token,key
+	callbacks := e.onChange
+	e.mu.Unlock()
+	for _,fn := range callbacks{
+		fn(leader,token)
+	}
+}
@@ -0,0 +1,169 @@
+package registry
+
+import(
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+//FileDiscovery 从文件读取节点列表的服务发现，定期检查文件，变化时重新加载
+//文件为JSON或YAML（按扩展名.yaml/.yml判断），内容是节点列表，或者带nodes字段的对象，
+//列表中的每一项可以是地址字符串，也可以是与Node字段相同的对象，例如：
+//	nodes:
+//	  - 10.0.0.1:8001
+//	  - {addr: 10.0.0.2:8001, weight: 8, zone: us-east-1a}
+type FileDiscovery struct{
+	path string
+	interval time.Duration
+	nodes *nodeSet
+	modTime time.Time		//上次加载时文件的修改时间（只在pollLoop中访问）
+	stopCh chan struct{}
+	closeOnce sync.Once
+}
+
+var _ Discovery = (*FileDiscovery)(nil)
+
+//defaultFilePollInterval 默认的文件检查间隔
+const defaultFilePollInterval = time.Second
+
+//NewFileDiscovery 创建基于文件的服务发现，interval为检查文件的间隔（0表示默认1秒）
+func NewFileDiscovery(path string,interval time.Duration) (*FileDiscovery,error){
+	if interval <= 0{
+		interval = defaultFilePollInterval
+	}
+	d := &FileDiscovery{
+		path: path,
+		interval: interval,
+		nodes: newNodeSet(),
+		stopCh: make(chan struct{}),
+	}
+	if _,err := d.reload(); err != nil{
+		return nil,err
+	}
+	go d.pollLoop()
+	return d,nil
+}
+
+//1.Register 文件不需要注册，本节点不在文件中时其他节点无法发现它
+func (d *FileDiscovery) Register(svcName,addr string,opts ...RegisterOption) (Registrar,error){
+	o := newRegisterOptions(addr,opts...)
+	if !d.nodes.contains(o.node.Addr){
+		logrus.Warnf("Node %s is not in peer file %s, other nodes will not discover it",o.node.Addr,d.path)
+	}
+	return newLocalRegistration(o.node),nil
+}
+
+//2.List 返回当前的节点列表
+func (d *FileDiscovery) List(ctx context.Context,svcName string) ([]Node,error){
+	return d.nodes.list(),nil
+}
+
+//3.Watch 监听节点列表的变化
+func (d *FileDiscovery) Watch(ctx context.Context,svcName string) <-chan []Event{
+	return d.nodes.watch(ctx,d.stopCh)
+}
+
+//4.Close 停止检查文件
+func (d *FileDiscovery) Close() error{
+	d.closeOnce.Do(func(){
+		close(d.stopCh)
+	})
+	return nil
+}
+
+//pollLoop 定期检查文件的修改时间，变化时重新加载
+func (d *FileDiscovery) pollLoop(){
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			if updated,err := d.reload(); err != nil{
+				logrus.Warnf("Failed to reload peer file %s, keeping previous peers: %v",d.path,err)
+			}else if updated{
+				logrus.Infof("Reloaded peer file %s",d.path)
+			}
+		}
+	}
+}
+
+//reload 文件修改时间变化时重新读取，解析失败时保留原来的节点列表
+func (d *FileDiscovery) reload() (bool,error){
+	info,err := os.Stat(d.path)
+	if err != nil{
+		return false,fmt.Errorf("failed to stat peer file: %v",err)
+	}
+
+	if info.ModTime().Equal(d.modTime){
+		return false,nil
+	}
+
+	data,err := os.ReadFile(d.path)
+	if err != nil{
+		return false,fmt.Errorf("failed to read peer file: %v",err)
+	}
+	nodes,err := parsePeerFile(data,isYAML(d.path))
+	if err != nil{
+		return false,err
+	}
+
+	d.modTime = info.ModTime()
+	d.nodes.update(nodes)
+	return true,nil
+}
+
+//isYAML 根据扩展名判断是否为YAML文件
+func isYAML(path string) bool{
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+//parsePeerFile 解析节点文件
+func parsePeerFile(data []byte,isYAML bool) ([]Node,error){
+	var raw interface{}
+	var err error
+	if isYAML{
+		err = yaml.Unmarshal(data,&raw)
+	}else{
+		err = json.Unmarshal(data,&raw)
+	}
+	if err != nil{
+		return nil,fmt.Errorf("failed to parse peer file: %v",err)
+	}
+
+	if obj,ok := raw.(map[string]interface{}); ok{
+		raw = obj["nodes"]
+	}
+	items,ok := raw.([]interface{})
+	if !ok{
+		return nil,fmt.Errorf("peer file must contain a list of nodes")
+	}
+
+	nodes := make([]Node,0,len(items))
+	for _,item := range items{
+		var value []byte
+		if addr,ok := item.(string); ok{
+			value = []byte(addr)
+		}else if value,err = json.Marshal(item); err != nil{
+			return nil,fmt.Errorf("invalid node %v: %v",item,err)
+		}
+
+		node,err := ParseNode(value)
+		if err != nil{
+			return nil,err
+		}
+		nodes = append(nodes,node)
+	}
+	return nodes,nil
+}
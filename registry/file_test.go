@@ -0,0 +1,88 @@
+package registry
+
+import(
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePeerFile(t *testing.T){
+	yamlData := []byte(`
+nodes:
+  - 10.0.0.1:8001
+  - {addr: 10.0.0.2:8001, weight: 8, zone: us-east-1a}
+`)
+	jsonData := []byte(`["10.0.0.1:8001",{"addr":"10.0.0.2:8001","weight":8,"zone":"us-east-1a"}]`)
+
+	for name,tc := range map[string]struct{
+		data []byte
+		isYAML bool
+	}{
+		"yaml": {yamlData,true},
+		"json": {jsonData,false},
+	}{
+		nodes,err := parsePeerFile(tc.data,tc.isYAML)
+		if err != nil{
+			t.Fatalf("%s: %v",name,err)
+		}
+		if len(nodes) != 2{
+			t.Fatalf("%s: expected 2 nodes, got %d",name,len(nodes))
+		}
+		if nodes[0].Addr != "10.0.0.1:8001" || nodes[0].Weight != 1{
+			t.Errorf("%s: unexpected first node %+v",name,nodes[0])
+		}
+		if nodes[1].Weight != 8 || nodes[1].Zone != "us-east-1a"{
+			t.Errorf("%s: unexpected second node %+v",name,nodes[1])
+		}
+	}
+
+	if _,err := parsePeerFile([]byte(`{"peers": 1}`),false); err == nil{
+		t.Error("expected error for file without node list")
+	}
+}
+
+func TestFileDiscoveryReload(t *testing.T){
+	path := filepath.Join(t.TempDir(),"peers.json")
+	if err := os.WriteFile(path,[]byte(`["a:1","b:1"]`),0644); err != nil{
+		t.Fatal(err)
+	}
+
+	d,err := NewFileDiscovery(path,10*time.Millisecond)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := d.Watch(ctx,"svc")
+
+	//修改时间精度可能较低，确保重新写入后修改时间变化
+	next := time.Now().Add(time.Second)
+	if err := os.WriteFile(path,[]byte(`["b:1","c:1"]`),0644); err != nil{
+		t.Fatal(err)
+	}
+	os.Chtimes(path,next,next)
+
+	select{
+	case got := <-events:
+		want := map[string]EventType{"c:1": EventPut,"a:1": EventDelete}
+		if len(got) != len(want){
+			t.Fatalf("expected %d events, got %+v",len(want),got)
+		}
+		for _,e := range got{
+			if typ,ok := want[e.Node.Addr]; !ok || typ != e.Type{
+				t.Errorf("unexpected event %+v",e)
+			}
+		}
+	case <-time.After(2*time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+
+	nodes,_ := d.List(ctx,"svc")
+	if len(nodes) != 2 || nodes[0].Addr != "b:1" || nodes[1].Addr != "c:1"{
+		t.Errorf("unexpected nodes after reload: %+v",nodes)
+	}
+}
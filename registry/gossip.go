@@ -0,0 +1,724 @@
+package registry
+
+import(
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//基于SWIM协议的服务发现（gossip），适合没有etcd的边缘站点
+//	1.新成员向种子节点发送自己的完整成员列表（push-pull），对方回复它的成员列表，之后定期与随机成员交换
+//	2.每个探测周期按轮转顺序选择一个成员发送ping，超时未收到ack时请求k个其他成员代为探测（ping-req）
+//	3.间接探测也失败时把成员标记为可疑（suspect），可疑超时后确认死亡（dead）
+//	4.成员状态的变化附带在ping/ack等消息上传播，每条变化发送约RetransmitMult·log(n+1)次
+//	5.成员收到关于自己的可疑/死亡消息时增加incarnation并广播alive进行反驳
+//成员之间使用UDP通信，一个gossip集群只对应一个服务，因此忽略svcName
+//只有调用了Register的成员才会出现在List中（只使用ClientPicker的成员也可以加入集群观察成员变化）
+
+//memberStatus 成员状态
+type memberStatus int
+
+const(
+	statusAlive memberStatus = iota
+	statusSuspect
+	statusDead
+)
+
+func (s memberStatus) String() string{
+	switch s{
+	case statusAlive:
+		return "alive"
+	case statusSuspect:
+		return "suspect"
+	case statusDead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+//gossip消息类型
+const(
+	msgPing = "ping"
+	msgAck = "ack"
+	msgPingReq = "ping-req"
+	msgSync = "sync"			//push-pull：发送完整的成员列表，对方回复sync-ack
+	msgSyncAck = "sync-ack"
+	msgGossip = "gossip"		//只传播成员变化（离开集群时使用）
+)
+
+//maxPiggyback 每条消息最多附带的成员变化数
+const maxPiggyback = 16
+
+//maxPacketSize UDP消息的最大长度（push-pull发送完整的成员列表，成员很多时可能超过）
+const maxPacketSize = 65507
+
+//memberState 成员状态，在消息中传播
+type memberState struct{
+	Addr string				`json:"addr"`//gossip地址
+	Node *Node				`json:"node,omitempty"`//注册的缓存节点，未注册时为nil
+	Status memberStatus		`json:"status"`
+	Incarnation uint64		`json:"inc"`
+}
+
+//gossipMessage 成员之间的消息
+type gossipMessage struct{
+	Type string				`json:"type"`
+	From string				`json:"from"`
+	Seq uint64				`json:"seq,omitempty"`
+	Target string			`json:"target,omitempty"`//ping-req的探测目标
+	Members []memberState	`json:"members,omitempty"`//push-pull的完整成员列表
+	Updates []memberState	`json:"updates,omitempty"`//附带传播的成员变化
+}
+
+//GossipConfig gossip配置
+type GossipConfig struct{
+	BindAddr string					//UDP监听地址
+	AdvertiseAddr string			//对外通告的gossip地址，默认为监听地址（监听所有网卡时使用本机IP）
+	Seeds []string					//种子节点的gossip地址
+	ProbeInterval time.Duration		//探测周期
+	ProbeTimeout time.Duration		//直接探测的超时时间，需要小于探测周期
+	IndirectChecks int				//间接探测的成员数
+	SuspicionTimeout time.Duration	//可疑成员确认死亡的时间
+	RetransmitMult int				//成员变化的重传倍数
+	PushPullInterval time.Duration	//与随机成员交换完整成员列表的间隔
+	DeadReclaimTime time.Duration	//死亡成员从列表中删除的时间
+}
+
+//DefaultGossipConfig 默认的gossip配置
+var DefaultGossipConfig = &GossipConfig{
+	BindAddr: ":7946",
+	ProbeInterval: time.Second,
+	ProbeTimeout: 500*time.Millisecond,
+	IndirectChecks: 3,
+	SuspicionTimeout: 5*time.Second,
+	RetransmitMult: 4,
+	PushPullInterval: 30*time.Second,
+	DeadReclaimTime: time.Minute,
+}
+
+//member 本地维护的成员
+type member struct{
+	memberState
+	since time.Time//进入当前状态的时间
+}
+
+//broadcast 等待传播的成员变化
+type broadcast struct{
+	state memberState
+	transmits int
+}
+
+//GossipDiscovery 基于SWIM协议的服务发现
+type GossipDiscovery struct{
+	config GossipConfig
+	conn *net.UDPConn
+	self string						//本成员的gossip地址
+	mu sync.Mutex
+	members map[string]*member
+	probeOrder []string				//探测顺序，每轮重新打乱
+	probeIndex int
+	broadcasts map[string]*broadcast//按成员地址保存，新的变化覆盖旧的
+	acks map[uint64]func()			//等待ack的回调
+	seq uint64
+	leaving bool					//已经离开集群，不再反驳
+	nodes *nodeSet
+	stopCh chan struct{}
+	closeOnce sync.Once
+	wg sync.WaitGroup
+}
+
+var _ Discovery = (*GossipDiscovery)(nil)
+
+//NewGossipDiscovery 创建gossip服务发现并加入集群，config为nil时使用默认配置
+func NewGossipDiscovery(config *GossipConfig) (*GossipDiscovery,error){
+	c := *DefaultGossipConfig
+	if config != nil{
+		c = config.withDefaults()
+	}
+
+	udpAddr,err := net.ResolveUDPAddr("udp",c.BindAddr)
+	if err != nil{
+		return nil,fmt.Errorf("invalid gossip bind address: %v",err)
+	}
+	conn,err := net.ListenUDP("udp",udpAddr)
+	if err != nil{
+		return nil,fmt.Errorf("failed to listen for gossip: %v",err)
+	}
+
+	self := c.AdvertiseAddr
+	if self == ""{
+		if self,err = advertiseAddr(conn.LocalAddr().(*net.UDPAddr)); err != nil{
+			conn.Close()
+			return nil,err
+		}
+	}
+
+	d := &GossipDiscovery{
+		config: c,
+		conn: conn,
+		self: self,
+		members: make(map[string]*member),
+		broadcasts: make(map[string]*broadcast),
+		acks: make(map[uint64]func()),
+		nodes: newNodeSet(),
+		stopCh: make(chan struct{}),
+	}
+	//incarnation从当前时间开始，节点重启后不会被旧的死亡消息覆盖
+	d.members[self] = &member{
+		memberState: memberState{Addr: self,Status: statusAlive,Incarnation: uint64(time.Now().UnixNano())},
+		since: time.Now(),
+	}
+
+	d.wg.Add(3)
+	go d.readLoop()
+	go d.probeLoop()
+	go d.pushPullLoop()
+
+	logrus.Infof("Gossip member %s started with seeds %v",self,c.Seeds)
+	return d,nil
+}
+
+//withDefaults 未设置的字段使用默认值
+func (c *GossipConfig) withDefaults() GossipConfig{
+	out := *c
+	def := DefaultGossipConfig
+	if out.BindAddr == ""{
+		out.BindAddr = def.BindAddr
+	}
+	if out.ProbeInterval <= 0{
+		out.ProbeInterval = def.ProbeInterval
+	}
+	if out.ProbeTimeout <= 0 || out.ProbeTimeout >= out.ProbeInterval{
+		out.ProbeTimeout = out.ProbeInterval/2
+	}
+	if out.IndirectChecks <= 0{
+		out.IndirectChecks = def.IndirectChecks
+	}
+	if out.SuspicionTimeout <= 0{
+		out.SuspicionTimeout = def.SuspicionTimeout
+	}
+	if out.RetransmitMult <= 0{
+		out.RetransmitMult = def.RetransmitMult
+	}
+	if out.PushPullInterval <= 0{
+		out.PushPullInterval = def.PushPullInterval
+	}
+	if out.DeadReclaimTime <= 0{
+		out.DeadReclaimTime = def.DeadReclaimTime
+	}
+	return out
+}
+
+//1.Register 把节点信息加入本成员的状态，Run之后随gossip传播，停止时广播离开
+func (d *GossipDiscovery) Register(svcName,addr string,opts ...RegisterOption) (Registrar,error){
+	o := newRegisterOptions(addr,opts...)
+	return &gossipRegistration{localRegistration: newLocalRegistration(o.node),d: d},nil
+}
+
+//2.List 返回所有已注册且未确认死亡的成员
+func (d *GossipDiscovery) List(ctx context.Context,svcName string) ([]Node,error){
+	return d.nodes.list(),nil
+}
+
+//3.Watch 监听成员变化
+func (d *GossipDiscovery) Watch(ctx context.Context,svcName string) <-chan []Event{
+	return d.nodes.watch(ctx,d.stopCh)
+}
+
+//4.Close 停止gossip（不会广播离开，离开由Registrar停止时完成）
+func (d *GossipDiscovery) Close() error{
+	var err error
+	d.closeOnce.Do(func(){
+		close(d.stopCh)
+		err = d.conn.Close()
+		d.wg.Wait()
+	})
+	return err
+}
+
+//5.Self 返回本成员的gossip地址
+func (d *GossipDiscovery) Self() string{
+	return d.self
+}
+
+//6.Members 返回所有成员的gossip地址和状态（用于调试）
+func (d *GossipDiscovery) Members() map[string]string{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(map[string]string,len(d.members))
+	for addr,m := range d.members{
+		out[addr] = m.Status.String()
+	}
+	return out
+}
+
+//readLoop 接收消息
+func (d *GossipDiscovery) readLoop(){
+	defer d.wg.Done()
+	buf := make([]byte,maxPacketSize)
+	for{
+		n,_,err := d.conn.ReadFromUDP(buf)
+		if err != nil{
+			select{
+			case <-d.stopCh:
+				return
+			default:
+			}
+			logrus.Warnf("Failed to read gossip message: %v",err)
+			continue
+		}
+
+		var msg gossipMessage
+		if err := json.Unmarshal(buf[:n],&msg); err != nil{
+			logrus.Debugf("Ignoring invalid gossip message: %v",err)
+			continue
+		}
+		d.handle(&msg)
+	}
+}
+
+//handle 处理消息
+func (d *GossipDiscovery) handle(msg *gossipMessage){
+	d.merge(msg.Updates)
+
+	switch msg.Type{
+	case msgPing:
+		d.send(msg.From,&gossipMessage{Type: msgAck,Seq: msg.Seq})
+	case msgAck:
+		d.mu.Lock()
+		fn,ok := d.acks[msg.Seq]
+		delete(d.acks,msg.Seq)
+		d.mu.Unlock()
+		if ok{
+			fn()
+		}
+	case msgPingReq:
+		//代为探测，收到目标的ack后转发给请求方
+		from,seq := msg.From,msg.Seq
+		probeSeq := d.expectAck(func(){
+			d.send(from,&gossipMessage{Type: msgAck,Seq: seq})
+		})
+		time.AfterFunc(d.config.ProbeTimeout,func(){
+			d.cancelAck(probeSeq)
+		})
+		d.send(msg.Target,&gossipMessage{Type: msgPing,Seq: probeSeq})
+	case msgSync:
+		d.merge(msg.Members)
+		d.send(msg.From,&gossipMessage{Type: msgSyncAck,Members: d.snapshot()})
+	case msgSyncAck:
+		d.merge(msg.Members)
+	}
+}
+
+//send 发送消息，附带等待传播的成员变化
+func (d *GossipDiscovery) send(addr string,msg *gossipMessage){
+	msg.From = d.self
+	if msg.Type != msgSync && msg.Type != msgSyncAck{
+		msg.Updates = append(msg.Updates,d.takeBroadcasts()...)
+	}
+
+	data,err := json.Marshal(msg)
+	if err != nil{
+		logrus.Errorf("Failed to encode gossip message: %v",err)
+		return
+	}
+	if len(data) > maxPacketSize{
+		logrus.Warnf("Gossip message to %s is too large (%d bytes), dropping",addr,len(data))
+		return
+	}
+	udpAddr,err := net.ResolveUDPAddr("udp",addr)
+	if err != nil{
+		logrus.Warnf("Invalid gossip address %s: %v",addr,err)
+		return
+	}
+	if _,err := d.conn.WriteToUDP(data,udpAddr); err != nil{
+		logrus.Debugf("Failed to send gossip message to %s: %v",addr,err)
+	}
+}
+
+//probeLoop 每个探测周期检查可疑和死亡的成员，并探测一个成员
+func (d *GossipDiscovery) probeLoop(){
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.reap()
+			d.probe()
+		}
+	}
+}
+
+//probe 探测下一个成员：直接ping，超时后请求其他成员间接探测，都失败时标记为可疑
+func (d *GossipDiscovery) probe(){
+	target := d.nextProbeTarget()
+	if target == ""{
+		d.pushPull()//还没有其他成员，继续尝试加入集群
+		return
+	}
+
+	acked := make(chan struct{},1)
+	seq := d.expectAck(func(){
+		select{
+		case acked <- struct{}{}:
+		default:
+		}
+	})
+	defer d.cancelAck(seq)
+
+	d.send(target,&gossipMessage{Type: msgPing,Seq: seq})
+	select{
+	case <-acked:
+		return
+	case <-time.After(d.config.ProbeTimeout):
+	case <-d.stopCh:
+		return
+	}
+
+	for _,peer := range d.randomMembers(d.config.IndirectChecks,target){
+		d.send(peer,&gossipMessage{Type: msgPingReq,Seq: seq,Target: target})
+	}
+	select{
+	case <-acked:
+		return
+	case <-time.After(d.config.ProbeInterval-d.config.ProbeTimeout):
+	case <-d.stopCh:
+		return
+	}
+
+	d.suspect(target)
+}
+
+//pushPullLoop 加入集群，之后定期与随机成员交换完整的成员列表
+func (d *GossipDiscovery) pushPullLoop(){
+	defer d.wg.Done()
+	d.pushPull()
+
+	ticker := time.NewTicker(d.config.PushPullInterval)
+	defer ticker.Stop()
+	for{
+		select{
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.pushPull()
+		}
+	}
+}
+
+//pushPull 向随机成员发送完整的成员列表，还没有其他成员时发送给所有种子节点
+func (d *GossipDiscovery) pushPull(){
+	targets := d.randomMembers(1,"")
+	if len(targets) == 0{
+		for _,seed := range d.config.Seeds{
+			if seed != d.self{
+				targets = append(targets,seed)
+			}
+		}
+	}
+
+	members := d.snapshot()
+	for _,addr := range targets{
+		d.send(addr,&gossipMessage{Type: msgSync,Members: members})
+	}
+}
+
+//merge 合并收到的成员状态
+func (d *GossipDiscovery) merge(states []memberState){
+	if len(states) == 0{
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed := false
+	for _,s := range states{
+		if d.apply(s){
+			changed = true
+		}
+	}
+	if changed{
+		d.refreshNodes()
+	}
+}
+
+//apply 应用一条成员状态（调用方需持有锁），返回成员列表是否变化
+//incarnation更大的状态覆盖较小的；incarnation相同时dead覆盖suspect，suspect覆盖alive；死亡的成员只能被更大incarnation的alive恢复
+func (d *GossipDiscovery) apply(s memberState) bool{
+	if s.Addr == d.self{
+		local := d.members[d.self]
+		if s.Status != statusAlive && !d.leaving && s.Incarnation >= local.Incarnation{
+			local.Incarnation = s.Incarnation + 1
+			d.queueBroadcast(local.memberState)
+			logrus.Infof("Refuting %s message about self with incarnation %d",s.Status,local.Incarnation)
+		}
+		return false
+	}
+
+	m,ok := d.members[s.Addr]
+	if !ok{
+		if s.Status == statusDead{
+			return false
+		}
+		d.members[s.Addr] = &member{memberState: s,since: time.Now()}
+		d.queueBroadcast(s)
+		logrus.Infof("Gossip member %s joined (%s)",s.Addr,s.Status)
+		return true
+	}
+
+	newer := s.Incarnation > m.Incarnation || (s.Incarnation == m.Incarnation && s.Status > m.Status)
+	if !newer || (m.Status == statusDead && s.Status != statusAlive){
+		return false
+	}
+
+	if s.Node == nil{
+		s.Node = m.Node
+	}
+	if s.Status != m.Status{
+		logrus.Infof("Gossip member %s is %s",s.Addr,s.Status)
+	}
+	m.memberState = s
+	m.since = time.Now()
+	d.queueBroadcast(s)
+	return true
+}
+
+//suspect 把探测失败的成员标记为可疑
+func (d *GossipDiscovery) suspect(addr string){
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m,ok := d.members[addr]
+	if !ok || m.Status != statusAlive{
+		return
+	}
+	m.Status = statusSuspect
+	m.since = time.Now()
+	d.queueBroadcast(m.memberState)
+	logrus.Infof("Gossip member %s is suspect",addr)
+}
+
+//reap 可疑超时的成员确认死亡，死亡超过DeadReclaimTime的成员从列表中删除
+func (d *GossipDiscovery) reap(){
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	changed := false
+	now := time.Now()
+	for addr,m := range d.members{
+		switch{
+		case m.Status == statusSuspect && now.Sub(m.since) >= d.config.SuspicionTimeout:
+			m.Status = statusDead
+			m.since = now
+			d.queueBroadcast(m.memberState)
+			changed = true
+			logrus.Infof("Gossip member %s is dead",addr)
+		case m.Status == statusDead && addr != d.self && now.Sub(m.since) >= d.config.DeadReclaimTime:
+			delete(d.members,addr)
+		}
+	}
+	if changed{
+		d.refreshNodes()
+	}
+}
+
+//setLocalNode 设置本成员注册的节点并广播
+func (d *GossipDiscovery) setLocalNode(node *Node){
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	local := d.members[d.self]
+	local.Node = node
+	local.Status = statusAlive
+	local.Incarnation++
+	d.leaving = false
+	d.queueBroadcast(local.memberState)
+	d.refreshNodes()
+}
+
+//leave 广播本成员离开集群（直接发送给所有成员，不等待探测消息传播）
+func (d *GossipDiscovery) leave(){
+	d.mu.Lock()
+	local := d.members[d.self]
+	local.Status = statusDead
+	local.Incarnation++
+	d.leaving = true
+	state := local.memberState
+	d.refreshNodes()
+	d.mu.Unlock()
+
+	for _,addr := range d.randomMembers(math.MaxInt32,""){
+		d.send(addr,&gossipMessage{Type: msgGossip,Updates: []memberState{state}})
+	}
+	logrus.Infof("Gossip member %s left the cluster",d.self)
+}
+
+//queueBroadcast 加入等待传播的成员变化（调用方需持有锁）
+func (d *GossipDiscovery) queueBroadcast(s memberState){
+	d.broadcasts[s.Addr] = &broadcast{state: s}
+}
+
+//takeBroadcasts 取出最多maxPiggyback条成员变化，发送次数达到上限的不再传播
+func (d *GossipDiscovery) takeBroadcasts() []memberState{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	limit := d.config.RetransmitMult*int(math.Ceil(math.Log10(float64(len(d.members)+1))))
+	var out []memberState
+	for addr,b := range d.broadcasts{
+		if len(out) >= maxPiggyback{
+			break
+		}
+		out = append(out,b.state)
+		b.transmits++
+		if b.transmits >= limit{
+			delete(d.broadcasts,addr)
+		}
+	}
+	return out
+}
+
+//refreshNodes 根据成员列表更新节点列表（调用方需持有锁）
+func (d *GossipDiscovery) refreshNodes(){
+	nodes := make([]Node,0,len(d.members))
+	for _,m := range d.members{
+		if m.Node != nil && m.Status != statusDead{
+			nodes = append(nodes,*m.Node)
+		}
+	}
+	sort.Slice(nodes,func(i,j int) bool{
+		return nodes[i].Addr < nodes[j].Addr
+	})
+	d.nodes.update(nodes)
+}
+
+//snapshot 返回所有成员的状态
+func (d *GossipDiscovery) snapshot() []memberState{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]memberState,0,len(d.members))
+	for _,m := range d.members{
+		out = append(out,m.memberState)
+	}
+	return out
+}
+
+//nextProbeTarget 按轮转顺序返回下一个要探测的成员，每轮结束后重新打乱
+func (d *GossipDiscovery) nextProbeTarget() string{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for attempts := 0; attempts < 2; attempts++{
+		for d.probeIndex < len(d.probeOrder){
+			addr := d.probeOrder[d.probeIndex]
+			d.probeIndex++
+			if m,ok := d.members[addr]; ok && m.Status != statusDead{
+				return addr
+			}
+		}
+
+		d.probeOrder = d.probeOrder[:0]
+		for addr,m := range d.members{
+			if addr != d.self && m.Status != statusDead{
+				d.probeOrder = append(d.probeOrder,addr)
+			}
+		}
+		rand.Shuffle(len(d.probeOrder),func(i,j int){
+			d.probeOrder[i],d.probeOrder[j] = d.probeOrder[j],d.probeOrder[i]
+		})
+		d.probeIndex = 0
+	}
+	return ""
+}
+
+//randomMembers 随机返回最多k个存活的成员（不包括本成员和exclude）
+func (d *GossipDiscovery) randomMembers(k int,exclude string) []string{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	addrs := make([]string,0,len(d.members))
+	for addr,m := range d.members{
+		if addr != d.self && addr != exclude && m.Status == statusAlive{
+			addrs = append(addrs,addr)
+		}
+	}
+	rand.Shuffle(len(addrs),func(i,j int){
+		addrs[i],addrs[j] = addrs[j],addrs[i]
+	})
+	if len(addrs) > k{
+		addrs = addrs[:k]
+	}
+	return addrs
+}
+
+//expectAck 分配序号并注册收到ack时的回调
+func (d *GossipDiscovery) expectAck(fn func()) uint64{
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.seq++
+	d.acks[d.seq] = fn
+	return d.seq
+}
+
+//cancelAck 取消等待ack
+func (d *GossipDiscovery) cancelAck(seq uint64){
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.acks,seq)
+}
+
+//advertiseAddr 监听所有网卡时使用本机IP作为通告地址
+func advertiseAddr(addr *net.UDPAddr) (string,error){
+	if addr.IP != nil && !addr.IP.IsUnspecified(){
+		return addr.String(),nil
+	}
+	ip,err := getLocalIP()
+	if err != nil{
+		return "",fmt.Errorf("failed to get local IP for gossip: %v",err)
+	}
+	return net.JoinHostPort(ip,fmt.Sprint(addr.Port)),nil
+}
+
+//gossipRegistration 通过gossip传播的注册
+type gossipRegistration struct{
+	*localRegistration
+	d *GossipDiscovery
+}
+
+//Run 把节点信息加入本成员的状态，stopCh关闭时广播离开
+func (r *gossipRegistration) Run(stopCh <-chan error){
+	defer close(r.done)
+	node := r.Node()
+	r.d.setLocalNode(&node)
+	r.setState(StateRegistered)
+
+	<-stopCh
+	r.d.leave()
+	r.setState(StateStopped)
+}
+
+//SetGroups 更新缓存组，已注册时重新广播节点信息
+func (r *gossipRegistration) SetGroups(groups ...string) error{
+	r.localRegistration.SetGroups(groups...)
+	if r.State() == StateRegistered{
+		node := r.Node()
+		r.d.setLocalNode(&node)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package registry
+
+import(
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestGossip(t *testing.T,seeds ...string) *GossipDiscovery{
+	d,err := NewGossipDiscovery(&GossipConfig{
+		BindAddr: "127.0.0.1:0",
+		Seeds: seeds,
+		ProbeInterval: 50*time.Millisecond,
+		ProbeTimeout: 20*time.Millisecond,
+		SuspicionTimeout: 200*time.Millisecond,
+		PushPullInterval: 200*time.Millisecond,
+	})
+	if err != nil{
+		t.Fatal(err)
+	}
+	return d
+}
+
+//waitForNodes 等待成员看到指定数量的节点
+func waitForNodes(t *testing.T,d *GossipDiscovery,n int){
+	t.Helper()
+	deadline := time.Now().Add(5*time.Second)
+	for time.Now().Before(deadline){
+		if nodes,_ := d.List(context.Background(),"svc"); len(nodes) == n{
+			return
+		}
+		time.Sleep(20*time.Millisecond)
+	}
+	nodes,_ := d.List(context.Background(),"svc")
+	t.Fatalf("member %s sees %d nodes, expected %d (members: %v)",d.Self(),len(nodes),n,d.Members())
+}
+
+func TestGossipMembership(t *testing.T){
+	seed := newTestGossip(t)
+	defer seed.Close()
+	b := newTestGossip(t,seed.Self())
+	defer b.Close()
+	c := newTestGossip(t,seed.Self())
+
+	stops := make([]chan error,0,3)
+	for i,d := range []*GossipDiscovery{seed,b,c}{
+		reg,err := d.Register("svc",[]string{"n1:1","n2:1","n3:1"}[i])
+		if err != nil{
+			t.Fatal(err)
+		}
+		stop := make(chan error)
+		stops = append(stops,stop)
+		go reg.Run(stop)
+	}
+	defer close(stops[0])
+	defer close(stops[2])
+
+	for _,d := range []*GossipDiscovery{seed,b,c}{
+		waitForNodes(t,d,3)
+	}
+
+	//c没有离开就停止，其他成员探测失败后确认死亡
+	c.Close()
+	waitForNodes(t,seed,2)
+	waitForNodes(t,b,2)
+
+	//b正常离开，seed立即收到
+	close(stops[1])
+	waitForNodes(t,seed,1)
+}
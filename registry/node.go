@@ -0,0 +1,184 @@
+package registry
+
+import(
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+//CapacityUnit 按容量计算权重时，每个单位权重对应的字节数
+const CapacityUnit = 1 << 30//1GB
+
+//ProtocolVersion 节点之间通信协议的版本，不兼容的改动需要加一
+const ProtocolVersion = 1
+
+//Node 注册到etcd的节点信息
+//早期版本的value只有地址，ParseNode兼容这种格式（权重为1，其余字段为空）
+type Node struct{
+	ID string			`json:"id"`				//节点ID，默认为地址
+	Addr string			`json:"addr"`			//对外通告的地址，其他节点通过它访问本节点
+	Version int			`json:"version"`		//协议版本
+	Weight int			`json:"weight"`
+	Zone string			`json:"zone,omitempty"`//可用区，同一个key的副本尽量放在不同的可用区
+	Rack string			`json:"rack,omitempty"`//机架，可用区不够时副本尽量放在不同的机架
+	StartTime time.Time	`json:"start_time"`		//节点启动时间，节点重启后会变化
+	Groups []string		`json:"groups,omitempty"`//节点提供的缓存组
+}
+
+//registerOptions 注册选项
+type registerOptions struct{
+	node Node
+	config *Config				//创建etcd客户端的配置
+	client *clientv3.Client		//共享的etcd客户端，设置后不再创建新的客户端
+	namespaced bool				//client已经加上了config的key前缀
+}
+
+//newRegisterOptions 创建注册选项
+func newRegisterOptions(addr string,opts ...RegisterOption) *registerOptions{
+	o := &registerOptions{
+		node: Node{
+			Addr: addr,
+			Version: ProtocolVersion,
+			Weight: 1,
+			StartTime: time.Now(),
+		},
+		config: DefaultConfig,
+	}
+	for _,opt := range opts{
+		opt(o)
+	}
+	if o.node.ID == ""{
+		o.node.ID = o.node.Addr
+	}
+	return o
+}
+
+//RegisterOption 注册选项
+type RegisterOption func(*registerOptions)
+
+//WithWeight 设置节点权重，虚拟节点数与权重成正比
+func WithWeight(weight int) RegisterOption{
+	return func(o *registerOptions){
+		if weight > 0{
+			o.node.Weight = weight
+		}
+	}
+}
+
+//WithCapacity 根据节点的缓存容量（字节）设置权重，每CapacityUnit字节为1个单位，至少为1
+func WithCapacity(bytes int64) RegisterOption{
+	return func(o *registerOptions){
+		if bytes > 0{
+			o.node.Weight = int(max(1,(bytes+CapacityUnit/2)/CapacityUnit))
+		}
+	}
+}
+
+//WithLocality 设置节点所在的可用区和机架
+func WithLocality(zone,rack string) RegisterOption{
+	return func(o *registerOptions){
+		o.node.Zone = zone
+		o.node.Rack = rack
+	}
+}
+
+//WithNodeID 设置节点ID
+func WithNodeID(id string) RegisterOption{
+	return func(o *registerOptions){
+		o.node.ID = id
+	}
+}
+
+//WithAdvertiseAddr 设置对外通告的地址（监听地址与其他节点访问的地址不同时使用，如NAT或容器环境）
+func WithAdvertiseAddr(addr string) RegisterOption{
+	return func(o *registerOptions){
+		if addr != ""{
+			o.node.Addr = addr
+		}
+	}
+}
+
+//WithGroups 设置节点提供的缓存组
+func WithGroups(groups ...string) RegisterOption{
+	return func(o *registerOptions){
+		o.node.Groups = groups
+	}
+}
+
+//WithEtcdConfig 使用指定的etcd配置创建客户端
+func WithEtcdConfig(config *Config) RegisterOption{
+	return func(o *registerOptions){
+		if config != nil{
+			o.config = config
+		}
+	}
+}
+
+//WithEtcdClient 使用共享的etcd客户端（注销后不会关闭该客户端），WithEtcdConfig的Namespace同样生效
+func WithEtcdClient(cli *clientv3.Client) RegisterOption{
+	return func(o *registerOptions){
+		o.client = cli
+		o.namespaced = false
+	}
+}
+
+//withNamespacedClient 使用已经加上key前缀的共享客户端（EtcdDiscovery内部使用）
+func withNamespacedClient(cli *clientv3.Client) RegisterOption{
+	return func(o *registerOptions){
+		o.client = cli
+		o.namespaced = true
+	}
+}
+
+//1.Encode 编码为etcd中的value
+func (n Node) Encode() string{
+	data,_ := json.Marshal(n)
+	return string(data)
+}
+
+//2.Member 返回节点在拓扑中的成员信息
+func (n Node) Member() Member{
+	return Member{Addr: n.Addr,Weight: n.Weight,Zone: n.Zone,Rack: n.Rack}
+}
+
+//3.ServesGroup 判断节点是否提供该缓存组（没有声明缓存组的节点视为提供所有缓存组）
+func (n Node) ServesGroup(group string) bool{
+	if len(n.Groups) == 0{
+		return true
+	}
+	for _,g := range n.Groups{
+		if g == group{
+			return true
+		}
+	}
+	return false
+}
+
+//4.ParseNode 解析etcd中的value，兼容只有地址的旧格式
+func ParseNode(value []byte) (Node,error){
+	s := strings.TrimSpace(string(value))
+	if s == ""{
+		return Node{},fmt.Errorf("empty node value")
+	}
+	if !strings.HasPrefix(s,"{"){
+		return Node{ID: s,Addr: s,Weight: 1},nil
+	}
+
+	var n Node
+	if err := json.Unmarshal([]byte(s),&n); err != nil{
+		return Node{},fmt.Errorf("failed to decode node: %v",err)
+	}
+	if n.Addr == ""{
+		return Node{},fmt.Errorf("node without address: %s",s)
+	}
+	if n.Weight <= 0{
+		n.Weight = 1
+	}
+	if n.ID == ""{
+		n.ID = n.Addr
+	}
+	return n,nil
+}
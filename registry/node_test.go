@@ -0,0 +1,79 @@
+package registry
+
+import(
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeEncodeParse(t *testing.T){
+	node := Node{
+		ID: "node-1",
+		Addr: "10.0.0.1:8001",
+		Version: ProtocolVersion,
+		Weight: 4,
+		Zone: "us-east-1a",
+		Rack: "r1",
+		StartTime: time.Unix(1700000000,0).UTC(),
+		Groups: []string{"users","orders"},
+	}
+	got,err := ParseNode([]byte(node.Encode()))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got,node){
+		t.Fatalf("round trip mismatch: got %+v, want %+v",got,node)
+	}
+
+	//只有地址的旧格式
+	got,err = ParseNode([]byte(" 10.0.0.2:8001\n"))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got.Addr != "10.0.0.2:8001" || got.ID != got.Addr || got.Weight != 1{
+		t.Fatalf("legacy value parsed as %+v",got)
+	}
+
+	//缺省的ID和权重
+	got,err = ParseNode([]byte(`{"addr":"10.0.0.3:8001","weight":0}`))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got.ID != "10.0.0.3:8001" || got.Weight != 1{
+		t.Fatalf("defaults not applied: %+v",got)
+	}
+
+	for _,bad := range []string{"","  ",`{"weight":2}`,`{"addr":`}{
+		if _,err := ParseNode([]byte(bad)); err == nil{
+			t.Fatalf("ParseNode(%q) should fail",bad)
+		}
+	}
+}
+
+func TestNodeServesGroup(t *testing.T){
+	all := Node{Addr: "a"}
+	if !all.ServesGroup("users") || !all.ServesGroup("orders"){
+		t.Fatal("a node without declared groups should serve every group")
+	}
+
+	some := Node{Addr: "b",Groups: []string{"users"}}
+	if !some.ServesGroup("users") || some.ServesGroup("orders"){
+		t.Fatalf("node with groups %v served the wrong groups",some.Groups)
+	}
+}
+
+func TestLocalRegistrationSetGroups(t *testing.T){
+	var reg Registrar = newLocalRegistration(Node{Addr: "a",Groups: []string{"users"}})
+	updater,ok := reg.(GroupUpdater)
+	if !ok{
+		t.Fatal("local registration should support updating groups")
+	}
+	groups := []string{"users","orders"}
+	if err := updater.SetGroups(groups...); err != nil{
+		t.Fatal(err)
+	}
+	groups[0] = "mutated"
+	if got := reg.Node().Groups; !reflect.DeepEqual(got,[]string{"users","orders"}){
+		t.Fatalf("groups not updated: %v",got)
+	}
+}
@@ -0,0 +1,311 @@
+package registry
+
+import(
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+//自愈的服务注册
+//KeepAlive的通道关闭（租约过期、etcd重启丢失数据、网络分区超过TTL）后，如果不重新注册，
+//本节点会永远从服务发现中消失。Registration在后台维护注册状态：
+//	1.申请租约、写入节点信息并开启自动续期
+//	2.续期通道关闭或者自己的key被删除时，认为注册丢失，按指数退避（带随机抖动）重新注册
+//	3.注册状态的变化通过回调通知（Server据此更新健康检查状态）
+//	4.stopCh关闭时撤销租约，立即从服务发现中注销
+
+const(
+	//leaseTTL 租约的TTL（秒）
+	leaseTTL = 10
+	//minRetryBackoff 第一次重新注册前的等待时间
+	minRetryBackoff = 500*time.Millisecond
+	//maxRetryBackoff 重新注册的最大等待时间
+	maxRetryBackoff = 30*time.Second
+	//registerTimeout 单次注册（申请租约和写入）的最短超时时间
+	registerTimeout = 5*time.Second
+)
+
+//State 注册状态
+type State int32
+
+const(
+	StateRegistering State = iota	//正在注册（包括第一次注册和丢失后重新注册）
+	StateRegistered					//已注册
+	StateLost						//注册丢失，等待重新注册
+	StateStopped					//已注销
+)
+
+//String 返回注册状态的名称
+func (s State) String() string{
+	switch s{
+	case StateRegistering:
+		return "registering"
+	case StateRegistered:
+		return "registered"
+	case StateLost:
+		return "lost"
+	default:
+		return "stopped"
+	}
+}
+
+//Registration 注册管理器
+type Registration struct{
+	svcName string
+	key string
+	nodeMu sync.Mutex//保护node和leaseID，串行化节点信息的写入
+	node Node
+	leaseID clientv3.LeaseID//当前租约，未注册时为0
+	cli *clientv3.Client
+	ownsClient bool//客户端是否由本管理器创建（注销后关闭）
+	timeout time.Duration//单次注册的超时时间
+	done chan struct{}//Run退出时关闭
+	state int32//原子变量，当前注册状态
+	reregistrations int64//重新注册成功的次数
+	mu sync.Mutex
+	onChange []func(State)
+}
+
+//NewRegistration 创建注册管理器，调用Run后开始注册
+func NewRegistration(svcName,addr string,opts ...RegisterOption) (*Registration,error){
+	// 如果传入的 addr 是 ":8081" 这种形式，自动补全为本机非回环 IP
+	if addr[0] == ':'{
+		localIP,err := getLocalIP()
+		if err != nil{
+			return nil,fmt.Errorf("failed to get local IP: %v",err)
+		}
+		addr = fmt.Sprintf("%s%s",localIP,addr)
+	}
+	o := newRegisterOptions(addr,opts...)
+
+	// 没有共享的客户端时，按配置创建一个（clientv3.New 会创建一个与 etcd 集群的 gRPC 连接池）
+	cli,ownsClient := o.client,false
+	if cli != nil && !o.namespaced{
+		cli = o.config.Namespaced(cli)
+	}
+	if cli == nil{
+		var err error
+		if cli,err = o.config.NewClient(); err != nil{
+			return nil,err
+		}
+		ownsClient = true
+	}
+
+	return &Registration{
+		svcName: svcName,
+		// 设计 Key 的路径：/services/{服务名}/{地址}，方便服务发现端使用前缀查询
+		key: fmt.Sprintf("/services/%s/%s",svcName,o.node.Addr),
+		node: o.node,
+		cli: cli,
+		ownsClient: ownsClient,
+		timeout: max(o.config.Timeout(),registerTimeout),
+		done: make(chan struct{}),
+	},nil
+}
+
+//1.OnStateChange 注册状态变化时的回调（需要在Run之前设置）
+func (r *Registration) OnStateChange(fn func(State)){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = append(r.onChange,fn)
+}
+
+//2.State 返回当前注册状态
+func (r *Registration) State() State{
+	return State(atomic.LoadInt32(&r.state))
+}
+
+//3.Node 返回注册的节点信息
+func (r *Registration) Node() Node{
+	r.nodeMu.Lock()
+	defer r.nodeMu.Unlock()
+	return r.node
+}
+
+//4.Reregistrations 返回注册丢失后重新注册成功的次数
+func (r *Registration) Reregistrations() int64{
+	return atomic.LoadInt64(&r.reregistrations)
+}
+
+//5.Done 返回注销完成时关闭的channel
+func (r *Registration) Done() <-chan struct{}{
+	return r.done
+}
+
+//6.Run 维护注册直到stopCh关闭，阻塞直到注销完成
+func (r *Registration) Run(stopCh <-chan error){
+	defer close(r.done)
+	if r.ownsClient{
+		defer r.cli.Close()
+	}
+
+	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func(){
+		select{
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := minRetryBackoff
+	registered := false
+	for{
+		leaseID,err := r.register(ctx)
+		if err != nil{
+			if ctx.Err() != nil{
+				break
+			}
+			logrus.Warnf("Failed to register %s, retrying in %v: %v",r.key,backoff,err)
+			if !sleepCtx(ctx,jitter(backoff)){
+				break
+			}
+			backoff = min(backoff*2,maxRetryBackoff)
+			continue
+		}
+
+		backoff = minRetryBackoff
+		if registered{
+			atomic.AddInt64(&r.reregistrations,1)
+			logrus.Infof("Service re-registered: %s at %s",r.svcName,r.node.Addr)
+		}else{
+			logrus.Infof("Service registered: %s at %s (id=%s, weight=%d)",r.svcName,r.node.Addr,r.node.ID,r.node.Weight)
+		}
+		registered = true
+		r.setState(StateRegistered)
+
+		r.keepAlive(ctx,leaseID)
+		if ctx.Err() != nil{
+			// 收到外部停止信号：Revoke (撤销) 会立即让租约失效并删除关联的 Key，实现“优雅下线”
+			revokeCtx,revokeCancel := context.WithTimeout(context.Background(),3*time.Second)
+			r.cli.Revoke(revokeCtx,leaseID)
+			revokeCancel()
+			break
+		}
+		r.setState(StateLost)
+	}
+
+	r.setState(StateStopped)
+	logrus.Infof("Service deregistered: %s at %s",r.svcName,r.node.Addr)
+}
+
+//7.register 申请租约并写入节点信息
+func (r *Registration) register(ctx context.Context) (clientv3.LeaseID,error){
+	r.setState(StateRegistering)
+
+	ctx,cancel := context.WithTimeout(ctx,r.timeout)
+	defer cancel()
+
+	// Grant 申请一个租约，客户端在租约到期前不续约，etcd 会自动删除所有绑定在该租约上的 Key
+	lease,err := r.cli.Grant(ctx,leaseTTL)
+	if err != nil{
+		return 0,fmt.Errorf("failed to create lease: %v",err)
+	}
+
+	// WithLease(lease.ID) 将这个 Key 的生命周期与上面创建的租约绑定
+	r.nodeMu.Lock()
+	defer r.nodeMu.Unlock()
+	if _,err := r.cli.Put(ctx,r.key,r.node.Encode(),clientv3.WithLease(lease.ID)); err != nil{
+		return 0,fmt.Errorf("failed to put key-value to etcd: %v",err)
+	}
+	r.leaseID = lease.ID
+	return lease.ID,nil
+}
+
+//SetGroups 更新节点提供的缓存组，已注册时立即写入etcd（写入失败时下次重新注册也会使用新的缓存组）
+func (r *Registration) SetGroups(groups ...string) error{
+	r.nodeMu.Lock()
+	defer r.nodeMu.Unlock()
+
+	r.node.Groups = append([]string(nil),groups...)
+	if r.leaseID == 0 || r.State() != StateRegistered{
+		return nil
+	}
+	ctx,cancel := context.WithTimeout(context.Background(),r.timeout)
+	defer cancel()
+	if _,err := r.cli.Put(ctx,r.key,r.node.Encode(),clientv3.WithLease(r.leaseID)); err != nil{
+		return fmt.Errorf("failed to update groups of %s: %v",r.key,err)
+	}
+	return nil
+}
+
+//8.keepAlive 自动续期，直到租约丢失、key被删除或ctx取消
+func (r *Registration) keepAlive(ctx context.Context,leaseID clientv3.LeaseID){
+	kaCtx,cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// KeepAlive 返回一个通道，etcd SDK 会在后台自动发送心跳包续约
+	keepAliveCh,err := r.cli.KeepAlive(kaCtx,leaseID)
+	if err != nil{
+		logrus.Warnf("Failed to keep lease alive for %s: %v",r.key,err)
+		return
+	}
+	// 监听自己的key，被删除（如etcd恢复数据、人为误删）时也需要重新注册
+	watchCh := r.cli.Watch(kaCtx,r.key)
+
+	for{
+		select{
+		case <-ctx.Done():
+			return
+		case resp,ok := <-keepAliveCh:
+			if !ok{
+				// 通道关闭，说明租约已经过期或者与etcd的连接断开超过了TTL
+				logrus.Warnf("Keep alive channel closed for %s, re-registering",r.key)
+				return
+			}
+			logrus.Debugf("successfully renewed lease: %d",resp.ID)
+		case wresp,ok := <-watchCh:
+			if !ok{
+				watchCh = nil//watch结束后只依赖续期通道
+				continue
+			}
+			for _,event := range wresp.Events{
+				if event.Type == clientv3.EventTypeDelete{
+					logrus.Warnf("Registration key %s was deleted, re-registering",r.key)
+					revokeCtx,revokeCancel := context.WithTimeout(ctx,3*time.Second)
+					r.cli.Revoke(revokeCtx,leaseID)
+					revokeCancel()
+					return
+				}
+			}
+		}
+	}
+}
+
+//setState 更新注册状态并通知回调
+func (r *Registration) setState(state State){
+	if State(atomic.SwapInt32(&r.state,int32(state))) == state{
+		return
+	}
+
+	r.mu.Lock()
+	callbacks := r.onChange
+	r.mu.Unlock()
+	for _,fn := range callbacks{
+		fn(state)
+	}
+}
+
+//sleepCtx 等待d，ctx取消时返回false
+func sleepCtx(ctx context.Context,d time.Duration) bool{
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select{
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+//jitter 在d的基础上增加最多50%的随机抖动，避免大量节点同时重试
+func jitter(d time.Duration) time.Duration{
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,149 @@
+package registry
+
+import(
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+//StaticDiscovery 固定节点列表的服务发现，所有节点需要使用相同的列表
+type StaticDiscovery struct{
+	nodes []Node
+}
+
+var _ Discovery = (*StaticDiscovery)(nil)
+
+//NewStaticDiscovery 根据节点地址创建服务发现（权重均为1）
+func NewStaticDiscovery(addrs ...string) *StaticDiscovery{
+	nodes := make([]Node,0,len(addrs))
+	for _,addr := range addrs{
+		nodes = append(nodes,Node{ID: addr,Addr: addr,Weight: 1})
+	}
+	return &StaticDiscovery{nodes: nodes}
+}
+
+//NewStaticDiscoveryWithNodes 根据完整的节点信息创建服务发现（可以设置权重、可用区等）
+func NewStaticDiscoveryWithNodes(nodes []Node) *StaticDiscovery{
+	return &StaticDiscovery{nodes: append([]Node(nil),nodes...)}
+}
+
+//1.Register 静态列表不需要注册，本节点不在列表中时其他节点无法发现它
+func (d *StaticDiscovery) Register(svcName,addr string,opts ...RegisterOption) (Registrar,error){
+	o := newRegisterOptions(addr,opts...)
+	if !containsNode(d.nodes,o.node.Addr){
+		logrus.Warnf("Node %s is not in the static peer list, other nodes will not discover it",o.node.Addr)
+	}
+	return newLocalRegistration(o.node),nil
+}
+
+//2.List 返回节点列表
+func (d *StaticDiscovery) List(ctx context.Context,svcName string) ([]Node,error){
+	return append([]Node(nil),d.nodes...),nil
+}
+
+//3.Watch 节点列表不会变化，ctx取消时关闭channel
+func (d *StaticDiscovery) Watch(ctx context.Context,svcName string) <-chan []Event{
+	ch := make(chan []Event)
+	go func(){
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch
+}
+
+//4.Close 无需释放资源
+func (d *StaticDiscovery) Close() error{
+	return nil
+}
+
+//localRegistration 不需要外部存储的注册（静态列表和文件），Run之后即为已注册
+type localRegistration struct{
+	node Node//mu保护（SetGroups会修改Groups）
+	state int32
+	mu sync.Mutex
+	onChange []func(State)
+	done chan struct{}
+}
+
+func newLocalRegistration(node Node) *localRegistration{
+	return &localRegistration{node: node,done: make(chan struct{})}
+}
+
+func (r *localRegistration) Run(stopCh <-chan error){
+	defer close(r.done)
+	r.setState(StateRegistered)
+	<-stopCh
+	r.setState(StateStopped)
+}
+
+func (r *localRegistration) State() State{
+	return State(atomic.LoadInt32(&r.state))
+}
+
+func (r *localRegistration) OnStateChange(fn func(State)){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = append(r.onChange,fn)
+}
+
+func (r *localRegistration) Done() <-chan struct{}{
+	return r.done
+}
+
+func (r *localRegistration) Node() Node{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.node
+}
+
+func (r *localRegistration) SetGroups(groups ...string) error{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.node.Groups = append([]string(nil),groups...)
+	return nil
+}
+
+func (r *localRegistration) setState(state State){
+	atomic.StoreInt32(&r.state,int32(state))
+	r.mu.Lock()
+	callbacks := r.onChange
+	r.mu.Unlock()
+	for _,fn := range callbacks{
+		fn(state)
+	}
+}
+
+//containsNode 判断节点列表中是否包含addr
+func containsNode(nodes []Node,addr string) bool{
+	for _,n := range nodes{
+		if n.Addr == addr{
+			return true
+		}
+	}
+	return false
+}
+
+//diffNodes 比较两次节点列表，返回变化事件
+func diffNodes(before,after []Node) []Event{
+	old := make(map[string]string,len(before))
+	for _,n := range before{
+		old[n.Addr] = n.Encode()
+	}
+
+	var events []Event
+	seen := make(map[string]bool,len(after))
+	for _,n := range after{
+		seen[n.Addr] = true
+		if enc,ok := old[n.Addr]; !ok || enc != n.Encode(){
+			events = append(events,Event{Type: EventPut,Node: n})
+		}
+	}
+	for _,n := range before{
+		if !seen[n.Addr]{
+			events = append(events,Event{Type: EventDelete,Node: n})
+		}
+	}
+	return events
+}
@@ -0,0 +1,147 @@
+package registry
+
+import(
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+//集群拓扑（哈希环定义）
+//各节点不再根据自己看到的注册事件各自构建哈希环，而是由etcd上的拓扑统一决定：
+//	1.拓扑包含成员列表（地址和权重）、副本数以及单调递增的纪元（epoch）
+//	2.成员变化时，任意节点都可以发布新拓扑，通过事务比较ModRevision保证只有一个节点成功，纪元加一
+//	3.所有节点watch拓扑key，收到新纪元后一次性替换哈希环
+
+//Member 拓扑中的成员
+type Member struct{
+	Addr string		`json:"addr"`
+	Weight int		`json:"weight"`
+	Zone string		`json:"zone,omitempty"`
+	Rack string		`json:"rack,omitempty"`
+}
+
+//Topology 集群拓扑
+type Topology struct{
+	Epoch uint64		`json:"epoch"`
+	Members []Member	`json:"members"`
+	Replicas int		`json:"replicas"`
+}
+
+//TopologyKey 返回服务拓扑在etcd中的key
+func TopologyKey(svcName string) string{
+	return fmt.Sprintf("/topology/%s",svcName)
+}
+
+//1.SameLayout 判断两个拓扑的哈希环是否相同（不比较纪元）
+func (t *Topology) SameLayout(o *Topology) bool{
+	if t == nil || o == nil{
+		return t == o
+	}
+	if t.Replicas != o.Replicas || len(t.Members) != len(o.Members){
+		return false
+	}
+	for i := range t.Members{
+		if t.Members[i] != o.Members[i]{
+			return false
+		}
+	}
+	return true
+}
+
+//2.GetTopology 读取当前拓扑，不存在时返回nil，同时返回拓扑key的ModRevision（不存在时为0）
+func GetTopology(ctx context.Context,cli *clientv3.Client,svcName string) (*Topology,int64,error){
+	resp,err := cli.Get(ctx,TopologyKey(svcName))
+	if err != nil{
+		return nil,0,fmt.Errorf("failed to get topology: %v",err)
+	}
+	if len(resp.Kvs) == 0{
+		return nil,0,nil
+	}
+
+	t,err := decodeTopology(resp.Kvs[0].Value)
+	if err != nil{
+		return nil,0,err
+	}
+	return t,resp.Kvs[0].ModRevision,nil
+}
+
+//3.PublishTopology 发布新的成员列表，与当前拓扑相同时不发布（replicas只在第一次发布时生效）
+//通过事务比较拓扑key的ModRevision，并发发布时只有一个节点成功，失败的节点重新读取后重试
+//返回发布后（或当前）的拓扑
+func PublishTopology(ctx context.Context,cli *clientv3.Client,svcName string,members []Member,replicas int) (*Topology,error){
+	members = append([]Member(nil),members...)
+	sort.Slice(members,func(i,j int) bool{
+		return members[i].Addr < members[j].Addr
+	})
+
+	key := TopologyKey(svcName)
+	for{
+		current,rev,err := GetTopology(ctx,cli,svcName)
+		if err != nil{
+			return nil,err
+		}
+
+		next := &Topology{Members: members,Replicas: replicas,Epoch: 1}
+		if current != nil{
+			next.Replicas = current.Replicas//副本数以第一次发布时为准，避免配置不同的节点来回覆盖
+			if current.SameLayout(next){
+				return current,nil
+			}
+			next.Epoch = current.Epoch + 1
+		}
+
+		data,err := json.Marshal(next)
+		if err != nil{
+			return nil,fmt.Errorf("failed to encode topology: %v",err)
+		}
+
+		resp,err := cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key),"=",rev)).
+			Then(clientv3.OpPut(key,string(data))).
+			Commit()
+		if err != nil{
+			return nil,fmt.Errorf("failed to publish topology: %v",err)
+		}
+		if resp.Succeeded{
+			return next,nil
+		}
+		//其他节点抢先发布了，重新读取
+	}
+}
+
+//4.WatchTopology 监听拓扑变化，ctx取消时关闭返回的channel
+func WatchTopology(ctx context.Context,cli *clientv3.Client,svcName string) <-chan *Topology{
+	ch := make(chan *Topology)
+	go func(){
+		defer close(ch)
+		for resp := range cli.Watch(ctx,TopologyKey(svcName)){
+			for _,event := range resp.Events{
+				if event.Type != clientv3.EventTypePut{
+					continue
+				}
+				t,err := decodeTopology(event.Kv.Value)
+				if err != nil{
+					continue
+				}
+				select{
+				case ch <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+//decodeTopology 解析拓扑
+func decodeTopology(data []byte) (*Topology,error){
+	var t Topology
+	if err := json.Unmarshal(data,&t); err != nil{
+		return nil,fmt.Errorf("failed to decode topology: %v",err)
+	}
+	return &t,nil
+}
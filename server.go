@@ -4,19 +4,23 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"crypto/tls"
 
+	"github.com/Rampage-cd/DistributedCache/merkle"
 	pb "github.com/Rampage-cd/DistributedCache/pb"
 	"github.com/Rampage-cd/DistributedCache/registry"
 	"github.com/sirupsen/logrus"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 //Server定义缓存服务器
@@ -26,19 +30,52 @@ type Server struct{
 	svcName			string //服务地址与名称
 	groups			*sync.Map//缓存组
 	grpcServer		*grpc.Server//grpc服务器
-	etcdCli			*clientv3.Client//etcd客户端
-	stopCh 			chan error//停止信号
+	discovery		registry.Discovery//服务发现（默认基于etcd）
+	ownsDiscovery	bool//服务发现是否由服务器创建（停止时关闭）
+	stopCh 			chan error//停止信号（关闭时从etcd注销）
 	opts			*ServerOptions//服务器选项
+	healthServer	*health.Server//健康检查服务
+	deregisterOnce	sync.Once
+	stopOnce		sync.Once
+	draining		int32//原子变量，标记是否处于排空模式
+	inflight		int64//正在处理的请求数
+	lastRequest		int64//最近一次收到请求的时间（UnixNano）
+	registration	atomic.Value//本节点的注册（registry.Registrar）
+	election		*registry.Election//选主（只在使用etcd服务发现时存在）
+	electing		int32//原子变量，是否已经开始竞选
+	limiter			*limiterSet//按调用方的限流，没有配置时为nil
+	metricsServer	*http.Server//Prometheus指标的HTTP服务，没有配置时为nil
 }
 
+//编译期接口断言（Server可以作为ClientPicker的Leader）
+var _ Leader = (*Server)(nil)
+
 //ServerOptions 服务器配置选项
 type ServerOptions struct{
-	EtcdEndpoints []string			//etcd端点
-	DialTimeout   time.Duration		//连接超时
+	EtcdEndpoints []string			//etcd端点（未设置Etcd时使用）
+	DialTimeout   time.Duration		//连接超时（未设置Etcd时使用）
+	Etcd		  *registry.Config	//完整的etcd配置（TLS、认证、key前缀、超时），设置后忽略EtcdEndpoints和DialTimeout
+	EtcdClient	  *clientv3.Client	//共享的etcd客户端，设置后不再创建新的客户端，停止时也不会关闭
+	Discovery	  registry.Discovery	//服务发现，设置后忽略所有etcd配置，停止时不会关闭
 	MaxMsgSize	  int   			//最大消息大小
 	TLS			  bool				//是否启用TLS
 	CertFile	  string			//证书文件
 	KeyFile		  string			//密钥文件
+	PeerTLS		  *PeerTLS			//节点之间的mTLS，设置后忽略TLS、CertFile和KeyFile
+	Authenticator Authenticator		//识别调用方，为nil时不认证
+	ACL			  *ACL				//调用方对缓存组的权限
+	CallerLimit	  Limit				//每个调用方的请求速率限制
+	CallerLimits  map[string]Limit	//单独配置的调用方
+	MetricsAddr	  string			//Prometheus指标的HTTP监听地址，为空时不监听
+	HandoffTimeout time.Duration	//停止前向后继节点推送数据的超时时间，0表示不推送
+	DrainQuietPeriod time.Duration	//排空时连续多长时间没有新请求即可停止
+	DrainTimeout  time.Duration		//排空的最长时间
+	Weight		  int				//节点权重，注册到etcd后决定虚拟节点数
+	Capacity	  int64				//节点缓存容量（字节），设置后按容量计算权重
+	Zone		  string			//节点所在的可用区
+	Rack		  string			//节点所在的机架
+	NodeID		  string			//节点ID，默认为地址
+	AdvertiseAddr string			//对外通告的地址，默认为监听地址
 }
 
 //DefaultServerOptions 服务器默认配置
@@ -46,6 +83,9 @@ var DefaultServerOptions = &ServerOptions{
 	EtcdEndpoints:		[]string{"localhost:2379"},
 	DialTimeout:		5*time.Second,
 	MaxMsgSize:		4 << 20,//4MB
+	HandoffTimeout:	10*time.Second,
+	DrainQuietPeriod: 3*time.Second,
+	DrainTimeout:	30*time.Second,
 }
 
 //定义选项函数类型
@@ -65,6 +105,39 @@ func WithDialTimeout(timeout time.Duration) ServerOption{
 	}
 }
 
+//WithEtcdConfig 设置完整的etcd配置
+func WithEtcdConfig(config *registry.Config) ServerOption{
+	return func(o *ServerOptions){
+		o.Etcd = config
+	}
+}
+
+//WithEtcdClient 使用共享的etcd客户端（如与ClientPicker共用一个客户端）
+func WithEtcdClient(cli *clientv3.Client) ServerOption{
+	return func(o *ServerOptions){
+		o.EtcdClient = cli
+	}
+}
+
+//WithRegistry 设置注册本节点使用的服务发现（如registry.NewStaticDiscovery、registry.NewFileDiscovery），默认基于etcd
+//应与ClientPicker的WithDiscovery使用相同的服务发现
+func WithRegistry(d registry.Discovery) ServerOption{
+	return func(o *ServerOptions){
+		o.Discovery = d
+	}
+}
+
+//etcdConfig 返回创建etcd客户端使用的配置
+func (o *ServerOptions) etcdConfig() *registry.Config{
+	if o.Etcd != nil{
+		return o.Etcd
+	}
+	config := *registry.DefaultConfig
+	config.Endpoints = o.EtcdEndpoints
+	config.DialTimeout = o.DialTimeout
+	return &config
+}
+
 //WithTLS 设置TLS配置
 func WithTLS(certFile,keyFile string) ServerOption{
 	return func(o *ServerOptions){
@@ -74,51 +147,173 @@ func WithTLS(certFile,keyFile string) ServerOption{
 	}
 }
 
+//WithMutualTLS 启用mTLS，要求客户端出示由CA签发的证书，证书文件变化时自动重新加载
+func WithMutualTLS(t *PeerTLS) ServerOption{
+	return func(o *ServerOptions){
+		o.PeerTLS = t
+	}
+}
+
+//WithAuth 开启认证和按缓存组授权，节点之间的请求需要内部角色的凭证
+func WithAuth(authenticator Authenticator,acl *ACL) ServerOption{
+	return func(o *ServerOptions){
+		o.Authenticator = authenticator
+		o.ACL = acl
+	}
+}
+
+//WithCallerLimits 设置每个调用方的请求速率限制，overrides为单独配置的调用方
+//只有认证过的节点之间的请求不受限制；没有开启认证时节点之间的请求也按对端IP限制，需要在overrides中为节点IP放宽
+func WithCallerLimits(limit Limit,overrides map[string]Limit) ServerOption{
+	return func(o *ServerOptions){
+		o.CallerLimit = limit
+		o.CallerLimits = overrides
+	}
+}
+
+//WithMetricsAddr 在addr上以HTTP提供Prometheus指标（/metrics）
+func WithMetricsAddr(addr string) ServerOption{
+	return func(o *ServerOptions){
+		o.MetricsAddr = addr
+	}
+}
+
+//WithHandoffTimeout 设置停止前向后继节点推送数据的超时时间
+func WithHandoffTimeout(timeout time.Duration) ServerOption{
+	return func(o *ServerOptions){
+		o.HandoffTimeout = timeout
+	}
+}
+
+//WithDrainTimeout 设置排空的静默期和最长时间
+func WithDrainTimeout(quietPeriod,timeout time.Duration) ServerOption{
+	return func(o *ServerOptions){
+		o.DrainQuietPeriod = quietPeriod
+		o.DrainTimeout = timeout
+	}
+}
+
+//WithWeight 设置节点权重
+func WithWeight(weight int) ServerOption{
+	return func(o *ServerOptions){
+		o.Weight = weight
+	}
+}
+
+//WithCapacity 设置节点缓存容量（字节），按容量计算权重
+func WithCapacity(bytes int64) ServerOption{
+	return func(o *ServerOptions){
+		o.Capacity = bytes
+	}
+}
+
+//WithLocality 设置节点所在的可用区和机架，用于副本放置和就近读取
+func WithLocality(zone,rack string) ServerOption{
+	return func(o *ServerOptions){
+		o.Zone = zone
+		o.Rack = rack
+	}
+}
+
+//WithNodeID 设置节点ID
+func WithNodeID(id string) ServerOption{
+	return func(o *ServerOptions){
+		o.NodeID = id
+	}
+}
+
+//WithAdvertiseAddr 设置对外通告的地址（监听地址与其他节点访问的地址不同时使用）
+func WithAdvertiseAddr(addr string) ServerOption{
+	return func(o *ServerOptions){
+		o.AdvertiseAddr = addr
+	}
+}
+
 //NewServer 创建新的服务器实例
 func NewServer(addr, svcName string,opts ...ServerOption) (*Server,error){
-	options := DefaultServerOptions
+	defaults := *DefaultServerOptions//复制一份，避免选项函数修改全局默认配置
+	options := &defaults
 	for _,opt := range opts{
 		opt(options)
 	}
 
-	//创建etcd客户端
-	etcdCli,err := clientv3.New(clientv3.Config{
-		Endpoints:		options.EtcdEndpoints,
-		DialTimeout:	options.DialTimeout,
-	})
-	if err != nil{
-		return nil,fmt.Errorf("failed to create etcd client: %v",err)
+	//没有指定服务发现时使用etcd（没有共享的客户端时按配置创建）
+	discovery,ownsDiscovery := options.Discovery,false
+	switch{
+	case discovery != nil:
+	case options.EtcdClient != nil:
+		discovery = registry.NewEtcdDiscovery(options.EtcdClient,options.etcdConfig())
+	default:
+		d,err := registry.DialEtcdDiscovery(options.etcdConfig())
+		if err != nil{
+			return nil,err
+		}
+		discovery,ownsDiscovery = d,true
 	}
 
 	//创建gRPC服务器
 	var serverOpts []grpc.ServerOption
 	serverOpts = append(serverOpts,grpc.MaxRecvMsgSize(options.MaxMsgSize))
 
-	if options.TLS{
-		creds,err:= loadTLSCredentials(options.CertFile,options.KeyFile)
+	switch{
+	case options.PeerTLS != nil:
+		serverOpts = append(serverOpts,grpc.Creds(options.PeerTLS.ServerCredentials()))
+	case options.TLS:
+		t,err := NewPeerTLS(options.CertFile,options.KeyFile,"")//只加密，不校验客户端证书
 		if err != nil{
 			return nil,fmt.Errorf("failed to load TLS credentials: %v",err)
 		}
-		serverOpts = append(serverOpts,grpc.Creds(creds))
+		serverOpts = append(serverOpts,grpc.Creds(t.ServerCredentials()))
 	}
 
 	srv := &Server{
 		addr:			addr,
 		svcName:		svcName,
 		groups:			&sync.Map{},
-		grpcServer:		grpc.NewServer(serverOpts...),
-		etcdCli:		etcdCli,
+		discovery:		discovery,
+		ownsDiscovery:	ownsDiscovery,
 		stopCh:			make(chan error),
 		opts:			options,
+		healthServer:	health.NewServer(),
+	}
+
+	//使用etcd服务发现时参加选主，复用同一个etcd客户端
+	if d,ok := discovery.(*registry.EtcdDiscovery); ok{
+		id := options.NodeID
+		if id == ""{
+			id = addr
+		}
+		srv.election = registry.NewElection(d.Client(),svcName,id)
+		srv.election.OnChange(func(leader bool,token int64){
+			logrus.Infof("Server %s leadership changed: leader=%v, token=%d",addr,leader,token)
+		})
+	}
+
+	if options.MetricsAddr != ""{
+		mux := http.NewServeMux()
+		mux.Handle("/metrics",srv.MetricsHandler())
+		srv.metricsServer = &http.Server{Addr: options.MetricsAddr,Handler: mux}
 	}
 
+	if options.CallerLimit.Rate > 0 || len(options.CallerLimits) > 0{
+		srv.limiter = newLimiterSet(options.CallerLimit,options.CallerLimits)
+	}
+
+	//拦截器用于追踪、排空时判断是否还有请求、认证和授权、限流、比较哈希环纪元
+	serverOpts = append(serverOpts,
+		grpc.ChainUnaryInterceptor(srv.traceUnary,srv.trackUnary,srv.authorizeUnary,srv.limitUnary,srv.checkEpoch),
+		grpc.ChainStreamInterceptor(srv.trackStream,srv.authorizeStream),
+	)
+	srv.grpcServer = grpc.NewServer(serverOpts...)
+
 	//注册服务
 	pb.RegisterMyCacheServer(srv.grpcServer,srv)
+	pb.RegisterCacheAdminServer(srv.grpcServer,&adminServer{srv: srv})
 
 	//注册健康检查服务
-	healthServer := health.NewServer()
-	healthpb.RegisterHealthServer(srv.grpcServer,healthServer)
-	healthServer.SetServingStatus(svcName,healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv.grpcServer,srv.healthServer)
+	srv.healthServer.SetServingStatus(svcName,healthpb.HealthCheckResponse_SERVING)
+	srv.healthServer.SetServingStatus(svcName+".registration",healthpb.HealthCheckResponse_NOT_SERVING)
 
 	return srv,nil
 }
@@ -131,29 +326,213 @@ func (s *Server) Start() error{
 		return fmt.Errorf("failed to listen: %v",err)
 	}
 
-	//注册到etcd
-	stopCh := make(chan error)
-	go func(){
-		if err := registry.Register(s.svcName,s.addr,stopCh); err != nil{
-			logrus.Errorf("failed to register service: %v",err)
-			close(stopCh)
-			return
+	//缓存组变化时更新注册的缓存组（先监听再读取，启动期间新建的缓存组不会遗漏）
+	groupsCh := make(chan struct{},1)
+	unwatch := watchGroups(func(){
+		select{
+		case groupsCh <- struct{}{}:
+		default:
 		}
-	}()
+	})
+
+	//注册到服务发现(etcd租约丢失后自动重新注册，Stop关闭s.stopCh时注销)
+	regOpts := []registry.RegisterOption{
+		registry.WithWeight(s.opts.Weight),
+		registry.WithLocality(s.opts.Zone,s.opts.Rack),
+		registry.WithNodeID(s.opts.NodeID),
+		registry.WithAdvertiseAddr(s.opts.AdvertiseAddr),
+		registry.WithGroups(ListGroups()...),
+	}
+	if s.opts.Capacity > 0{
+		regOpts = append(regOpts,registry.WithCapacity(s.opts.Capacity))
+	}
+	reg,err := s.discovery.Register(s.svcName,s.addr,regOpts...)
+	if err != nil{
+		logrus.Errorf("failed to register service: %v",err)
+	}else{
+		s.registration.Store(reg)
+		reg.OnStateChange(s.onRegistrationState)
+		go reg.Run(s.stopCh)
+	}
+	if updater,ok := reg.(registry.GroupUpdater); ok && err == nil{
+		go s.syncGroups(updater,groupsCh,unwatch)
+	}else{
+		unwatch()
+	}
+
+	//参加选主，Stop关闭s.stopCh时放弃leader身份
+	if s.election != nil{
+		atomic.StoreInt32(&s.electing,1)
+		go s.election.Run(s.stopCh)
+	}
+
+	//提供Prometheus指标，Stop时关闭
+	if s.metricsServer != nil{
+		go func(){
+			if err := s.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed{
+				logrus.Errorf("Metrics server at %s stopped: %v",s.opts.MetricsAddr,err)
+			}
+		}()
+	}
 
 	logrus.Infof("Server starting at %s",s.addr)
 	return s.grpcServer.Serve(lis)
 }
 
+//RegistrationState 返回本节点在服务发现中的注册状态
+func (s *Server) RegistrationState() registry.State{
+	if reg,ok := s.registration.Load().(registry.Registrar); ok{
+		return reg.State()
+	}
+	return registry.StateRegistering
+}
+
+//onRegistrationState 注册状态变化时更新健康检查中的注册状态（服务名为<svcName>.registration）
+//注册丢失期间本节点仍能处理请求，但其他节点无法发现它，因此不影响服务本身的健康状态
+func (s *Server) onRegistrationState(state registry.State){
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if state == registry.StateRegistered{
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	s.healthServer.SetServingStatus(s.svcName+".registration",status)
+
+	if state == registry.StateLost{
+		logrus.Warnf("Server %s lost its registration",s.addr)
+	}
+}
+
+//syncGroups 缓存组创建或关闭时更新注册的缓存组，直到服务器停止
+func (s *Server) syncGroups(updater registry.GroupUpdater,groupsCh <-chan struct{},unwatch func()){
+	defer unwatch()
+	for{
+		select{
+		case <-s.stopCh:
+			return
+		case <-groupsCh:
+			if err := updater.SetGroups(ListGroups()...); err != nil{
+				logrus.Warnf("Server %s failed to update registered groups: %v",s.addr,err)
+			}
+		}
+	}
+}
+
+//IsLeader 返回本节点是否为集群的leader（服务发现不基于etcd时没有选主，总是返回false）
+func (s *Server) IsLeader() bool{
+	return s.election != nil && s.election.IsLeader()
+}
+
+//LeaderToken 返回本节点担任leader期间的fencing token，不是leader时返回0
+func (s *Server) LeaderToken() int64{
+	if s.election == nil{
+		return 0
+	}
+	return s.election.Token()
+}
+
+//OnLeaderChange 设置leader身份变化时的回调，用于启动和停止集群范围的任务
+func (s *Server) OnLeaderChange(fn func(leader bool,token int64)){
+	if s.election != nil{
+		s.election.OnChange(fn)
+	}
+}
+
+//Election 返回选主（服务发现不基于etcd时为nil）
+func (s *Server) Election() *registry.Election{
+	return s.election
+}
+
 //Stop 停止服务器
 func (s *Server) Stop(){
-	close(s.stopCh)
-	s.grpcServer.GracefulStop()
-	if s.etcdCli != nil{
-		s.etcdCli.Close()
+	s.shutdown(true)
+}
+
+//shutdown 停止服务器（只执行一次），handoff为true时先把本节点负责的数据推送给后继节点
+func (s *Server) shutdown(handoff bool){
+	s.stopOnce.Do(func(){
+		atomic.StoreInt32(&s.draining,1)
+
+		//注销之前推送数据，此时本节点仍在其他节点的哈希环上
+		if handoff && s.opts.HandoffTimeout > 0{
+			ctx,cancel := context.WithTimeout(context.Background(),s.opts.HandoffTimeout)
+			for _,name := range ListGroups(){
+				if group := GetGroup(name); group != nil{
+					group.handoff(ctx)
+				}
+			}
+			cancel()
+		}
+
+		s.deregister()
+		s.healthServer.Shutdown()//所有服务的健康状态置为NOT_SERVING
+		s.stopGRPC()
+		if s.metricsServer != nil{
+			s.metricsServer.Close()
+		}
+		if reg,ok := s.registration.Load().(registry.Registrar); ok{
+			select{
+			case <-reg.Done()://等待撤销租约后再关闭服务发现
+			case <-time.After(5*time.Second):
+			}
+		}
+		if atomic.LoadInt32(&s.electing) == 1{
+			select{
+			case <-s.election.Done()://等待放弃leader身份
+			case <-time.After(5*time.Second):
+			}
+		}
+		if s.ownsDiscovery{
+			s.discovery.Close()
+		}
+	})
+}
+
+//stopGRPC 优雅停止gRPC服务器
+//健康检查的Watch长连接不会自己结束，GracefulStop会一直等待，因此缓存请求处理完（或超过DrainTimeout）后强制关闭剩余的连接
+func (s *Server) stopGRPC(){
+	stopped := make(chan struct{})
+	go func(){
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	ticker := time.NewTicker(10*time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(s.opts.DrainTimeout)
+	for{
+		select{
+		case <-stopped:
+			return
+		case <-ticker.C:
+			if atomic.LoadInt64(&s.inflight) > 0{
+				continue
+			}
+		case <-deadline:
+		}
+		s.grpcServer.Stop()
+		<-stopped
+		return
 	}
 }
 
+//deregister 从服务发现注销（只执行一次）
+func (s *Server) deregister(){
+	s.deregisterOnce.Do(func(){
+		close(s.stopCh)
+	})
+}
+
+//checkEpoch 比较请求方和本节点的哈希环纪元（一元RPC拦截器）
+func (s *Server) checkEpoch(ctx context.Context,req interface{},info *grpc.UnaryServerInfo,handler grpc.UnaryHandler) (interface{},error){
+	if epoch,ok := epochFromContext(ctx); ok{
+		if r,ok := req.(interface{ GetGroup() string }); ok{
+			if group := GetGroup(r.GetGroup()); group != nil{
+				group.observeEpoch(epoch)
+			}
+		}
+	}
+	return handler(ctx,req)
+}
+
 //Get 实现Cache服务的Get方法
 func (s *Server) Get(ctx context.Context,req *pb.Request) (*pb.ResponseForGet,error){
 	group := GetGroup(req.Group)//根据名字找对应的缓存组
@@ -161,9 +540,11 @@ func (s *Server) Get(ctx context.Context,req *pb.Request) (*pb.ResponseForGet,er
 		return nil,fmt.Errorf("group %s not found",req.Group)
 	}
 
+	ctx = markForwarded(ctx)//其他节点转发过来的请求
+
 	view,err := group.Get(ctx,req.Key)
 	if err != nil{
-		return nil,err
+		return nil,toStatus(err)
 	}
 	return &pb.ResponseForGet{Value:view.ByteSlice()},nil
 }
@@ -175,14 +556,11 @@ func (s *Server) Set(ctx context.Context, req *pb.Request) (*pb.ResponseForGet,
 		return nil, fmt.Errorf("group %s not found", req.Group)
 	}
 
-	//从context中获取标记，如果没有就创建新的context
-	fromPeer := ctx.Value("from_peer")
-	if fromPeer == nil{
-		ctx = context.WithValue(ctx,"from_peer",true)
-	}
+	//CacheClient等客户端直接发送的写入由本节点写数据源、广播失效通知并同步（其他节点的同步走Replicate）
+	ctx = markFromPeer(ctx)
 
 	if err := group.Set(ctx,req.Key,req.Value); err != nil{
-		return nil,err
+		return nil,toStatus(err)
 	}
 
 	return &pb.ResponseForGet{Value: req.Value},nil
@@ -195,18 +573,146 @@ func (s *Server) Delete(ctx context.Context, req *pb.Request) (*pb.ResponseForDe
 		return nil, fmt.Errorf("group %s not found", req.Group)
 	}
 
+	ctx = markFromPeer(ctx)
 	err := group.Delete(ctx, req.Key)
-	return &pb.ResponseForDelete{Value: err == nil}, err
+	return &pb.ResponseForDelete{Value: err == nil}, toStatus(err)
 }
 
-//loadTLSCredentials 加载TLS证书
-func loadTLSCredentials(certFile,keyFile string) (credentials.TransportCredentials, error){
-	cert,err := tls.LoadX509KeyPair(certFile,keyFile)
-	if err != nil{
-		return nil,err
+// Digest 实现Cache服务的Digest方法（反熵：返回与请求方共享键区间的默克尔树叶子）
+func (s *Server) Digest(ctx context.Context, req *pb.DigestRequest) (*pb.DigestResponse, error) {
+	if err := checkLeaves(req.Leaves); err != nil {
+		return nil, err
+	}
+
+	group := GetGroup(req.Group)
+	if group == nil {
+		return nil, fmt.Errorf("group %s not found", req.Group)
+	}
+
+	tree, err := group.digest(req.Peer, int(req.Leaves))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DigestResponse{Leaves: tree.Leaves()}, nil
+}
+
+// Sync 实现Cache服务的Sync方法（反熵：返回指定叶子桶内的缓存项）
+func (s *Server) Sync(ctx context.Context, req *pb.SyncRequest) (*pb.SyncResponse, error) {
+	if err := checkLeaves(req.Leaves); err != nil {
+		return nil, err
+	}
+
+	group := GetGroup(req.Group)
+	if group == nil {
+		return nil, fmt.Errorf("group %s not found", req.Group)
 	}
 
-	return credentials.NewTLS(&tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}),nil
-}
\ No newline at end of file
+	buckets := make([]int, 0, len(req.Buckets))
+	for _, b := range req.Buckets {
+		buckets = append(buckets, int(b))
+	}
+
+	entries, err := group.sharedEntries(req.Peer, int(req.Leaves), buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SyncResponse{Entries: entries}, nil
+}
+
+//checkLeaves 检查对端请求的叶子桶数量，避免按对端传来的数量分配过多内存
+func checkLeaves(leaves int32) error{
+	if leaves < 1 || leaves > merkle.MaxLeaves{
+		return status.Errorf(codes.InvalidArgument,"leaf count %d out of range [1,%d]",leaves,merkle.MaxLeaves)
+	}
+	return nil
+}
+
+// Peek 实现Cache服务的Peek方法（只查询本地缓存，不触发加载）
+func (s *Server) Peek(ctx context.Context, req *pb.Request) (*pb.ResponseForGet, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return nil, fmt.Errorf("group %s not found", req.Group)
+	}
+
+	view, ok := group.mainCache.Get(ctx, req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "key %s not found in local cache", req.Key)
+	}
+	return &pb.ResponseForGet{Value: view.ByteSlice()}, nil
+}
+
+// Transfer 实现Cache服务的Transfer方法（向新加入的节点发送其负责的缓存项）
+func (s *Server) Transfer(req *pb.TransferRequest, stream pb.MyCache_TransferServer) error {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return fmt.Errorf("group %s not found", req.Group)
+	}
+
+	return group.ownedEntries(req.Peer, stream.Send)
+}
+
+// Handoff 实现Cache服务的Handoff方法（接收离开集群的节点推送的缓存项）
+func (s *Server) Handoff(ctx context.Context, req *pb.HandoffRequest) (*pb.HandoffResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return nil, fmt.Errorf("group %s not found", req.Group)
+	}
+
+	return &pb.HandoffResponse{Accepted: int32(group.acceptEntries(req.Entries))}, nil
+}
+
+// Invalidate 实现Cache服务的Invalidate方法（删除本地缓存的副本）
+func (s *Server) Invalidate(ctx context.Context, req *pb.InvalidateRequest) (*pb.InvalidateResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		//对端不会重试这个错误
+		return nil, status.Errorf(codes.NotFound, "group %s not found", req.Group)
+	}
+
+	return &pb.InvalidateResponse{Purged: int32(group.invalidateLocal(req.Keys))}, nil
+}
+
+// Replicate 实现Cache服务的Replicate方法（其他节点同步过来的写入/删除，只修改本地缓存）
+func (s *Server) Replicate(ctx context.Context, req *pb.ReplicateRequest) (*pb.ReplicateResponse, error) {
+	group := GetGroup(req.Group)
+	if group == nil {
+		return nil, status.Errorf(codes.NotFound, "group %s not found", req.Group)
+	}
+
+	ctx = context.WithValue(ctx, "from_peer", true)
+	var err error
+	if req.Delete {
+		err = group.Delete(ctx, req.Key)
+	} else {
+		err = group.Set(ctx, req.Key, req.Value)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.ReplicateResponse{}, nil
+}
+
+//markForwarded 其他节点转发过来的Get在ctx中加上from_peer标记，本节点不会再转发
+//Get的from_peer只决定是否转发，不需要认证
+func markForwarded(ctx context.Context) context.Context{
+	if hasFromPeer(ctx){
+		return context.WithValue(ctx,"from_peer",true)
+	}
+	return ctx
+}
+
+//markFromPeer 认证过的缓存节点带有from-peer元数据时在ctx中加上from_peer标记
+//Set/Delete的from_peer会跳过数据源写入、同步和失效广播，不能相信调用方自己声明的身份，
+//没有开启认证时忽略该元数据（节点之间的同步走Replicate）
+func markFromPeer(ctx context.Context) context.Context{
+	if fromVerifiedPeer(ctx) && hasFromPeer(ctx){
+		return context.WithValue(ctx,"from_peer",true)
+	}
+	return ctx
+}
+
+//hasFromPeer 请求是否带有from-peer元数据
+func hasFromPeer(ctx context.Context) bool{
+	md,ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(fromPeerKey)) > 0
+}
@@ -2,6 +2,7 @@ package singleflight
 
 import(
 	"sync"
+	"sync/atomic"
 )
 
 //代表正在进行或已经结束的请求
@@ -14,12 +15,15 @@ type call struct{
 type Group struct{
 	m sync.Map//sync.Map是Go标准库sync包提供的一个并发安全的map实现
 	//适用于读多写少，key生命周期较长，多个goroutine并发访问
+	calls int64//原子变量，实际执行fn的次数
+	dedups int64//原子变量，等待其他调用结果（被合并）的次数
 }
 
 //Do 针对相同的key，保证多次调用Do(),都只会调用一次fn
 func (g *Group) Do(key string,fn func() (interface{},error)) (interface{},error){
 	if existing,ok := g.m.Load(key); ok{
 		c := existing.(*call)//使用Load操作得到值后，需要通过类型断言确定值的类型
+		atomic.AddInt64(&g.dedups,1)
 		c.wg.Wait()//Done函数执行之后，等待的所有进程开始执行
 		return c.val,c.err
 	}
@@ -28,6 +32,7 @@ func (g *Group) Do(key string,fn func() (interface{},error)) (interface{},error)
 	c := &call{}
 	c.wg.Add(1)
 	g.m.Store(key,c)
+	atomic.AddInt64(&g.calls,1)
 
 	c.val,c.err = fn()
 	c.wg.Done()//获取完成后执行Done函数
@@ -35,4 +40,9 @@ func (g *Group) Do(key string,fn func() (interface{},error)) (interface{},error)
 	g.m.Delete(key)//每个key用完就删（因为c的作用是合并同一时刻，大量相同key的请求，下一时刻则需要重新调用fn函数获取数据）
 
 	return c.val,c.err
-}
\ No newline at end of file
+}
+
+//Stats 返回实际执行fn的次数和被合并的调用次数
+func (g *Group) Stats() (calls,dedups int64){
+	return atomic.LoadInt64(&g.calls),atomic.LoadInt64(&g.dedups)
+}
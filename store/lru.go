@@ -3,6 +3,7 @@ package store
 import(
 	"container/list"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +19,8 @@ type lruCache struct{
 	cleanupInterval time.Duration	//存储的是过期间隔
 	cleanupTicker *time.Ticker
 	closeCh chan struct{}
+	evictions int64		//原子变量，淘汰次数
+	expirations int64	//原子变量，过期清理次数
 }
 
 type lruEntry struct{
@@ -67,7 +70,7 @@ func (c *lruCache) Get(key string) (Value,bool){
 		c.mu.RUnlock()
 
 		//异步进行删除过期项，同时避免在读锁内操作（避免死锁）
-		go c.Delete(key)
+		go c.expire(key)
 
 		return nil,false
 	}
@@ -200,6 +203,7 @@ func (c *lruCache) evict(){
 		if now.After(expTime){
 			if elem,ok := c.items[key]; ok{
 				c.removeElement(elem)
+				atomic.AddInt64(&c.expirations,1)
 			}
 		}
 	}
@@ -209,6 +213,7 @@ func (c *lruCache) evict(){
 		elem := c.list.Front()
 		if elem != nil{
 			c.removeElement(elem)
+			atomic.AddInt64(&c.evictions,1)
 		}
 	}
 }//区别定时器清理（每个一个时间间隔清理一次），该方法是进行添加或更改操作后，防止缓存溢出从而主动进行清理
@@ -315,4 +320,50 @@ func (c *lruCache) SetMaxBytes(maxBytes int64){
 	if maxBytes > 0{
 		c.evict()
 	}
-}
\ No newline at end of file
+}
+
+//绑定方法17：遍历所有未过期的缓存项（按从旧到新的顺序），fn返回false时停止遍历
+func (c *lruCache) Range(fn func(key string,value Value,ttl time.Duration) bool){
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	for elem := c.list.Front(); elem != nil; elem = elem.Next(){
+		entry := elem.Value.(*lruEntry)
+
+		var ttl time.Duration
+		if expTime,hasExp := c.expires[entry.key]; hasExp{
+			if now.After(expTime){
+				continue//已过期的项跳过，等待清理协程删除
+			}
+			ttl = expTime.Sub(now)
+		}
+
+		if !fn(entry.key,entry.value,ttl){
+			return
+		}
+	}
+}
+
+//绑定方法18：删除Get时发现的过期项（仍然过期时才删除，避免删除刚写入的新值）
+func (c *lruCache) expire(key string){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expTime,hasExp := c.expires[key]
+	if !hasExp || !time.Now().After(expTime){
+		return
+	}
+	if elem,ok := c.items[key]; ok{
+		c.removeElement(elem)
+		atomic.AddInt64(&c.expirations,1)
+	}
+}
+
+//绑定方法19：返回淘汰和过期统计
+func (c *lruCache) Metrics() Metrics{
+	return Metrics{
+		Evictions: atomic.LoadInt64(&c.evictions),
+		Expirations: atomic.LoadInt64(&c.expirations),
+	}
+}
@@ -19,6 +19,7 @@ type lru2Store struct{
 	onEvicted func(key string,value Value)	//驱逐回调函数
 	cleanupTick *time.Ticker				//定期清理定时器
 	mask int32								//用于哈希取模的掩码（使桶的数量为2的幂，便于使用位运算快速定位）
+	expirations int64						//原子变量，过期清理次数
 }//实现了1.分桶并发控制2.两级缓存架构3.数据驱逐时回调
 
 type cache struct{
@@ -27,6 +28,7 @@ type cache struct{
 	hmap map[string]uint16	//键到节点索引的映射
 	last uint16				//最后一个节点元素的索引(用于添加新元素)
 	//uint16范围是0-65535
+	evictions int64			//容量已满时淘汰的节点数（由桶的锁保护）
 }//实现了1.用二维数组模拟双向链表2.预分配内存池（m）3.快速查找映射4.内存管理（用last来管理已分配的节点）
 
 type node struct{
@@ -146,8 +148,11 @@ func (c *cache) put(key string,val Value,expireAt int64,onEvicted func(string,Va
 	//2.如果容量已满，则复用最后的索引节点（准备删除的节点）（减少了GC压力）
 	if c.last == uint16(cap(c.m)){//cap表示切片的最大容量，len表示切片的当前容量
 		tail := &c.m[c.dlnk[0][p]-1]
-		if onEvicted != nil && (*tail).expireAt>0{
-			onEvicted((*tail).k,(*tail).v)
+		if (*tail).expireAt>0{
+			c.evictions++
+			if onEvicted != nil{
+				onEvicted((*tail).k,(*tail).v)
+			}
 		}//复用节点前，先调用回调函数
 
 		delete(c.hmap,(*tail).k)
@@ -240,6 +245,7 @@ func (s *lru2Store) Get(key string) (Value,bool){
 		//1.1找到了缓存项，但是过期了
 		if expireAt > 0 && currentTime>=expireAt{
 			s.delete(key,idx)
+			atomic.AddInt64(&s.expirations,1)
 			fmt.Println("找到项目已过期，删除它")
 			return nil,false
 		}
@@ -256,6 +262,7 @@ func (s *lru2Store) Get(key string) (Value,bool){
 		//2.1找到了，但是过期了
 		if n2.expireAt >0 && currentTime>= n2.expireAt{
 			s.delete(key,idx)
+			atomic.AddInt64(&s.expirations,1)
 			fmt.Println("找到项目已过期，删除它")
 			return nil,false
 		}
@@ -388,7 +395,45 @@ func (s *lru2Store) Close(){
 	}//必须手动关闭计时器，否则会导致资源泄露
 }
 
-//8.定时器定时清理过期项
+//8.遍历所有未过期的缓存项，fn返回false时停止遍历
+func (s *lru2Store) Range(fn func(key string,value Value,ttl time.Duration) bool){
+	for i := range s.caches{
+		currentTime := Now()
+		var keys []string
+		var values []Value
+		var ttls []time.Duration
+		seen := make(map[string]struct{})
+
+		s.locks[i].Lock()
+		//一级缓存中的数据比二级缓存更新（Set只写入一级缓存），因此先遍历一级缓存
+		for level := 0; level < 2; level++{
+			s.caches[i][level].walk(func(key string,value Value,expireAt int64) bool{
+				if _,ok := seen[key]; ok{
+					return true
+				}//避免键值重复
+				seen[key] = struct{}{}
+
+				if currentTime >= expireAt{
+					return true
+				}//已过期
+				keys = append(keys,key)
+				values = append(values,value)
+				ttls = append(ttls,time.Duration(expireAt-currentTime))
+				return true
+			})
+		}
+		s.locks[i].Unlock()
+
+		//在锁外调用回调，避免回调中访问缓存造成死锁
+		for j := range keys{
+			if !fn(keys[j],values[j],ttls[j]){
+				return
+			}
+		}
+	}
+}
+
+//9.定时器定时清理过期项
 func (s *lru2Store) cleanupLoop(){
 	//本质与遍历所有缓存项类似
 	for range s.cleanupTick.C{
@@ -422,9 +467,20 @@ func (s *lru2Store) cleanupLoop(){
 			for _,key := range expiredKeys{
 				s.delete(key,int32(i))
 			}
+			atomic.AddInt64(&s.expirations,int64(len(expiredKeys)))
 
 			s.locks[i].Unlock()
 		}
 	}
-}	
+}
 
+//10.返回淘汰和过期统计
+func (s *lru2Store) Metrics() Metrics{
+	m := Metrics{Expirations: atomic.LoadInt64(&s.expirations)}
+	for i := range s.caches{
+		s.locks[i].Lock()
+		m.Evictions += s.caches[i][0].evictions + s.caches[i][1].evictions
+		s.locks[i].Unlock()
+	}
+	return m
+}
@@ -14,8 +14,20 @@ type Store interface{
 	Clear()
 	Len() int
 	Close()
+	Range(fn func(key string,value Value,ttl time.Duration) bool)//遍历所有未过期的缓存项，ttl为0表示永不过期
 }//lruCache和lru2Store都实现了该接口
 
+//Metrics 存储的淘汰和过期统计
+type Metrics struct{
+	Evictions int64		//因容量不足被淘汰的缓存项数
+	Expirations int64	//因过期被清理的缓存项数
+}
+
+//MetricsReporter 由统计淘汰和过期次数的存储实现
+type MetricsReporter interface{
+	Metrics() Metrics
+}
+
 type CacheType string
 //新类型定义
 
@@ -0,0 +1,242 @@
+package mycache
+
+import(
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+)
+
+//节点之间的双向TLS（mTLS）
+//PeerTLS持有本节点的证书和CA证书包，同时用于服务端和客户端：
+//	1.服务端出示本节点证书，并要求对端出示由CA签发的客户端证书
+//	2.客户端出示本节点证书，用CA（没有配置CA时用系统根证书）校验服务端证书，
+//	  并校验证书中的名称与服务发现中注册的节点身份一致（节点ID或地址中的主机）
+//	3.证书轮换不需要重启：握手时距上次检查超过ReloadInterval就检查证书文件的修改时间，有变化时重新加载，
+//	  加载失败（如证书和私钥只替换了一个）时继续使用旧证书，下次握手再重试；已经建立的连接不受影响
+//	  检查是在握手路径上同步stat三个文件，每个间隔最多一次且不持有锁；证书放在慢速的网络文件系统上时应调大间隔或设为0，改为手动调用Reload
+
+//DefaultTLSReloadInterval 默认检查证书文件变化的间隔
+const DefaultTLSReloadInterval = 10*time.Second
+
+//PeerTLS 节点之间通信的TLS配置，支持证书热加载
+type PeerTLS struct{
+	certFile string
+	keyFile string
+	caFile string
+	serverName string			//校验服务端证书使用的名称，为空时使用节点身份
+	interval time.Duration		//检查证书文件变化的间隔
+	mu sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	modTimes [3]time.Time		//证书、私钥、CA文件的修改时间
+	checkedAt time.Time
+}
+
+//TLSOption 定义PeerTLS的选项函数
+type TLSOption func(*PeerTLS)
+
+//WithReloadInterval 设置检查证书文件变化的间隔，0表示不热加载
+func WithReloadInterval(d time.Duration) TLSOption{
+	return func(t *PeerTLS){
+		t.interval = d
+	}
+}
+
+//WithServerName 所有节点使用同一个证书名称时，设置校验服务端证书的名称
+func WithServerName(name string) TLSOption{
+	return func(t *PeerTLS){
+		t.serverName = name
+	}
+}
+
+//NewPeerTLS 加载证书、私钥和CA证书包
+//caFile为空时服务端不要求客户端证书，客户端用系统根证书校验服务端证书
+func NewPeerTLS(certFile,keyFile,caFile string,opts ...TLSOption) (*PeerTLS,error){
+	t := &PeerTLS{
+		certFile: certFile,
+		keyFile: keyFile,
+		caFile: caFile,
+		interval: DefaultTLSReloadInterval,
+	}
+	for _,opt := range opts{
+		opt(t)
+	}
+	if err := t.Reload(); err != nil{
+		return nil,err
+	}
+	return t,nil
+}
+
+//1.Reload 重新加载证书文件
+func (t *PeerTLS) Reload() error{
+	modTimes := t.statFiles()
+
+	var cert *tls.Certificate
+	if t.certFile != ""{
+		c,err := tls.LoadX509KeyPair(t.certFile,t.keyFile)
+		if err != nil{
+			return fmt.Errorf("failed to load certificate: %v",err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if t.caFile != ""{
+		data,err := os.ReadFile(t.caFile)
+		if err != nil{
+			return fmt.Errorf("failed to read CA file: %v",err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data){
+			return fmt.Errorf("no certificates found in CA file %s",t.caFile)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert,t.pool = cert,pool
+	t.modTimes = modTimes
+	t.checkedAt = time.Now()
+	return nil
+}
+
+//2.ServerCredentials 返回gRPC服务端使用的凭证，配置了CA时要求客户端出示证书
+func (t *PeerTLS) ServerCredentials() credentials.TransportCredentials{
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config,error){
+			cert,pool := t.current()
+			if cert == nil{
+				return nil,errors.New("mycache: no server certificate")
+			}
+			config := &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos: []string{"h2"},//返回的配置会替换gRPC设置的ALPN
+			}
+			if pool != nil{
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = pool
+			}
+			return config,nil
+		},
+	})
+}
+
+//3.ClientCredentials 返回访问node使用的凭证，服务端证书需要由CA签发且名称与节点身份一致
+func (t *PeerTLS) ClientCredentials(node registry.Node) credentials.TransportCredentials{
+	names := t.identities(node)
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//CA会热加载，证书链和名称在VerifyConnection中用当前的CA校验
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate,error){
+			if cert,_ := t.current(); cert != nil{
+				return cert,nil
+			}
+			return &tls.Certificate{},nil//没有证书时不出示
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error{
+			return t.verifyServer(cs,names)
+		},
+	})
+}
+
+//identities 返回node的证书中应包含的名称
+func (t *PeerTLS) identities(node registry.Node) []string{
+	if t.serverName != ""{
+		return []string{t.serverName}
+	}
+	var names []string
+	if node.ID != "" && node.ID != node.Addr{
+		names = append(names,node.ID)
+	}
+	host,_,err := net.SplitHostPort(node.Addr)
+	if err != nil{
+		host = node.Addr
+	}
+	return append(names,host)
+}
+
+//verifyServer 用当前的CA（没有CA时用系统根证书）校验服务端证书链，并校验证书名称与节点身份之一一致
+func (t *PeerTLS) verifyServer(cs tls.ConnectionState,names []string) error{
+	_,pool := t.current()//pool为nil时Verify使用系统根证书
+	if len(cs.PeerCertificates) == 0{
+		return errors.New("mycache: peer presented no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _,cert := range cs.PeerCertificates[1:]{
+		intermediates.AddCert(cert)
+	}
+	leaf := cs.PeerCertificates[0]
+	if _,err := leaf.Verify(x509.VerifyOptions{Roots: pool,Intermediates: intermediates}); err != nil{
+		return fmt.Errorf("mycache: failed to verify peer certificate: %v",err)
+	}
+
+	var errs []error
+	for _,name := range names{
+		err := leaf.VerifyHostname(name)
+		if err == nil{
+			return nil
+		}
+		errs = append(errs,err)
+	}
+	return fmt.Errorf("mycache: peer certificate does not match node identity: %w",errors.Join(errs...))
+}
+
+//current 返回当前的证书和CA，距上次检查超过间隔时先检查文件是否变化
+func (t *PeerTLS) current() (*tls.Certificate,*x509.CertPool){
+	t.mu.RLock()
+	cert,pool := t.cert,t.pool
+	stale := t.interval > 0 && time.Since(t.checkedAt) >= t.interval
+	t.mu.RUnlock()
+	if !stale{
+		return cert,pool
+	}
+
+	t.mu.Lock()
+	if time.Since(t.checkedAt) < t.interval{//其他握手已经检查过
+		t.mu.Unlock()
+		return t.current()
+	}
+	t.checkedAt = time.Now()
+	modTimes := t.modTimes
+	t.mu.Unlock()
+
+	//在锁外检查文件，其他握手不需要等待文件系统
+	if t.statFiles() != modTimes{
+		if err := t.Reload(); err != nil{
+			logrus.Warnf("Failed to reload TLS certificates, keeping the previous ones: %v",err)
+		}else{
+			logrus.Infof("Reloaded TLS certificates from %s",t.certFile)
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.cert,t.pool
+}
+
+//statFiles 返回证书文件的修改时间，文件不存在时为零值
+func (t *PeerTLS) statFiles() [3]time.Time{
+	var modTimes [3]time.Time
+	for i,path := range []string{t.certFile,t.keyFile,t.caFile}{
+		if path == ""{
+			continue
+		}
+		if info,err := os.Stat(path); err == nil{
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
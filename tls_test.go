@@ -0,0 +1,206 @@
+package mycache
+
+import(
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+//testCA 测试用的CA
+type testCA struct{
+	cert *x509.Certificate
+	key *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T,dir string) *testCA{
+	key,_ := ecdsa.GenerateKey(elliptic.P256(),rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{CommonName: "test-ca"},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		IsCA: true,
+		KeyUsage: x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der,err := x509.CreateCertificate(rand.Reader,tmpl,tmpl,&key.PublicKey,key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	cert,_ := x509.ParseCertificate(der)
+	writePEM(t,filepath.Join(dir,"ca.pem"),"CERTIFICATE",der)
+	return &testCA{cert: cert,key: key}
+}
+
+//issue 签发证书，写入dir下的name.pem和name-key.pem
+func (ca *testCA) issue(t *testing.T,dir,name string,serial int64,ips ...net.IP){
+	key,_ := ecdsa.GenerateKey(elliptic.P256(),rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,x509.ExtKeyUsageClientAuth},
+		DNSNames: []string{name},
+		IPAddresses: ips,
+	}
+	der,err := x509.CreateCertificate(rand.Reader,tmpl,ca.cert,&key.PublicKey,ca.key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	keyDER,_ := x509.MarshalECPrivateKey(key)
+	writePEM(t,filepath.Join(dir,name+".pem"),"CERTIFICATE",der)
+	writePEM(t,filepath.Join(dir,name+"-key.pem"),"EC PRIVATE KEY",keyDER)
+}
+
+func writePEM(t *testing.T,path,typ string,der []byte){
+	if err := os.WriteFile(path,pem.EncodeToMemory(&pem.Block{Type: typ,Bytes: der}),0600); err != nil{
+		t.Fatal(err)
+	}
+}
+
+//waitListening 等待服务器开始监听
+func waitListening(t *testing.T,addr string){
+	for deadline := time.Now().Add(5*time.Second); time.Now().Before(deadline); time.Sleep(10*time.Millisecond){
+		if conn,err := net.Dial("tcp",addr); err == nil{
+			conn.Close()
+			return
+		}
+	}
+	t.Fatalf("server at %s did not start listening",addr)
+}
+
+func TestMutualTLS(t *testing.T){
+	dir := t.TempDir()
+	ca := newTestCA(t,dir)
+	ca.issue(t,dir,"node",2,net.ParseIP("127.0.0.1"))
+	ca.issue(t,dir,"app",3)
+	caFile := filepath.Join(dir,"ca.pem")
+
+	serverTLS,err := NewPeerTLS(filepath.Join(dir,"node.pem"),filepath.Join(dir,"node-key.pem"),caFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	discovery := registry.NewStaticDiscovery(addr)
+	srv,err := NewServer(addr,"tls-test",WithRegistry(discovery),WithHandoffTimeout(0),WithMutualTLS(serverTLS))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+	waitListening(t,addr)
+
+	NewGroup("tls-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("source:"+key),nil
+	}))
+	defer DestroyGroup("tls-test")
+
+	get := func(t *PeerTLS) error{
+		client,err := NewCacheClient("tls-test",discovery,WithClientTLS(t),WithCallTimeout(2*time.Second))
+		if err != nil{
+			return err
+		}
+		defer client.Close()
+		_,err = client.Get(context.Background(),"tls-test","k")
+		return err
+	}
+
+	//客户端证书由CA签发，服务端证书与节点地址一致
+	appTLS,err := NewPeerTLS(filepath.Join(dir,"app.pem"),filepath.Join(dir,"app-key.pem"),caFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := get(appTLS); err != nil{
+		t.Fatalf("mTLS request failed: %v",err)
+	}
+
+	//不出示客户端证书
+	anonTLS,err := NewPeerTLS("","",caFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := get(anonTLS); err == nil{
+		t.Fatal("request without client certificate should fail")
+	}
+
+	//没有配置CA时用系统根证书校验，测试CA签发的服务端证书不被信任
+	systemTLS,err := NewPeerTLS(filepath.Join(dir,"app.pem"),filepath.Join(dir,"app-key.pem"),"")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := get(systemTLS); err == nil{
+		t.Fatal("a client without a CA should not trust a certificate outside the system roots")
+	}
+
+	//服务端证书与期望的节点身份不一致
+	wrongTLS,err := NewPeerTLS(filepath.Join(dir,"app.pem"),filepath.Join(dir,"app-key.pem"),caFile,WithServerName("other-node"))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := get(wrongTLS); err == nil{
+		t.Fatal("request to a node with a mismatched identity should fail")
+	}
+}
+
+func TestPeerTLSReload(t *testing.T){
+	dir := t.TempDir()
+	ca := newTestCA(t,dir)
+	ca.issue(t,dir,"node",2)
+
+	pt,err := NewPeerTLS(filepath.Join(dir,"node.pem"),filepath.Join(dir,"node-key.pem"),filepath.Join(dir,"ca.pem"),WithReloadInterval(10*time.Millisecond))
+	if err != nil{
+		t.Fatal(err)
+	}
+	serial := func() int64{
+		cert,_ := pt.current()
+		leaf,err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil{
+			t.Fatal(err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+	if serial() != 2{
+		t.Fatal("unexpected initial certificate")
+	}
+
+	//轮换证书，修改时间需要变化
+	ca.issue(t,dir,"node",4)
+	later := time.Now().Add(time.Second)
+	for _,name := range []string{"node.pem","node-key.pem"}{
+		os.Chtimes(filepath.Join(dir,name),later,later)
+	}
+	time.Sleep(20*time.Millisecond)
+	if serial() != 4{
+		t.Fatal("certificate was not reloaded after rotation")
+	}
+
+	//加载失败时继续使用旧证书
+	os.WriteFile(filepath.Join(dir,"node-key.pem"),[]byte("garbage"),0600)
+	later = later.Add(time.Second)
+	os.Chtimes(filepath.Join(dir,"node-key.pem"),later,later)
+	time.Sleep(20*time.Millisecond)
+	if serial() != 4{
+		t.Fatal("broken certificate should not replace the previous one")
+	}
+}
@@ -0,0 +1,207 @@
+package mycache
+
+import(
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/Rampage-cd/DistributedCache/consistenthash"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/metadata"
+)
+
+//集群统一的哈希环
+//服务发现支持拓扑存储（registry.TopologyStore，如etcd）时，哈希环由存储的拓扑（registry.Topology）决定，而不是各节点看到的注册事件：
+//	1.服务注册/注销时，节点根据etcd上的注册列表发布新拓扑（CAS，纪元加一；设置了Leader时只由leader发布）
+//	2.所有节点watch拓扑，收到更大的纪元时在写锁内一次性替换哈希环
+//	3.节点之间的请求携带发送方的纪元，接收方发现不一致时记录到统计信息，发现自己落后时立即重新读取拓扑
+//在第一次拿到拓扑之前（纪元为0），或者服务发现不支持拓扑存储时，哈希环由本节点和已发现的节点组成
+
+//epochKey 携带哈希环纪元的gRPC元数据键
+const epochKey = "x-mycache-ring-epoch"
+
+//Leader 集群leader的判断（Server实现了该接口）
+type Leader interface{
+	//IsLeader 返回本节点是否为leader
+	IsLeader() bool
+	//OnLeaderChange 设置leader身份变化时的回调
+	OnLeaderChange(fn func(leader bool,token int64))
+}
+
+//1.Epoch 返回当前哈希环的纪元，0表示还没有拿到集群拓扑
+func (p *ClientPicker) Epoch() uint64{
+	return atomic.LoadUint64(&p.epoch)
+}
+
+//2.ObserveEpoch 收到其他节点的纪元，比本节点新时触发重新读取拓扑
+func (p *ClientPicker) ObserveEpoch(epoch uint64){
+	if epoch <= p.Epoch(){
+		return
+	}
+	select{
+	case p.refreshCh <- struct{}{}:
+	default:
+	}
+}
+
+//3.topologyLoop 处理拓扑的发布、监听和刷新
+func (p *ClientPicker) topologyLoop(){
+	updates := p.topology.WatchTopology(p.ctx,p.svcName)//先监听，避免错过发布期间其他节点的更新
+	if !p.canPublish(){
+		if err := p.refreshTopology(); err != nil{
+			logrus.Warnf("Failed to read topology, using local ring: %v",err)
+		}
+	}else if err := p.publishTopology(); err != nil{
+		logrus.Warnf("Failed to publish topology, using local ring: %v",err)
+	}
+
+	for{
+		select{
+		case <-p.ctx.Done():
+			return
+		case t,ok := <-updates:
+			if !ok{
+				return
+			}
+			p.adoptTopology(t)
+		case <-p.publishCh:
+			if !p.canPublish(){
+				continue
+			}
+			if err := p.publishTopology(); err != nil{
+				logrus.Warnf("Failed to publish topology: %v",err)
+			}
+		case <-p.refreshCh:
+			if err := p.refreshTopology(); err != nil{
+				logrus.Warnf("Failed to refresh topology: %v",err)
+			}
+		}
+	}
+}
+
+//4.triggerPublish 成员变化后通知topologyLoop发布新拓扑（多次通知会合并）
+func (p *ClientPicker) triggerPublish(){
+	select{
+	case p.publishCh <- struct{}{}:
+	default:
+	}
+}
+
+//canPublish 没有设置leader时所有节点都可以发布拓扑（通过CAS保证一致），否则只有leader发布
+func (p *ClientPicker) canPublish() bool{
+	return p.leader == nil || p.leader.IsLeader()
+}
+
+//5.publishTopology 根据服务发现的节点列表发布拓扑，并采用发布后的拓扑
+func (p *ClientPicker) publishTopology() error{
+	ctx,cancel := context.WithTimeout(p.ctx,p.etcdConfig.Timeout())
+	defer cancel()
+
+	nodes,err := p.discovery.List(ctx,p.svcName)
+	if err != nil{
+		return err
+	}
+
+	members := make([]registry.Member,0,len(nodes))
+	for _,node := range nodes{
+		members = append(members,node.Member())
+	}
+
+	t,err := p.topology.PublishTopology(ctx,p.svcName,members,p.configuredReplicas)
+	if err != nil{
+		return err
+	}
+	p.adoptTopology(t)
+	return nil
+}
+
+//6.refreshTopology 重新读取拓扑
+func (p *ClientPicker) refreshTopology() error{
+	ctx,cancel := context.WithTimeout(p.ctx,p.etcdConfig.Timeout())
+	defer cancel()
+
+	t,err := p.topology.GetTopology(ctx,p.svcName)
+	if err != nil || t == nil{
+		return err
+	}
+	p.adoptTopology(t)
+	return nil
+}
+
+//7.adoptTopology 采用纪元更大的拓扑，在写锁内一次性替换哈希环
+func (p *ClientPicker) adoptTopology(t *registry.Topology) bool{
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if t.Epoch <= p.epoch{
+		return false
+	}
+
+	want := make(map[string]registry.Member,len(t.Members))
+	for _,m := range t.Members{
+		want[m.Addr] = m
+	}
+	for addr := range p.ring{
+		if _,ok := want[addr]; !ok{
+			p.partitioner.Remove(addr)
+			delete(p.ring,addr)
+		}
+	}
+	p.updateLocality()
+	_,weighted := p.partitioner.(consistenthash.WeightedPartitioner)
+	for addr,member := range want{
+		current,ok := p.ring[addr]
+		switch{
+		case !ok:
+			p.addToRing(member)
+		case current.Weight != member.Weight && weighted:
+			p.addToRing(member)//按新权重重新分配虚拟节点
+		default:
+			p.ring[addr] = member
+		}
+	}
+	if self,ok := want[p.selfAddr]; ok && p.zone == ""{
+		p.zone = self.Zone//没有指定本节点的可用区时，以注册信息为准
+	}
+	if t.Replicas > 0{
+		p.replicas = t.Replicas
+	}
+
+	atomic.StoreUint64(&p.epoch,t.Epoch)
+	logrus.Infof("Adopted ring epoch %d with %d members",t.Epoch,len(t.Members))
+	return true
+}
+
+//8.observeEpoch 比较请求方携带的纪元和本节点的纪元（供Server的拦截器调用）
+func (g *Group) observeEpoch(remote uint64){
+	tp,ok := g.peers.(TopologyPicker)
+	if !ok{
+		return
+	}
+	local := tp.Epoch()
+	if remote == local{
+		return
+	}
+
+	atomic.AddInt64(&g.stats.epochMismatches,1)
+	logrus.Debugf("[mycache] ring epoch mismatch in group [%s]: local %d, remote %d",g.name,local,remote)
+	tp.ObserveEpoch(remote)
+}
+
+//epochFromContext 从gRPC元数据中读取请求方的纪元
+func epochFromContext(ctx context.Context) (uint64,bool){
+	md,ok := metadata.FromIncomingContext(ctx)
+	if !ok{
+		return 0,false
+	}
+	values := md.Get(epochKey)
+	if len(values) == 0{
+		return 0,false
+	}
+	epoch,err := strconv.ParseUint(values[0],10,64)
+	if err != nil{
+		return 0,false
+	}
+	return epoch,true
+}
@@ -0,0 +1,135 @@
+package mycache
+
+import(
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/Rampage-cd/DistributedCache/consistenthash"
+	"github.com/Rampage-cd/DistributedCache/registry"
+)
+
+//newTopologyPicker 不连接etcd的ClientPicker，只用于测试拓扑的采用
+func newTopologyPicker(self string) *ClientPicker{
+	ctx,cancel := context.WithCancel(context.Background())
+	p := &ClientPicker{
+		selfAddr: self,
+		svcName: "topology-test",
+		replicas: 1,
+		configuredReplicas: 1,
+		partitioner: consistenthash.New(),
+		clients: make(map[string]*Client),
+		nodes: make(map[string]registry.Node),
+		ring: make(map[string]registry.Member),
+		publishCh: make(chan struct{},1),
+		refreshCh: make(chan struct{},1),
+		ctx: ctx,
+		cancel: cancel,
+	}
+	p.partitioner.Add(self)
+	p.ring[self] = registry.Member{Addr: self,Weight: 1}
+	return p
+}
+
+func ringMembers(p *ClientPicker) []string{
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var addrs []string
+	for addr := range p.ring{
+		addrs = append(addrs,addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+func TestPickerAdoptsTopology(t *testing.T){
+	picker := newTopologyPicker("self")
+	defer picker.cancel()
+
+	if !picker.adoptTopology(&registry.Topology{Epoch: 1,Replicas: 2,Members: []registry.Member{{Addr: "self",Weight: 1},{Addr: "b",Weight: 1}}}){
+		t.Fatal("epoch 1 should be adopted")
+	}
+	if got := ringMembers(picker); picker.Epoch() != 1 || len(got) != 2 || len(picker.Replicas("k")) != 2{
+		t.Fatalf("expected the ring from epoch 1, got %v",got)
+	}
+
+	//b离开，纪元加一
+	if !picker.adoptTopology(&registry.Topology{Epoch: 2,Members: []registry.Member{{Addr: "self",Weight: 1}}}){
+		t.Fatal("epoch 2 should be adopted")
+	}
+	if got := ringMembers(picker); len(got) != 1 || got[0] != "self"{
+		t.Fatalf("expected only self in epoch 2, got %v",got)
+	}
+
+	//旧纪元的拓扑（如延迟到达的watch事件）被忽略
+	stale := &registry.Topology{Epoch: 1,Members: []registry.Member{{Addr: "self",Weight: 1},{Addr: "b",Weight: 1},{Addr: "c",Weight: 1}}}
+	if picker.adoptTopology(stale) || picker.adoptTopology(&registry.Topology{Epoch: 2}){
+		t.Fatal("a stale topology should be rejected")
+	}
+	if got := ringMembers(picker); picker.Epoch() != 2 || len(got) != 1{
+		t.Fatalf("stale topology was adopted: epoch %d, members %v",picker.Epoch(),got)
+	}
+
+	//之后更新的纪元仍然会被采用
+	if !picker.adoptTopology(&registry.Topology{Epoch: 3,Members: []registry.Member{{Addr: "self",Weight: 1},{Addr: "c",Weight: 1}}}){
+		t.Fatal("epoch 3 should be adopted")
+	}
+	if got := ringMembers(picker); len(got) != 2 || got[0] != "c"{
+		t.Fatalf("expected the ring from epoch 3, got %v",got)
+	}
+}
+
+func TestTransferWaitsForTopology(t *testing.T){
+	picker := newTopologyPicker("old")
+	defer picker.Close()
+	picker.adoptTopology(&registry.Topology{Epoch: 1,Members: []registry.Member{{Addr: "old",Weight: 1}}})
+
+	name := "topology-transfer"
+	g := NewGroup(name,1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return nil,nil
+	}),WithPeers(picker))
+	defer DestroyGroup(name)
+	for i := 0; i < 64; i++{
+		g.mainCache.Add(fmt.Sprint("key-",i),ByteView{b: []byte("v")})
+	}
+
+	transfer := func() ([]*pb.Entry,error){
+		var entries []*pb.Entry
+		err := g.ownedEntries("new",func(e *pb.Entry) error{
+			entries = append(entries,e)
+			return nil
+		})
+		return entries,err
+	}
+
+	//新节点已经被发现，但拓扑还没有把它加入哈希环，返回Unavailable让它重试而不是返回空结果
+	conn,err := grpc.NewClient("127.0.0.1:1",grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil{
+		t.Fatal(err)
+	}
+	picker.mu.Lock()
+	picker.clients["new"] = &Client{addr: "new",conn: conn,grpcCli: pb.NewMyCacheClient(conn)}
+	picker.mu.Unlock()
+	if entries,err := transfer(); status.Code(err) != codes.Unavailable || len(entries) != 0{
+		t.Fatalf("expected Unavailable before the ring contains the joiner, got %d entries, %v",len(entries),err)
+	}
+
+	//采用包含新节点的拓扑后，返回由它负责的缓存项
+	picker.adoptTopology(&registry.Topology{Epoch: 2,Members: []registry.Member{{Addr: "old",Weight: 1},{Addr: "new",Weight: 1}}})
+	entries,err := transfer()
+	if err != nil || len(entries) == 0{
+		t.Fatalf("expected the joiner's entries after the topology update, got %d entries, %v",len(entries),err)
+	}
+	for _,e := range entries{
+		if !containsAddr(picker.Replicas(e.Key),"new"){
+			t.Fatalf("%s is not owned by the joiner",e.Key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package mycache
+
+import(
+	"context"
+	"sync/atomic"
+
+	"github.com/Rampage-cd/DistributedCache/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//分布式追踪
+//一次Group.Get可能经过本地查找、对端RPC、对端的singleflight和数据源，每一段都创建span：
+//	mycache.Group.Get -> mycache.cache.lookup
+//	                  -> mycache.Group.load（singleflight，属性mycache.singleflight.shared表示是否等待了其他请求的结果）
+//	                     -> /pb.MyCache/Get（client span） -> 对端的/pb.MyCache/Get（server span） -> 对端的mycache.Group.Get ...
+//	                     -> mycache.Getter.Get
+//trace context以W3C traceparent的格式放在gRPC元数据中，Client和CacheClient发送请求时携带，Server收到请求时解析
+//SetTracer设置所有缓存组和节点共用的Tracer，没有设置时不创建span
+
+//traceparentKey 元数据中的traceparent
+const traceparentKey = "traceparent"
+
+var tracer atomic.Pointer[tracing.Tracer]
+
+//SetTracer 设置Tracer，为nil时关闭追踪
+func SetTracer(t *tracing.Tracer){
+	tracer.Store(t)
+}
+
+//startSpan 创建span，没有设置Tracer时返回nil的span（方法可以在nil上调用）
+func startSpan(ctx context.Context,name string,kind tracing.SpanKind,attrs ...interface{}) (context.Context,*tracing.Span){
+	return tracer.Load().Start(ctx,name,kind,attrs...)
+}
+
+//endSpan 记录错误并结束span，用于defer
+func endSpan(span *tracing.Span,err *error){
+	span.RecordError(*err)
+	span.End()
+}
+
+//1.traceClientUnary 为发送的请求创建client span，并把trace context放入元数据（一元RPC拦截器）
+func traceClientUnary(ctx context.Context,method string,req,reply interface{},cc *grpc.ClientConn,invoker grpc.UnaryInvoker,opts ...grpc.CallOption) (err error){
+	ctx,span := startSpan(ctx,method,tracing.SpanKindClient,"rpc.system","grpc","server.address",cc.Target())
+	if span == nil{
+		return invoker(ctx,method,req,reply,cc,opts...)
+	}
+	defer func(){
+		span.SetAttribute("rpc.grpc.status_code",status.Code(err).String())
+		endSpan(span,&err)
+	}()
+
+	ctx = metadata.AppendToOutgoingContext(ctx,traceparentKey,span.SpanContext().Traceparent())
+	return invoker(ctx,method,req,reply,cc,opts...)
+}
+
+//2.traceUnary 解析请求中的trace context，为收到的请求创建server span（一元RPC拦截器）
+func (s *Server) traceUnary(ctx context.Context,req interface{},info *grpc.UnaryServerInfo,handler grpc.UnaryHandler) (resp interface{},err error){
+	if tracer.Load() == nil{
+		return handler(ctx,req)
+	}
+	if md,ok := metadata.FromIncomingContext(ctx); ok{
+		if values := md.Get(traceparentKey); len(values) > 0{
+			if sc,ok := tracing.ParseTraceparent(values[0]); ok{
+				ctx = tracing.ContextWithRemoteSpanContext(ctx,sc)
+			}
+		}
+	}
+
+	ctx,span := startSpan(ctx,info.FullMethod,tracing.SpanKindServer,"rpc.system","grpc","server.address",s.addr)
+	defer func(){
+		span.SetAttribute("rpc.grpc.status_code",status.Code(err).String())
+		endSpan(span,&err)
+	}()
+	return handler(ctx,req)
+}
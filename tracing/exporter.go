@@ -0,0 +1,366 @@
+package tracing
+
+import(
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//InMemoryExporter 把span保存在内存中，用于测试
+type InMemoryExporter struct{
+	mu sync.Mutex
+	spans []SpanData
+}
+
+//NewInMemoryExporter 创建InMemoryExporter
+func NewInMemoryExporter() *InMemoryExporter{
+	return &InMemoryExporter{}
+}
+
+//1.Export 保存span
+func (e *InMemoryExporter) Export(ctx context.Context,spans []SpanData) error{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans,spans...)
+	return nil
+}
+
+//2.Shutdown 无操作
+func (e *InMemoryExporter) Shutdown(ctx context.Context) error{
+	return nil
+}
+
+//3.Spans 返回已经结束的span，按结束顺序排列
+func (e *InMemoryExporter) Spans() []SpanData{
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil),e.spans...)
+}
+
+//4.Reset 清空保存的span
+func (e *InMemoryExporter) Reset(){
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+//OTLPOptions OTLPExporter的配置
+type OTLPOptions struct{
+	Headers map[string]string	//每个请求携带的HTTP头，如collector的认证信息
+	BatchSize int				//缓冲的span达到这个数量时立即发送
+	Interval time.Duration		//缓冲的span最长等待时间
+	MaxQueue int				//最多缓冲的span数，超出时丢弃新的span
+	Timeout time.Duration		//单次发送的超时时间
+	Client *http.Client
+}
+
+//DefaultOTLPOptions 默认配置
+var DefaultOTLPOptions = OTLPOptions{
+	BatchSize: 512,
+	Interval: 5*time.Second,
+	MaxQueue: 2048,
+	Timeout: 10*time.Second,
+}
+
+//OTLPExporter 按OTLP/HTTP的JSON格式把span批量发送给collector（如OpenTelemetry Collector、Jaeger、Tempo）
+//发送在后台进行，失败时记录错误并丢弃这一批，不影响请求路径
+type OTLPExporter struct{
+	endpoint string
+	opts OTLPOptions
+	mu sync.Mutex
+	queue []SpanData
+	flush chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	closeOnce sync.Once
+	exported int64
+	dropped int64
+	lastErr atomic.Value//error
+}
+
+//NewOTLPExporter 创建OTLPExporter，endpoint为collector的完整地址，如http://localhost:4318/v1/traces
+func NewOTLPExporter(endpoint string,opts OTLPOptions) *OTLPExporter{
+	if opts.BatchSize <= 0{
+		opts.BatchSize = DefaultOTLPOptions.BatchSize
+	}
+	if opts.Interval <= 0{
+		opts.Interval = DefaultOTLPOptions.Interval
+	}
+	if opts.MaxQueue <= 0{
+		opts.MaxQueue = DefaultOTLPOptions.MaxQueue
+	}
+	if opts.Timeout <= 0{
+		opts.Timeout = DefaultOTLPOptions.Timeout
+	}
+	if opts.Client == nil{
+		opts.Client = &http.Client{}
+	}
+	e := &OTLPExporter{
+		endpoint: endpoint,
+		opts: opts,
+		flush: make(chan struct{},1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+//1.Export 把span放入缓冲，缓冲已满或者已经关闭时丢弃
+func (e *OTLPExporter) Export(ctx context.Context,spans []SpanData) error{
+	select{
+	case <-e.stop:
+		atomic.AddInt64(&e.dropped,int64(len(spans)))
+		return nil
+	default:
+	}
+
+	e.mu.Lock()
+	n := min(len(spans),e.opts.MaxQueue-len(e.queue))
+	e.queue = append(e.queue,spans[:max(n,0)]...)
+	full := len(e.queue) >= e.opts.BatchSize
+	e.mu.Unlock()
+
+	if n < len(spans){
+		atomic.AddInt64(&e.dropped,int64(len(spans)-max(n,0)))
+	}
+	if full{
+		select{
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+//loop 定时或者缓冲达到BatchSize时发送
+func (e *OTLPExporter) loop(){
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for{
+		select{
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			return
+		}
+		e.send(context.Background())
+	}
+}
+
+//send 发送缓冲中的所有span
+func (e *OTLPExporter) send(ctx context.Context) error{
+	for{
+		e.mu.Lock()
+		n := min(len(e.queue),e.opts.BatchSize)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.mu.Unlock()
+		if n == 0{
+			return nil
+		}
+		if err := e.post(ctx,batch); err != nil{
+			atomic.AddInt64(&e.dropped,int64(n))
+			e.lastErr.Store(err)
+			return err
+		}
+		atomic.AddInt64(&e.exported,int64(n))
+	}
+}
+
+//post 发送一批span
+func (e *OTLPExporter) post(ctx context.Context,spans []SpanData) error{
+	body,err := json.Marshal(encodeOTLP(spans))
+	if err != nil{
+		return err
+	}
+	ctx,cancel := context.WithTimeout(ctx,e.opts.Timeout)
+	defer cancel()
+	req,err := http.NewRequestWithContext(ctx,http.MethodPost,e.endpoint,bytes.NewReader(body))
+	if err != nil{
+		return err
+	}
+	req.Header.Set("Content-Type","application/json")
+	for k,v := range e.opts.Headers{
+		req.Header.Set(k,v)
+	}
+	resp,err := e.opts.Client.Do(req)
+	if err != nil{
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard,resp.Body)
+	if resp.StatusCode/100 != 2{
+		return fmt.Errorf("otlp: collector returned %s",resp.Status)
+	}
+	return nil
+}
+
+//2.Shutdown 停止后台发送，发送缓冲中剩余的span
+func (e *OTLPExporter) Shutdown(ctx context.Context) error{
+	e.closeOnce.Do(func(){
+		close(e.stop)
+	})
+	select{
+	case <-e.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.send(ctx)
+}
+
+//3.Stats 返回发送成功和丢弃的span数，以及最近一次发送失败的原因
+func (e *OTLPExporter) Stats() map[string]interface{}{
+	stats := map[string]interface{}{
+		"exported": atomic.LoadInt64(&e.exported),
+		"dropped": atomic.LoadInt64(&e.dropped),
+	}
+	if err,ok := e.lastErr.Load().(error); ok{
+		stats["last_error"] = err.Error()
+	}
+	return stats
+}
+
+//OTLP/HTTP JSON编码（trace ID和span ID为十六进制字符串，64位整数为十进制字符串）
+type otlpRequest struct{
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct{
+	Resource otlpResource `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct{
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct{
+	Scope otlpScope `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct{
+	Name string `json:"name"`
+}
+
+type otlpSpan struct{
+	TraceID string `json:"traceId"`
+	SpanID string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId,omitempty"`
+	Name string `json:"name"`
+	Kind int `json:"kind"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	EndTimeUnixNano string `json:"endTimeUnixNano"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+	Status otlpStatus `json:"status"`
+}
+
+type otlpStatus struct{
+	Code int `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct{
+	Key string `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct{
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue *bool `json:"boolValue,omitempty"`
+	IntValue *string `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+//OTLP的SpanKind和StatusCode
+const(
+	otlpKindInternal = 1
+	otlpKindServer = 2
+	otlpKindClient = 3
+	otlpStatusError = 2
+)
+
+//encodeOTLP 按服务名分组编码
+func encodeOTLP(spans []SpanData) otlpRequest{
+	byService := make(map[string][]otlpSpan)
+	var services []string
+	for _,s := range spans{
+		if _,ok := byService[s.Service]; !ok{
+			services = append(services,s.Service)
+		}
+		byService[s.Service] = append(byService[s.Service],encodeSpan(s))
+	}
+
+	req := otlpRequest{}
+	for _,service := range services{
+		req.ResourceSpans = append(req.ResourceSpans,otlpResourceSpans{
+			Resource: otlpResource{Attributes: []otlpKeyValue{{Key: "service.name",Value: encodeValue(service)}}},
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "mycache"},Spans: byService[service]}},
+		})
+	}
+	return req
+}
+
+func encodeSpan(s SpanData) otlpSpan{
+	kind := otlpKindInternal
+	switch s.Kind{
+	case SpanKindServer:
+		kind = otlpKindServer
+	case SpanKindClient:
+		kind = otlpKindClient
+	}
+	span := otlpSpan{
+		TraceID: s.SpanContext.TraceID.String(),
+		SpanID: s.SpanContext.SpanID.String(),
+		Name: s.Name,
+		Kind: kind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(),10),
+		EndTimeUnixNano: strconv.FormatInt(s.End.UnixNano(),10),
+	}
+	if s.Parent.IsValid(){
+		span.ParentSpanID = s.Parent.String()
+	}
+	if s.Err != ""{
+		span.Status = otlpStatus{Code: otlpStatusError,Message: s.Err}
+	}
+
+	keys := make([]string,0,len(s.Attributes))
+	for k := range s.Attributes{
+		keys = append(keys,k)
+	}
+	sort.Strings(keys)
+	for _,k := range keys{
+		span.Attributes = append(span.Attributes,otlpKeyValue{Key: k,Value: encodeValue(s.Attributes[k])})
+	}
+	return span
+}
+
+func encodeValue(v interface{}) otlpValue{
+	switch v := v.(type){
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v,10)
+		return otlpValue{IntValue: &s}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+}
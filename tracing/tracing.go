@@ -0,0 +1,291 @@
+package tracing
+
+import(
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+//分布式追踪
+//不依赖OpenTelemetry的SDK，只实现缓存需要的部分：
+//	1.Tracer创建span，父span从ctx中获取（本地的span或者从请求中解析的远端span），没有父span时按采样率决定是否记录
+//	2.span结束时交给Exporter导出，InMemoryExporter用于测试，OTLPExporter按OTLP/HTTP的JSON格式批量发送给collector
+//	3.跨进程时以W3C Trace Context的traceparent格式传递trace ID、span ID和采样标志
+//Tracer为nil时Start返回nil的span，span的方法都可以在nil上调用，调用方不需要判断是否开启了追踪
+
+//TraceID trace的ID
+type TraceID [16]byte
+
+//SpanID span的ID
+type SpanID [8]byte
+
+func (t TraceID) String() string{
+	return hex.EncodeToString(t[:])
+}
+
+//IsValid 是否不全为0
+func (t TraceID) IsValid() bool{
+	return t != TraceID{}
+}
+
+func (s SpanID) String() string{
+	return hex.EncodeToString(s[:])
+}
+
+//IsValid 是否不全为0
+func (s SpanID) IsValid() bool{
+	return s != SpanID{}
+}
+
+//SpanContext 跨进程传递的span信息
+type SpanContext struct{
+	TraceID TraceID
+	SpanID SpanID
+	Sampled bool
+}
+
+//1.IsValid trace ID和span ID是否都有效
+func (sc SpanContext) IsValid() bool{
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+//2.Traceparent 格式化为W3C traceparent（version 00）
+func (sc SpanContext) Traceparent() string{
+	flags := "00"
+	if sc.Sampled{
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s",sc.TraceID,sc.SpanID,flags)
+}
+
+//ParseTraceparent 解析W3C traceparent，格式不正确或ID全为0时返回false
+//未知的更高版本按version 00的前四个字段解析
+func ParseTraceparent(s string) (SpanContext,bool){
+	parts := strings.Split(strings.TrimSpace(s),"-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4){
+		return SpanContext{},false
+	}
+	var sc SpanContext
+	var flags [1]byte
+	if !decodeHex(sc.TraceID[:],parts[1]) || !decodeHex(sc.SpanID[:],parts[2]) || !decodeHex(flags[:],parts[3]){
+		return SpanContext{},false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc,sc.IsValid()
+}
+
+func decodeHex(dst []byte,s string) bool{
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s{
+		return false
+	}
+	_,err := hex.Decode(dst,[]byte(s))
+	return err == nil
+}
+
+//SpanKind span的类型
+type SpanKind int
+
+const(
+	SpanKindInternal SpanKind = iota	//进程内的操作
+	SpanKindServer						//处理远端请求
+	SpanKindClient						//发送远端请求
+)
+
+func (k SpanKind) String() string{
+	switch k{
+	case SpanKindServer:
+		return "server"
+	case SpanKindClient:
+		return "client"
+	default:
+		return "internal"
+	}
+}
+
+//SpanData 结束的span，交给Exporter导出
+type SpanData struct{
+	Service string
+	Name string
+	Kind SpanKind
+	SpanContext SpanContext
+	Parent SpanID						//根span为全0
+	RemoteParent bool					//父span是否来自其他进程
+	Start time.Time
+	End time.Time
+	Attributes map[string]interface{}	//值为string、bool、int、int64或float64，其他类型导出时格式化为字符串
+	Err string							//非空表示span以错误结束
+}
+
+//Exporter 导出结束的span
+type Exporter interface{
+	Export(ctx context.Context,spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+//TracerOption Tracer的配置
+type TracerOption func(*Tracer)
+
+//WithSampleRatio 没有父span时记录trace的比例，默认为1（全部记录）
+//有父span时沿用父span的采样结果，保证一条trace在各个节点上要么都记录要么都不记录
+func WithSampleRatio(ratio float64) TracerOption{
+	return func(t *Tracer){
+		t.ratio = ratio
+	}
+}
+
+//Tracer 创建span
+type Tracer struct{
+	service string
+	exporter Exporter
+	ratio float64
+}
+
+//NewTracer 创建Tracer，service为导出时的服务名
+func NewTracer(service string,exporter Exporter,opts ...TracerOption) *Tracer{
+	t := &Tracer{service: service,exporter: exporter,ratio: 1}
+	for _,opt := range opts{
+		opt(t)
+	}
+	return t
+}
+
+//1.Start 创建ctx中span的子span，返回包含新span的ctx
+//attrs为属性名和属性值交替排列
+func (t *Tracer) Start(ctx context.Context,name string,kind SpanKind,attrs ...interface{}) (context.Context,*Span){
+	if t == nil{
+		return ctx,nil
+	}
+
+	s := &Span{tracer: t,data: SpanData{Service: t.service,Name: name,Kind: kind,Start: time.Now()}}
+	if parent := SpanContextFromContext(ctx); parent.IsValid(){
+		s.data.SpanContext.TraceID = parent.TraceID
+		s.data.SpanContext.Sampled = parent.Sampled
+		s.data.Parent = parent.SpanID
+		s.data.RemoteParent = SpanFromContext(ctx) == nil
+	}else{
+		rand.Read(s.data.SpanContext.TraceID[:])
+		s.data.SpanContext.Sampled = t.sample(s.data.SpanContext.TraceID)
+	}
+	rand.Read(s.data.SpanContext.SpanID[:])
+
+	for i := 0; i+1 < len(attrs); i += 2{
+		s.SetAttribute(fmt.Sprint(attrs[i]),attrs[i+1])
+	}
+	return ContextWithSpan(ctx,s),s
+}
+
+//sample 按trace ID的后8字节决定是否记录，同一个trace ID的结果总是相同
+func (t *Tracer) sample(id TraceID) bool{
+	if t.ratio >= 1{
+		return true
+	}
+	if t.ratio <= 0{
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(id[8:])>>11)/(1<<53) < t.ratio
+}
+
+//2.Shutdown 关闭Exporter，发送缓冲中的span
+func (t *Tracer) Shutdown(ctx context.Context) error{
+	if t == nil || t.exporter == nil{
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+//Span 正在进行的操作
+type Span struct{
+	tracer *Tracer
+	mu sync.Mutex
+	data SpanData
+	ended bool
+}
+
+//1.SpanContext 返回span的SpanContext
+func (s *Span) SpanContext() SpanContext{
+	if s == nil{
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+//2.SetAttribute 设置属性，未采样或已经结束的span忽略
+func (s *Span) SetAttribute(key string,value interface{}){
+	if s == nil || !s.data.SpanContext.Sampled{
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended{
+		return
+	}
+	if s.data.Attributes == nil{
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+//3.RecordError err不为nil时把span标记为错误
+func (s *Span) RecordError(err error){
+	if s == nil || err == nil || !s.data.SpanContext.Sampled{
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended{
+		s.data.Err = err.Error()
+	}
+}
+
+//4.End 结束span并导出，多次调用只导出一次
+func (s *Span) End(){
+	if s == nil{
+		return
+	}
+	s.mu.Lock()
+	if s.ended{
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled && s.tracer.exporter != nil{
+		s.tracer.exporter.Export(context.Background(),[]SpanData{data})
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+//ContextWithSpan 返回包含span的ctx
+func ContextWithSpan(ctx context.Context,s *Span) context.Context{
+	return context.WithValue(ctx,spanKey{},s)
+}
+
+//SpanFromContext 返回ctx中的span，没有时返回nil
+func SpanFromContext(ctx context.Context) *Span{
+	s,_ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+//ContextWithRemoteSpanContext 返回包含远端span的ctx，之后创建的span以它为父span
+func ContextWithRemoteSpanContext(ctx context.Context,sc SpanContext) context.Context{
+	return context.WithValue(ctx,remoteKey{},sc)
+}
+
+//SpanContextFromContext 返回ctx中本地span的SpanContext，没有本地span时返回远端span
+func SpanContextFromContext(ctx context.Context) SpanContext{
+	if s := SpanFromContext(ctx); s != nil{
+		return s.SpanContext()
+	}
+	sc,_ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import(
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T){
+	sc,ok := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sc.Sampled || sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7"{
+		t.Fatalf("unexpected span context: %+v",sc)
+	}
+	if sc.Traceparent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"{
+		t.Fatalf("unexpected traceparent: %s",sc.Traceparent())
+	}
+
+	for _,s := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00F067AA0BA902B7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}{
+		if _,ok := ParseTraceparent(s); ok{
+			t.Errorf("%q should be rejected",s)
+		}
+	}
+}
+
+func TestTracer(t *testing.T){
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer("test",exporter)
+
+	remote,_ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithRemoteSpanContext(context.Background(),remote)
+	ctx,parent := tracer.Start(ctx,"parent",SpanKindServer)
+	_,child := tracer.Start(ctx,"child",SpanKindInternal,"key","k")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+	parent.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2{
+		t.Fatalf("expected 2 spans, got %d",len(spans))
+	}
+	c,p := spans[0],spans[1]
+	if p.SpanContext.TraceID != remote.TraceID || p.Parent != remote.SpanID || !p.RemoteParent{
+		t.Fatalf("server span should continue the remote trace: %+v",p)
+	}
+	if c.SpanContext.TraceID != remote.TraceID || c.Parent != p.SpanContext.SpanID || c.RemoteParent{
+		t.Fatalf("child span should be parented to the server span: %+v",c)
+	}
+	if c.Err != "boom" || c.Attributes["key"] != "k"{
+		t.Fatalf("unexpected child span: %+v",c)
+	}
+
+	//未采样的trace不导出，但仍然传递
+	exporter.Reset()
+	unsampled := NewTracer("test",exporter,WithSampleRatio(0))
+	ctx,root := unsampled.Start(context.Background(),"root",SpanKindInternal)
+	_,inner := unsampled.Start(ctx,"inner",SpanKindInternal)
+	inner.End()
+	root.End()
+	if len(exporter.Spans()) != 0 || !root.SpanContext().IsValid() || inner.SpanContext().TraceID != root.SpanContext().TraceID{
+		t.Fatal("unsampled spans should propagate but not be exported")
+	}
+
+	//nil的Tracer和Span不做任何事
+	var none *Tracer
+	ctx,s := none.Start(context.Background(),"noop",SpanKindInternal)
+	s.SetAttribute("k","v")
+	s.End()
+	if SpanFromContext(ctx) != nil{
+		t.Fatal("nil tracer should not create spans")
+	}
+}
+
+func TestOTLPExporter(t *testing.T){
+	received := make(chan otlpRequest,1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,r *http.Request){
+		var req otlpRequest
+		if r.Header.Get("X-Token") != "secret" || json.NewDecoder(r.Body).Decode(&req) != nil{
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL,OTLPOptions{Headers: map[string]string{"X-Token": "secret"},Interval: time.Hour})
+	tracer := NewTracer("cache-node",exporter)
+	_,span := tracer.Start(context.Background(),"get",SpanKindClient,"hit",true,"size",int64(3))
+	span.End()
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil{
+		t.Fatal(err)
+	}
+
+	req := <-received
+	rs := req.ResourceSpans[0]
+	if *rs.Resource.Attributes[0].Value.StringValue != "cache-node"{
+		t.Fatalf("unexpected resource: %+v",rs.Resource)
+	}
+	s := rs.ScopeSpans[0].Spans[0]
+	if s.Name != "get" || s.Kind != otlpKindClient || s.TraceID != span.SpanContext().TraceID.String() || s.ParentSpanID != ""{
+		t.Fatalf("unexpected span: %+v",s)
+	}
+	if len(s.Attributes) != 2 || !*s.Attributes[0].Value.BoolValue || *s.Attributes[1].Value.IntValue != "3"{
+		t.Fatalf("unexpected attributes: %+v",s.Attributes)
+	}
+	if exporter.Stats()["exported"].(int64) != 1{
+		t.Fatalf("unexpected stats: %v",exporter.Stats())
+	}
+}
@@ -0,0 +1,80 @@
+package mycache
+
+import(
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"github.com/Rampage-cd/DistributedCache/tracing"
+)
+
+func TestTracePropagation(t *testing.T){
+	exporter := tracing.NewInMemoryExporter()
+	SetTracer(tracing.NewTracer("trace-test",exporter))
+	defer SetTracer(nil)
+
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"trace-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	NewGroup("trace-test",1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("source:"+key),nil
+	}))
+	defer DestroyGroup("trace-test")
+
+	client,err := NewClient(addr,"trace-test",nil)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+	ctx,root := startSpan(ctx,"request",tracing.SpanKindInternal)
+	if _,err := client.Get(ctx,"trace-test","k"); err != nil{
+		t.Fatal(err)
+	}
+	root.End()
+
+	spans := make(map[string]tracing.SpanData)
+	for _,s := range exporter.Spans(){
+		if s.SpanContext.TraceID != root.SpanContext().TraceID{
+			t.Fatalf("span %s belongs to another trace",s.Name)
+		}
+		if s.Kind == tracing.SpanKindServer{
+			s.Name = "server:"+s.Name
+		}
+		spans[s.Name] = s
+	}
+
+	//request -> client span -> server span -> Group.Get -> load -> Getter
+	chain := []string{"request","/pb.MyCache/Get","server:/pb.MyCache/Get","mycache.Group.Get","mycache.Group.load","mycache.Getter.Get"}
+	for i := 1; i < len(chain); i++{
+		parent,ok1 := spans[chain[i-1]]
+		child,ok2 := spans[chain[i]]
+		if !ok1 || !ok2{
+			t.Fatalf("missing span %s or %s in %v",chain[i-1],chain[i],exporter.Spans())
+		}
+		if child.Parent != parent.SpanContext.SpanID{
+			t.Fatalf("%s should be a child of %s",chain[i],chain[i-1])
+		}
+	}
+	if !spans["server:/pb.MyCache/Get"].RemoteParent{
+		t.Fatal("server span should have a remote parent")
+	}
+	if spans["mycache.cache.lookup"].Attributes["mycache.hit"] != false || spans["mycache.Group.load"].Attributes["mycache.singleflight.shared"] != false{
+		t.Fatalf("unexpected attributes: %v %v",spans["mycache.cache.lookup"].Attributes,spans["mycache.Group.load"].Attributes)
+	}
+}
@@ -0,0 +1,328 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//写入数据源
+//Getter只负责在未命中时读取数据源，Setter/Deleter负责把写操作持久化到数据源：
+//	1.write-through：Group.Set/Delete先写数据源，成功后才更新缓存并返回
+//	2.write-behind：Group.Set/Delete只更新缓存并入队，后台按key合并后异步刷到数据源，失败时重试；
+//	  重试次数用完后重新入队等待下一次刷写（期间该key有更新的写入时以新的为准），
+//	  队列已满或已经关闭而无法重新入队时交给OnDeadLetter，缓存中的值与数据源不再一致
+//从其他节点同步过来的写操作（from_peer）不会再写数据源，由发起写操作的节点负责
+
+//ErrWriteQueueFull write-behind队列已满
+var ErrWriteQueueFull = errors.New("write-behind queue is full")
+
+//ErrWriteQueueClosed write-behind队列已经关闭，关闭之后的写入不会再刷到数据源
+var ErrWriteQueueClosed = errors.New("write-behind queue is closed")
+
+//Setter 将键值写入数据源的接口
+type Setter interface{
+	Set(ctx context.Context,key string,value []byte) error
+}
+
+//SetterFunc函数类型实现Setter接口
+type SetterFunc func(ctx context.Context,key string,value []byte) error
+
+//Set方法实现Setter接口
+func (f SetterFunc) Set(ctx context.Context,key string,value []byte) error{
+	return f(ctx,key,value)
+}
+
+//Deleter 从数据源删除键的接口
+type Deleter interface{
+	Delete(ctx context.Context,key string) error
+}
+
+//DeleterFunc函数类型实现Deleter接口
+type DeleterFunc func(ctx context.Context,key string) error
+
+//Delete方法实现Deleter接口
+func (f DeleterFunc) Delete(ctx context.Context,key string) error{
+	return f(ctx,key)
+}
+
+//WriteMode 写入数据源的模式
+type WriteMode int
+
+const(
+	WriteAround WriteMode = iota	//只写缓存，不写数据源（默认）
+	WriteThrough					//同步写数据源
+	WriteBehind						//异步写数据源
+)
+
+//String 返回写入模式的名称
+func (m WriteMode) String() string{
+	switch m{
+	case WriteThrough:
+		return "write-through"
+	case WriteBehind:
+		return "write-behind"
+	default:
+		return "write-around"
+	}
+}
+
+//WriteBehindOptions write-behind配置选项
+type WriteBehindOptions struct{
+	QueueSize		int				//待写入的key数量上限（同一个key的多次写入只占一个位置）
+	FlushInterval	time.Duration	//刷写间隔
+	Workers			int				//并发写入数据源的协程数
+	MaxRetries		int				//单个key写入失败后的重试次数，0表示使用默认值，负数表示不重试
+	RetryBackoff	time.Duration	//第一次重试前的等待时间，之后每次翻倍
+	FlushTimeout	time.Duration	//关闭组时刷写剩余数据的超时时间
+	OnDeadLetter	func(key string,value []byte,err error)	//最终没有写入数据源的写操作（value为nil表示删除），为nil时只记录日志
+}
+
+//DefaultWriteBehindOptions 返回默认的write-behind配置
+func DefaultWriteBehindOptions() WriteBehindOptions{
+	return WriteBehindOptions{
+		QueueSize:		10000,
+		FlushInterval:	100*time.Millisecond,
+		Workers:		4,
+		MaxRetries:		3,
+		RetryBackoff:	100*time.Millisecond,
+		FlushTimeout:	10*time.Second,
+	}
+}
+
+//pendingWrite 待写入数据源的操作（同一个key只保留最后一次）
+type pendingWrite struct{
+	key string
+	value []byte//为nil表示删除
+}
+
+//writeBehindQueue write-behind队列
+type writeBehindQueue struct{
+	g *Group
+	opts WriteBehindOptions
+	mu sync.Mutex
+	pending map[string]*pendingWrite
+	closed bool//开始关闭后不再入队，保证入队的写操作都在最后一次刷写之前
+	stopCh chan struct{}
+	done chan struct{}
+}
+
+//newWriteBehindQueue 创建write-behind队列并启动刷写协程
+func newWriteBehindQueue(g *Group,opts WriteBehindOptions) *writeBehindQueue{
+	defaults := DefaultWriteBehindOptions()
+	if opts.QueueSize <= 0{
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.FlushInterval <= 0{
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	if opts.Workers <= 0{
+		opts.Workers = defaults.Workers
+	}
+	if opts.MaxRetries == 0{
+		opts.MaxRetries = defaults.MaxRetries
+	}else if opts.MaxRetries < 0{
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0{
+		opts.RetryBackoff = defaults.RetryBackoff
+	}
+	if opts.FlushTimeout <= 0{
+		opts.FlushTimeout = defaults.FlushTimeout
+	}
+
+	q := &writeBehindQueue{
+		g: g,
+		opts: opts,
+		pending: make(map[string]*pendingWrite),
+		stopCh: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go q.flushLoop()
+	return q
+}
+
+//1.enqueue 将写操作入队，同一个key的多次写入会合并为最后一次，开始关闭后返回ErrWriteQueueClosed
+func (q *writeBehindQueue) enqueue(key string,value []byte) error{
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed{
+		return ErrWriteQueueClosed
+	}
+	if _,exists := q.pending[key]; exists{
+		atomic.AddInt64(&q.g.stats.wbCoalesced,1)
+	}else if len(q.pending) >= q.opts.QueueSize{
+		return ErrWriteQueueFull
+	}
+
+	q.pending[key] = &pendingWrite{key: key,value: value}
+	atomic.AddInt64(&q.g.stats.wbQueued,1)
+	return nil
+}
+
+//2.flushLoop 定期把队列中的写操作刷到数据源，关闭时刷完剩余数据后退出
+func (q *writeBehindQueue) flushLoop(){
+	defer close(q.done)
+
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-ticker.C:
+			q.flush(context.Background())
+		case <-q.stopCh:
+			ctx,cancel := context.WithTimeout(context.Background(),q.opts.FlushTimeout)
+			q.flush(ctx)
+			cancel()
+			return
+		}
+	}
+}
+
+//3.flush 取出当前所有待写入的操作，按key分配给各个worker并发写入
+//同一个key总是由同一个worker处理，且本批次写完之前不会开始下一批次，保证同一个key的写入顺序
+func (q *writeBehindQueue) flush(ctx context.Context){
+	q.mu.Lock()
+	if len(q.pending) == 0{
+		q.mu.Unlock()
+		return
+	}
+	batch := q.pending
+	q.pending = make(map[string]*pendingWrite)
+	q.mu.Unlock()
+
+	shards := make([][]*pendingWrite,q.opts.Workers)
+	for key,w := range batch{
+		h := fnv.New32a()
+		h.Write([]byte(key))
+		idx := int(h.Sum32() % uint32(q.opts.Workers))
+		shards[idx] = append(shards[idx],w)
+	}
+
+	var wg sync.WaitGroup
+	for _,shard := range shards{
+		if len(shard) == 0{
+			continue
+		}
+		wg.Add(1)
+		go func(writes []*pendingWrite){
+			defer wg.Done()
+			for _,w := range writes{
+				q.write(ctx,w)
+			}
+		}(shard)
+	}
+	wg.Wait()
+}
+
+//4.write 将单个写操作写入数据源，失败时按指数退避重试
+func (q *writeBehindQueue) write(ctx context.Context,w *pendingWrite){
+	backoff := q.opts.RetryBackoff
+	var err error
+	for attempt := 0; attempt <= q.opts.MaxRetries; attempt++{
+		if attempt > 0{
+			select{
+			case <-ctx.Done():
+				attempt = q.opts.MaxRetries//超时后不再重试
+			case <-time.After(backoff):
+				backoff *= 2
+			}
+		}
+
+		if w.value == nil{
+			err = q.g.deleter.Delete(ctx,w.key)
+		}else{
+			err = q.g.setter.Set(ctx,w.key,w.value)
+		}
+		if err == nil{
+			atomic.AddInt64(&q.g.stats.wbFlushed,1)
+			return
+		}
+		if attempt < q.opts.MaxRetries{
+			atomic.AddInt64(&q.g.stats.wbRetries,1)
+		}
+	}
+
+	atomic.AddInt64(&q.g.stats.wbFailed,1)
+	q.requeue(w,err)
+}
+
+//requeue 重试次数用完的写操作重新入队，队列中已经有该key更新的写入时丢弃旧的，无法入队时交给OnDeadLetter
+func (q *writeBehindQueue) requeue(w *pendingWrite,err error){
+	q.mu.Lock()
+	_,newer := q.pending[w.key]
+	requeued := !newer && !q.closed && len(q.pending) < q.opts.QueueSize
+	if requeued{
+		q.pending[w.key] = w
+	}
+	q.mu.Unlock()
+
+	switch{
+	case newer:
+		return//更新的写入会覆盖这次写入
+	case requeued:
+		atomic.AddInt64(&q.g.stats.wbRequeued,1)
+		logrus.Warnf("[mycache] write-behind for key %s in group [%s] failed, requeued: %v",w.key,q.g.name,err)
+		return
+	}
+
+	atomic.AddInt64(&q.g.stats.wbDeadLetters,1)
+	logrus.Errorf("[mycache] write-behind gave up on key %s in group [%s]: %v",w.key,q.g.name,err)
+	if q.opts.OnDeadLetter != nil{
+		q.opts.OnDeadLetter(w.key,w.value,err)
+	}
+}
+
+//5.len 返回待写入的key数量
+func (q *writeBehindQueue) len() int{
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+//6.close 停止刷写协程，并等待剩余数据刷完
+func (q *writeBehindQueue) close(){
+	q.mu.Lock()
+	if q.closed{
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	q.mu.Unlock()
+
+	close(q.stopCh)
+	<-q.done
+}
+
+//persistSet 按写入模式将Set持久化到数据源
+func (g *Group) persistSet(ctx context.Context,key string,value []byte) error{
+	switch g.writeMode{
+	case WriteThrough:
+		return g.setter.Set(ctx,key,value)
+	case WriteBehind:
+		return g.writeBehind.enqueue(key,cloneBytes(value))
+	}
+	return nil
+}
+
+//persistDelete 按写入模式将Delete持久化到数据源
+func (g *Group) persistDelete(ctx context.Context,key string) error{
+	switch g.writeMode{
+	case WriteThrough:
+		if g.deleter != nil{
+			return g.deleter.Delete(ctx,key)
+		}
+	case WriteBehind:
+		if g.deleter != nil{
+			return g.writeBehind.enqueue(key,nil)
+		}
+	}
+	return nil
+}
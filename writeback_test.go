@@ -0,0 +1,281 @@
+package mycache
+
+import(
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/Rampage-cd/DistributedCache/pb"
+	"github.com/Rampage-cd/DistributedCache/registry"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+//recordingSetter 记录写入数据源的值，前failures次写入失败
+type recordingSetter struct{
+	mu sync.Mutex
+	values map[string]string
+	calls int
+	failures int
+}
+
+func (s *recordingSetter) Set(ctx context.Context,key string,value []byte) error{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.calls <= s.failures{
+		return errors.New("source unavailable")
+	}
+	if s.values == nil{
+		s.values = make(map[string]string)
+	}
+	s.values[key] = string(value)
+	return nil
+}
+
+func (s *recordingSetter) get(key string) (string,bool){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v,ok := s.values[key]
+	return v,ok
+}
+
+func newWriteBehindGroup(t *testing.T,name string,setter Setter,opts WriteBehindOptions) *Group{
+	g := NewGroup(name,1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithWriteBehind(setter,nil,opts))
+	t.Cleanup(func(){ DestroyGroup(name) })
+	return g
+}
+
+func TestWriteBehindCoalescing(t *testing.T){
+	setter := &recordingSetter{}
+	g := newWriteBehindGroup(t,"writebehind-coalesce",setter,WriteBehindOptions{QueueSize: 2,FlushInterval: time.Hour})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++{
+		if err := g.Set(ctx,"a",[]byte(fmt.Sprint(i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if err := g.Set(ctx,"b",[]byte("b")); err != nil{
+		t.Fatal(err)
+	}
+	if n := g.writeBehind.len(); n != 2{
+		t.Fatalf("expected 2 pending keys, got %d",n)
+	}
+	if coalesced := atomic.LoadInt64(&g.stats.wbCoalesced); coalesced != 2{
+		t.Fatalf("expected 2 coalesced writes, got %d",coalesced)
+	}
+
+	//队列满时新key被拒绝，已经在队列中的key仍然可以合并
+	if err := g.Set(ctx,"c",[]byte("c")); !errors.Is(err,ErrWriteQueueFull){
+		t.Fatalf("expected ErrWriteQueueFull, got %v",err)
+	}
+	if err := g.Set(ctx,"a",[]byte("3")); err != nil{
+		t.Fatalf("pending keys should still coalesce when the queue is full: %v",err)
+	}
+
+	//关闭时刷完剩余数据，每个key只写最后一次
+	g.Close()
+	if v,_ := setter.get("a"); v != "3"{
+		t.Fatalf("expected the last value of a to be flushed, got %q",v)
+	}
+	if _,ok := setter.get("b"); !ok || setter.calls != 2{
+		t.Fatalf("expected one write per key, got %d writes",setter.calls)
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T){
+	setter := &recordingSetter{failures: 2}
+	g := newWriteBehindGroup(t,"writebehind-retry",setter,WriteBehindOptions{
+		FlushInterval: 10*time.Millisecond,
+		MaxRetries: 3,
+		RetryBackoff: 20*time.Millisecond,
+	})
+
+	start := time.Now()
+	if err := g.Set(context.Background(),"a",[]byte("1")); err != nil{
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5*time.Second)
+	for atomic.LoadInt64(&g.stats.wbFlushed) == 0{
+		if time.Now().After(deadline){
+			t.Fatal("write was not retried")
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+	//两次退避：20ms和40ms
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond{
+		t.Fatalf("retries should back off, finished after %v",elapsed)
+	}
+	if retries := atomic.LoadInt64(&g.stats.wbRetries); retries != 2{
+		t.Fatalf("expected 2 retries, got %d",retries)
+	}
+	if v,_ := setter.get("a"); v != "1"{
+		t.Fatalf("expected a to be written, got %q",v)
+	}
+
+	//重试次数用完后重新入队，数据源恢复后写入
+	setter.mu.Lock()
+	setter.calls,setter.failures = 0,100
+	setter.mu.Unlock()
+	if err := g.Set(context.Background(),"b",[]byte("2")); err != nil{
+		t.Fatal(err)
+	}
+	for atomic.LoadInt64(&g.stats.wbRequeued) == 0{
+		if time.Now().After(deadline){
+			t.Fatal("write should be requeued after the retries are used up")
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+	if atomic.LoadInt64(&g.stats.wbFailed) == 0{
+		t.Fatal("exhausted retries should be counted")
+	}
+	setter.mu.Lock()
+	setter.failures = 0
+	setter.mu.Unlock()
+	for{
+		if v,_ := setter.get("b"); v == "2"{
+			break
+		}
+		if time.Now().After(deadline){
+			t.Fatal("requeued write was not flushed after the source recovered")
+		}
+		time.Sleep(5*time.Millisecond)
+	}
+	if n := atomic.LoadInt64(&g.stats.wbDeadLetters); n != 0{
+		t.Fatalf("no write should be dead-lettered, got %d",n)
+	}
+}
+
+func TestWriteBehindDeadLetter(t *testing.T){
+	setter := &recordingSetter{failures: 1<<30}
+	var mu sync.Mutex
+	dead := make(map[string]string)
+	g := newWriteBehindGroup(t,"writebehind-dead-letter",setter,WriteBehindOptions{
+		FlushInterval: time.Hour,
+		MaxRetries: -1,
+		FlushTimeout: time.Second,
+		OnDeadLetter: func(key string,value []byte,err error){
+			mu.Lock()
+			defer mu.Unlock()
+			dead[key] = string(value)
+		},
+	})
+	if err := g.Set(context.Background(),"a",[]byte("1")); err != nil{
+		t.Fatal(err)
+	}
+
+	//关闭时最后一次刷写失败，无法重新入队，交给OnDeadLetter
+	g.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if dead["a"] != "1" || atomic.LoadInt64(&g.stats.wbDeadLetters) != 1{
+		t.Fatalf("the failed write should reach the dead-letter hook, got %v",dead)
+	}
+}
+
+func TestWriteBehindSetDuringClose(t *testing.T){
+	setter := &recordingSetter{}
+	g := newWriteBehindGroup(t,"writebehind-close",setter,WriteBehindOptions{FlushInterval: time.Hour})
+
+	//关闭期间并发写入：成功返回的写入都必须刷到数据源
+	var accepted sync.Map
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++{
+		wg.Add(1)
+		go func(i int){
+			defer wg.Done()
+			for j := 0; j < 200; j++{
+				key := fmt.Sprintf("%d-%d",i,j)
+				if err := g.writeBehind.enqueue(key,[]byte(key)); err == nil{
+					accepted.Store(key,true)
+				}
+			}
+		}(i)
+	}
+	time.Sleep(time.Millisecond)
+	g.writeBehind.close()
+	wg.Wait()
+
+	accepted.Range(func(k,_ interface{}) bool{
+		if _,ok := setter.get(k.(string)); !ok{
+			t.Errorf("%s was accepted but never flushed",k)
+			return false
+		}
+		return true
+	})
+	if err := g.writeBehind.enqueue("late",[]byte("x")); !errors.Is(err,ErrWriteQueueClosed){
+		t.Fatalf("expected ErrWriteQueueClosed after close, got %v",err)
+	}
+}
+
+func TestWriteThroughOnGRPCWrite(t *testing.T){
+	setter := &recordingSetter{}
+	peer := &invalidationPeer{}
+	name := "writethrough-grpc"
+	g := NewGroup(name,1<<20,GetterFunc(func(ctx context.Context,key string) ([]byte,error){
+		return []byte("v"),nil
+	}),WithWriteThrough(setter,nil),WithPeers(&invalidationPicker{peer: peer}))
+	t.Cleanup(func(){ DestroyGroup(name) })
+
+	lis,err := net.Listen("tcp","127.0.0.1:0")
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+
+	srv,err := NewServer(addr,"writethrough-test",WithRegistry(registry.NewStaticDiscovery(addr)),WithHandoffTimeout(0))
+	if err != nil{
+		t.Fatal(err)
+	}
+	go srv.Start()
+	defer srv.Stop()
+
+	conn,err := grpc.NewClient(addr,grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cli := pb.NewMyCacheClient(conn)
+
+	ctx,cancel := context.WithTimeout(context.Background(),5*time.Second)
+	defer cancel()
+
+	//客户端直接发送的写入要写到数据源并广播失效通知
+	if _,err := cli.Set(ctx,&pb.Request{Group: name,Key: "a",Value: []byte("1")},grpc.WaitForReady(true)); err != nil{
+		t.Fatal(err)
+	}
+	if v,_ := setter.get("a"); v != "1"{
+		t.Fatalf("the gRPC write should reach the Setter, got %q",v)
+	}
+	waitDelivered(t,g)
+	if batches := peer.sent(); len(batches) != 1 || batches[0][0] != "a"{
+		t.Fatalf("the gRPC write should be invalidated on other nodes, got %v",batches)
+	}
+
+	//其他节点同步过来的写入已经由源节点写过数据源
+	if _,err := cli.Replicate(ctx,&pb.ReplicateRequest{Group: name,Key: "b",Value: []byte("2")}); err != nil{
+		t.Fatal(err)
+	}
+	if _,ok := setter.get("b"); ok{
+		t.Fatal("a synced write should not be persisted again")
+	}
+
+	//没有开启认证时，调用方自己加上的from-peer元数据不会跳过数据源
+	forged := metadata.AppendToOutgoingContext(ctx,fromPeerKey,"true")
+	if _,err := cli.Set(forged,&pb.Request{Group: name,Key: "c",Value: []byte("3")}); err != nil{
+		t.Fatal(err)
+	}
+	if v,_ := setter.get("c"); v != "3"{
+		t.Fatalf("a forged from-peer write should still reach the Setter, got %q",v)
+	}
+}